@@ -4,6 +4,8 @@ package lab7
 
 import (
 	"fmt"
+	"net/netip"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -13,58 +15,82 @@ const datetimeFormat = "2006/01/02, 15:04:05"
 const dateFormat = "2006/01/02"
 const timeLen = len(datetimeFormat)
 
-// ChZap represents a channel change event (Zap)
+// ChZap represents a channel change event (Zap). Addr is the parsed IP, or the
+// zero Addr if IP is not an address.
 type ChZap struct {
 	Time     time.Time
 	IP       string
+	Addr     netip.Addr
 	ToChan   string
 	FromChan string
 }
 
-// StatusChange represent a status change event
-type StatusChange struct {
-	Time   time.Time
-	IP     string
-	Status string
-}
+// Off is the channel name used by set-top boxes in zaps when they are turned off
+// or on. It is a power state rather than a channel that can be viewed.
+const Off = "OFF"
 
-// NewSTBEvent takes a raw event string from the server and returns a ChZap or StatusChange event
-func NewSTBEvent(event string) (*ChZap, *StatusChange, error) {
+// StatusKind identifies which set-top box setting a StatusChange reports on
+type StatusKind uint8
 
-	if len(event) < 30 {
-		return nil, nil, fmt.Errorf("NewSTBEvent: too short event string: %v", event)
-	}
+// The status kinds reported by the set-top boxes
+const (
+	StatusUnknown StatusKind = iota
+	StatusVolume
+	StatusMute
+	StatusHDMI
+)
 
-	fields := strings.Split(event[22:], ", ")
-	if len(fields) < 2 {
-		return nil, nil, fmt.Errorf("NewSTBEvent: event with too few fields: %v", event)
-	}
+// statusNames maps the name used in the event string to its kind
+var statusNames = map[string]StatusKind{
+	"Volume":      StatusVolume,
+	"Mute_Status": StatusMute,
+	"HDMI_Status": StatusHDMI,
+}
 
-	if len(fields) == 2 {
-		// Parse event as status change (Currently only returns the raw string)
-		ztat, err := parseStatus(fields)
-		if err != nil {
-			return nil, nil, err
-		}
+// String returns the name of the status kind as it appears in event strings
+func (k StatusKind) String() string {
+	switch k {
+	case StatusVolume:
+		return "Volume"
+	case StatusMute:
+		return "Mute_Status"
+	case StatusHDMI:
+		return "HDMI_Status"
+	}
+	return "Unknown"
+}
 
-		return nil, ztat, nil
+// maxValue returns the highest value allowed for the status kind.
+// Volume ranges from 0 to 100 while mute and HDMI are either 0 or 1.
+func (k StatusKind) maxValue() int {
+	if k == StatusVolume {
+		return 100
 	}
+	return 1
+}
 
-	if len(fields) == 3 {
-		// Parse event as channel change
-		zap := parseZap(fields)
+// StatusChange represent a status change event. Addr is the parsed IP, like in
+// ChZap.
+type StatusChange struct {
+	Time  time.Time
+	IP    string
+	Addr  netip.Addr
+	Kind  StatusKind
+	Value int
+}
 
-		parsedTime, err := time.Parse(datetimeFormat, event[:timeLen])
-		if err != nil {
-			err = fmt.Errorf("NewSTBEvent: failed to parse timestamp")
-			return nil, nil, err
-		}
+// MinEventLen is the length of the shortest event string NewSTBEvent accepts
+const MinEventLen = 30
 
-		zap.Time = parsedTime
-		return zap, nil, nil
+// NewSTBEvent takes a raw event string from the server and returns a ChZap or
+// StatusChange event. The event is parsed with the ZapBox2013 schema.
+func NewSTBEvent(event string) (*ChZap, *StatusChange, error) {
+
+	if len(event) < MinEventLen {
+		return nil, nil, fmt.Errorf("NewSTBEvent: too short event string: %v", event)
 	}
 
-	return nil, nil, fmt.Errorf("NewSTBEvent: Could not parse event string: '%v'", event)
+	return ZapBox2013.Parse(event)
 }
 
 func (z ChZap) String() string {
@@ -73,9 +99,52 @@ func (z ChZap) String() string {
 	return s
 }
 
+// String returns the status change in the same form as the event string, ie. "Volume: 50"
 func (schg StatusChange) String() string {
-	// StatusChange currently only holds the original event's string
-	return schg.Status
+	return fmt.Sprintf("%v: %v", schg.Kind, schg.Value)
+}
+
+// Format returns the zap as an event in the ZapBox 2013 format, in the time zone
+// of the schema, such as
+//
+//	2013/07/20, 21:56:13, 252.126.91.56, NRK1, TV2 Norge
+//
+// ZapBox2013.Parse turns the event back into the same zap, to the second, as
+// long as the IP and channel names hold no commas or surrounding whitespace.
+// Zaps have no MarshalText, which would make JSON drop the fraction of the
+// second and the time zone.
+func (z ChZap) Format() string {
+	return string(z.AppendFormat(nil))
+}
+
+// AppendFormat appends the zap as formatted by Format to b
+func (z ChZap) AppendFormat(b []byte) []byte {
+	b = z.Time.In(ZapBox2013.Location()).AppendFormat(b, datetimeFormat)
+	b = append(b, ", "...)
+	b = append(b, z.IP...)
+	b = append(b, ", "...)
+	b = append(b, z.ToChan...)
+	b = append(b, ", "...)
+	return append(b, z.FromChan...)
+}
+
+// Format returns the status change as an event in the ZapBox 2013 format, like
+// ChZap.Format, such as
+//
+//	2013/07/20, 21:57:42, 203.124.29.72, Volume: 50
+func (schg StatusChange) Format() string {
+	return string(schg.AppendFormat(nil))
+}
+
+// AppendFormat appends the status change as formatted by Format to b
+func (schg StatusChange) AppendFormat(b []byte) []byte {
+	b = schg.Time.In(ZapBox2013.Location()).AppendFormat(b, datetimeFormat)
+	b = append(b, ", "...)
+	b = append(b, schg.IP...)
+	b = append(b, ", "...)
+	b = append(b, schg.Kind.String()...)
+	b = append(b, ": "...)
+	return strconv.AppendInt(b, int64(schg.Value), 10)
 }
 
 // Duration returns the time between receiving (this) zap event and the provided event
@@ -83,23 +152,52 @@ func (z ChZap) Duration(provided ChZap) time.Duration {
 	return z.Time.Sub(provided.Time)
 }
 
-func parseZap(event []string) *ChZap {
-	var zap ChZap
+// PowerOn reports whether the zap turns the set-top box on
+func (z ChZap) PowerOn() bool {
+	return z.FromChan == Off && z.ToChan != Off
+}
 
-	zap.IP = event[0]
-	zap.FromChan = event[1]
-	zap.ToChan = event[2]
-	return &zap
+// PowerOff reports whether the zap turns the set-top box off
+func (z ChZap) PowerOff() bool {
+	return z.ToChan == Off && z.FromChan != Off
 }
 
-func parseStatus(event []string) (*StatusChange, error) {
-	// Currently only returns the raw string
+// parseStatus parses a status such as "Volume: 50". The event's fields are
+// only used in errors.
+func parseStatus(event []string, ip, status, sep string) (*StatusChange, error) {
 	var ztat StatusChange
-	ztat.Status = event[1]
 
+	name, value := splitStatus(status, sep)
+	kind, ok := statusNames[name]
+	if !ok {
+		return nil, &eventFieldsError{eventFields: event, reason: fmt.Sprintf("unknown status '%v'", name)}
+	}
+
+	v, err := strconv.Atoi(value)
+	if err != nil {
+		return nil, &eventFieldsError{eventFields: event, reason: fmt.Sprintf("%v value '%v' is not a number", kind, value)}
+	}
+
+	if v < 0 || v > kind.maxValue() {
+		return nil, &eventFieldsError{eventFields: event, reason: fmt.Sprintf("%v value %v is outside [0, %v]", kind, v, kind.maxValue())}
+	}
+
+	ztat.IP = ip
+	ztat.Addr, _ = netip.ParseAddr(ip)
+	ztat.Kind = kind
+	ztat.Value = v
 	return &ztat, nil
 }
 
+// splitStatus splits a status field such as "Volume: 50" into its name and value
+func splitStatus(status, sep string) (string, string) {
+	i := strings.Index(status, sep)
+	if i < 0 {
+		return status, ""
+	}
+	return strings.TrimSpace(status[:i]), strings.TrimSpace(status[i+len(sep):])
+}
+
 // Date returns the date in string form
 func (z ChZap) Date() string {
 	return z.Time.Format(dateFormat)
@@ -122,12 +220,18 @@ func (e *eventLengthError) Error() string {
 	return fmt.Sprintf("Event '%v' needs a minimum length of 30, but is of length %v", e.event, len(e.event))
 }
 
+// eventFieldsError is returned when the fields of an event are malformed. If no
+// reason is given the error is assumed to be caused by the number of fields.
 type eventFieldsError struct {
 	eventFields []string
+	reason      string
 }
 
 func (e *eventFieldsError) Error() string {
 	csv := strings.Join(e.eventFields, ", ")
+	if e.reason != "" {
+		return fmt.Sprintf("Event '%v' has invalid fields: %v", csv, e.reason)
+	}
 	n := len(e.eventFields)
 	return fmt.Sprintf("Event '%v' needs [2, 3] fields, but found %v", csv, n)
 }
@@ -30,9 +30,12 @@ var timeerrtests = []struct {
 	in  string
 	out string
 }{
-	{"2010/12/24, 24:00:00, 10.200.8.24, NRK 3, Disney XD", "NewSTBEvent: failed to parse timestamp"},
-	{"2010/12/24, 00:60:00, 10.200.8.24, NRK 3, Disney XD", "NewSTBEvent: failed to parse timestamp"},
-	{"2010/12/24, 00:00:60, 10.200.8.24, NRK 3, Disney XD", "NewSTBEvent: failed to parse timestamp"},
+	{"2010/12/24, 24:00:00, 10.200.8.24, NRK 3, Disney XD", "Could not parse timestamp in event '2010/12/24, 24:00:00, 10.200.8.24, NRK 3, Disney XD'\n" +
+		"parsing time \"2010/12/24 24:00:00\": hour out of range"},
+	{"2010/12/24, 00:60:00, 10.200.8.24, NRK 3, Disney XD", "Could not parse timestamp in event '2010/12/24, 00:60:00, 10.200.8.24, NRK 3, Disney XD'\n" +
+		"parsing time \"2010/12/24 00:60:00\": minute out of range"},
+	{"2010/12/24, 00:00:60, 10.200.8.24, NRK 3, Disney XD", "Could not parse timestamp in event '2010/12/24, 00:00:60, 10.200.8.24, NRK 3, Disney XD'\n" +
+		"parsing time \"2010/12/24 00:00:60\": second out of range"},
 }
 
 func TestSTBTimeErr(t *testing.T) {
@@ -54,7 +57,7 @@ var toofewfieldstests = []struct {
 	out string
 }{
 	{"2010/12/24, 00:00:00", "NewSTBEvent: too short event string: 2010/12/24, 00:00:00"},
-	{"2010/12/24, 00:00:00, 10.200.8.24 ", "NewSTBEvent: event with too few fields: 2010/12/24, 00:00:00, 10.200.8.24 "},
+	{"2010/12/24, 00:00:00, 10.200.8.24 ", "Parse: event with too few fields: 2010/12/24, 00:00:00, 10.200.8.24 "},
 }
 
 func TestSTBTooFewFields(t *testing.T) {
@@ -72,11 +75,19 @@ func TestSTBTooFewFields(t *testing.T) {
 }
 
 var statuschangetests = []struct {
-	in  string
-	out string
+	in    string
+	out   string
+	ip    string
+	kind  StatusKind
+	value int
 }{
-	{"2013/07/20, 21:57:42, 203.124.29.72, Volume: 50", "Volume: 50"},
-	{"2013/07/20, 21:57:42, 203.124.29.72, Mute_Status: 0", "Mute_Status: 0"},
+	{"2013/07/20, 21:57:42, 203.124.29.72, Volume: 50", "Volume: 50", "203.124.29.72", StatusVolume, 50},
+	{"2013/07/20, 21:57:42, 203.124.29.72, Volume: 0", "Volume: 0", "203.124.29.72", StatusVolume, 0},
+	{"2013/07/20, 21:57:42, 203.124.29.72, Volume: 100", "Volume: 100", "203.124.29.72", StatusVolume, 100},
+	{"2013/07/20, 21:57:42, 203.124.29.72, Mute_Status: 0", "Mute_Status: 0", "203.124.29.72", StatusMute, 0},
+	{"2013/07/20, 21:57:42, 203.124.29.72, Mute_Status: 1", "Mute_Status: 1", "203.124.29.72", StatusMute, 1},
+	{"2013/07/20, 21:56:13, 252.126.91.56, HDMI_Status: 0", "HDMI_Status: 0", "252.126.91.56", StatusHDMI, 0},
+	{"2013/07/20, 21:56:13, 252.126.91.56, HDMI_Status: 1", "HDMI_Status: 1", "252.126.91.56", StatusHDMI, 1},
 }
 
 func TestSTBStatusChange(t *testing.T) {
@@ -85,11 +96,99 @@ func TestSTBStatusChange(t *testing.T) {
 		if zap != nil || schng == nil || err != nil {
 			t.Errorf("NewSTBEvent(%q) => (%q, %q, %q), want (nil, %q, nil)",
 				tt.in, zap, schng, err, tt.out)
+			continue
+		}
+		if schng.String() != tt.out {
+			t.Errorf("NewSTBEvent(%q) => (nil, %q, nil), want (nil, %q, nil)",
+				tt.in, schng, tt.out)
+		}
+		if schng.Kind != tt.kind || schng.Value != tt.value {
+			t.Errorf("NewSTBEvent(%q) => kind %v, value %v, want kind %v, value %v",
+				tt.in, schng.Kind, schng.Value, tt.kind, tt.value)
+		}
+		if schng.IP != tt.ip {
+			t.Errorf("NewSTBEvent(%q) => IP %q, want %q", tt.in, schng.IP, tt.ip)
+		}
+		if s := schng.Time.Format(datetimeFormat); s != tt.in[:timeLen] {
+			t.Errorf("NewSTBEvent(%q) => time %q, want %q", tt.in, s, tt.in[:timeLen])
+		}
+	}
+}
+
+var statuschangeerrtests = []string{
+	"2013/07/20, 21:57:42, 203.124.29.72, Volume: 101",
+	"2013/07/20, 21:57:42, 203.124.29.72, Volume: -1",
+	"2013/07/20, 21:57:42, 203.124.29.72, Volume: loud",
+	"2013/07/20, 21:57:42, 203.124.29.72, Mute_Status: 2",
+	"2013/07/20, 21:57:42, 203.124.29.72, HDMI_Status: 3",
+	"2013/07/20, 21:57:42, 203.124.29.72, Brightness: 1",
+	"2013/07/20, 21:57:42, 203.124.29.72, Volume",
+	"2013/07/20, 24:57:42, 203.124.29.72, Volume: 50",
+}
+
+func TestSTBStatusChangeErr(t *testing.T) {
+	for _, in := range statuschangeerrtests {
+		zap, schng, err := NewSTBEvent(in)
+		if zap != nil || schng != nil || err == nil {
+			t.Errorf("NewSTBEvent(%q) => (%q, %q, %v), want (nil, nil, error)",
+				in, zap, schng, err)
+		}
+	}
+}
+
+var powertests = []struct {
+	to, from string
+	on, off  bool
+}{
+	{"NRK1", Off, true, false},
+	{Off, "NRK1", false, true},
+	{"NRK1", "NRK2", false, false},
+	{Off, Off, false, false},
+}
+
+func TestChZapPower(t *testing.T) {
+	for _, tt := range powertests {
+		z := ChZap{ToChan: tt.to, FromChan: tt.from}
+		if z.PowerOn() != tt.on || z.PowerOff() != tt.off {
+			t.Errorf("%v -> %v: PowerOn() %v, PowerOff() %v, want %v, %v",
+				tt.from, tt.to, z.PowerOn(), z.PowerOff(), tt.on, tt.off)
+		}
+	}
+}
+
+var formattests = []struct {
+	in  string
+	out string
+}{
+	{"2013/07/20, 21:56:55, 111.229.208.129, MAX, Viasat 4", "2013/07/20, 21:56:55, 111.229.208.129, MAX, Viasat 4"},
+	{"2013/7/2, 9:5:3, 10.0.0.2,NRK1,  NRK2   ", "2013/07/02, 09:05:03, 10.0.0.2, NRK1, NRK2"},
+	{"2013/07/20, 21:57:42, 203.124.29.72, Volume : 050", "2013/07/20, 21:57:42, 203.124.29.72, Volume: 50"},
+	{"2013/07/20, 21:56:13, 252.126.91.56, HDMI_Status: 0", "2013/07/20, 21:56:13, 252.126.91.56, HDMI_Status: 0"},
+}
+
+func TestFormat(t *testing.T) {
+	for _, tt := range formattests {
+		zap, schng, err := NewSTBEvent(tt.in)
+		if err != nil {
+			t.Errorf("NewSTBEvent(%q) => %v", tt.in, err)
+			continue
+		}
+
+		var s string
+		if zap != nil {
+			s = zap.Format()
+		} else {
+			s = schng.Format()
 		}
-		// TODO activate code later
-		// if schng.Status != tt.out {
-		// 	t.Errorf("NewSTBEvent(%q) => (nil, %q, nil), want (nil, %q, nil)",
-		// 		tt.in, schng.Status, tt.out)
-		// }
+		if s != tt.out {
+			t.Errorf("Format() of %q => %q, want %q", tt.in, s, tt.out)
+		}
+	}
+
+	// Times are formatted in the schema's time zone
+	zap, _, _ := NewSTBEvent(formattests[0].in)
+	zap.Time = zap.Time.UTC()
+	if s := zap.Format(); s != formattests[0].out {
+		t.Errorf("Format() in UTC => %q, want %q", s, formattests[0].out)
 	}
 }
@@ -0,0 +1,33 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"net"
+	"syscall"
+)
+
+// setMulticastLoopback toggles IP_MULTICAST_LOOP on the socket, which decides
+// whether receivers on the sending host get a copy of each datagram
+func setMulticastLoopback(conn *net.UDPConn, enable bool) error {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	value := 0
+	if enable {
+		value = 1
+	}
+
+	var serr error
+	err = raw.Control(func(fd uintptr) {
+		serr = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IP, syscall.IP_MULTICAST_LOOP, value)
+	})
+	if err != nil {
+		return err
+	}
+
+	return serr
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import "net"
+
+// setMulticastLoopback is only supported on Linux. Other systems use their
+// default, which is usually to loop multicast back to the sending host.
+func setMulticastLoopback(conn *net.UDPConn, enable bool) error {
+	return nil
+}
@@ -0,0 +1,55 @@
+// Zap Traffic Generator
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	zap "github.com/ltlian/glabs/lab7"
+)
+
+var (
+	maddr    = flag.String("mcast", "224.0.1.130:10000", "multicast ip:port to send events to")
+	dataset  = flag.String("file", "", "dataset to send (default stdin)")
+	output   = flag.String("out", "", "write events to this file instead of multicasting them ('-' for stdout)")
+	format   = flag.String("format", zap.FormatLine, "format of the events written with -out: line, jsonl, csv or binary")
+	pace     = flag.String("pace", zap.PaceClock, "pacing: 'clock' syncs dataset time of day with the local clock, 'speed' sends at -speed times real time, 'fast' sends as fast as possible")
+	speed    = flag.Float64("speed", 1, "speed factor used with -pace speed")
+	date     = flag.String("date", "", "rewrite event dates, either 'today' or a date such as 2013/07/20")
+	loopback = flag.Bool("loopback", true, "deliver events to receivers on this host")
+	showHelp = flag.Bool("h", false, "show this help message and exit")
+
+	simulate = flag.Bool("simulate", false, "send events from a simulated viewer population instead of a dataset")
+	boxes    = flag.Int("boxes", 1000, "number of simulated set-top boxes")
+	seed     = flag.Int64("seed", 1, "random seed for the simulation")
+	start    = flag.String("start", "2013/07/20, 18:00:00", "timestamp the simulation starts at")
+	duration = flag.Duration("duration", 24*time.Hour, "length of the simulation, 0 runs forever")
+	truth    = flag.String("truth", "", "write the simulated viewer counts to this file when the simulation ends")
+)
+
+func Usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s [OPTIONS]\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "\nOptions:\n")
+	flag.PrintDefaults()
+}
+
+func parseFlags() {
+	flag.Usage = Usage
+	flag.Parse()
+	if *showHelp {
+		flag.Usage()
+		os.Exit(0)
+	}
+}
+
+func main() {
+	parseFlags()
+
+	err := runGenerator()
+	if err != nil {
+		log.Fatal(err)
+	}
+}
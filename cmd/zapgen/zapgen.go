@@ -0,0 +1,328 @@
+// Zap Traffic Generator
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"sort"
+	"time"
+
+	zap "github.com/ltlian/glabs/lab7"
+	"github.com/ltlian/glabs/lab7/zsim"
+)
+
+// The layout of the -date flag, which is that of the event dates
+const dateFormat = "2006/01/02"
+const datetimeFormat = "2006/01/02, 15:04:05"
+
+// eventSource yields event strings along with their timestamps, and io.EOF
+// when there are no more events
+type eventSource interface {
+	next() (string, time.Time, error)
+}
+
+func runGenerator() error {
+	pacer, err := zap.NewPacer(*pace, *speed)
+	if err != nil {
+		return err
+	}
+
+	rewrite, err := newDateRewriter(*date)
+	if err != nil {
+		return err
+	}
+
+	var src eventSource
+
+	if *simulate {
+		sim, err := newSimulation()
+		if err != nil {
+			return err
+		}
+
+		src = sim
+		defer sim.writeTruth(*truth)
+	} else {
+		in := os.Stdin
+		if *dataset != "" {
+			in, err = os.Open(*dataset)
+			if err != nil {
+				return err
+			}
+			defer in.Close()
+		}
+
+		dec, err := zap.NewFormatDecoder(in, zap.FormatAuto, nil)
+		if err != nil {
+			return err
+		}
+		src = &datasetSource{dec: dec}
+	}
+
+	if *output != "" {
+		out := os.Stdout
+		if *output != "-" {
+			out, err = os.Create(*output)
+			if err != nil {
+				return err
+			}
+			defer out.Close()
+		}
+
+		if *format != zap.FormatLine {
+			enc, err := zap.NewEncoder(out, *format)
+			if err != nil {
+				return err
+			}
+			defer enc.Flush()
+
+			return sendEvents(src, encodingWriter{enc}, pacer, rewrite)
+		}
+
+		w := lineWriter{bufio.NewWriter(out)}
+		defer w.Flush()
+
+		return sendEvents(src, w, pacer, rewrite)
+	}
+
+	conn, err := dialMulticast(*maddr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	log.Printf("ZapGen sending to multicast address %v (pacing: %v)", conn.RemoteAddr(), *pace)
+
+	return sendEvents(src, conn, pacer, rewrite)
+}
+
+// dialMulticast opens a UDP socket for sending to the multicast group
+func dialMulticast(address string) (*net.UDPConn, error) {
+	addr, err := net.ResolveUDPAddr("udp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	if !addr.IP.IsMulticast() {
+		return nil, fmt.Errorf("%v is not a multicast address", addr.IP)
+	}
+
+	conn, err := net.DialUDP("udp", nil, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	err = setMulticastLoopback(conn, *loopback)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+// sendEvents writes each event as a single datagram (or line) when it is due
+func sendEvents(src eventSource, w io.Writer, pacer *zap.Pacer, rewrite *dateRewriter) error {
+	var sent int
+
+	for {
+		event, t, err := src.next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		pacer.Wait(t)
+
+		_, err = w.Write([]byte(rewrite.apply(event, t)))
+		if err != nil {
+			return err
+		}
+
+		sent++
+	}
+
+	log.Printf("ZapGen finished after sending %v events", sent)
+	return nil
+}
+
+// datasetSource reads events from a recorded dataset
+type datasetSource struct {
+	dec *zap.Decoder
+}
+
+func (ds *datasetSource) next() (string, time.Time, error) {
+	for {
+		zCh, ztat, err := ds.dec.Decode()
+		if _, ok := err.(*zap.LineError); ok {
+			log.Printf("Skipping malformed event: %v", err)
+			continue
+		} else if err != nil {
+			return "", time.Time{}, err
+		}
+
+		if zCh != nil {
+			return ds.dec.Text(), zCh.Time, nil
+		}
+		return ds.dec.Text(), ztat.Time, nil
+	}
+}
+
+// simulation produces events from a simulated viewer population
+type simulation struct {
+	sim *zsim.Simulator
+}
+
+func newSimulation() (*simulation, error) {
+	t, err := time.ParseInLocation(datetimeFormat, *start, zap.ZapBox2013.Location())
+	if err != nil {
+		return nil, fmt.Errorf("could not parse start time '%v': %v", *start, err)
+	}
+
+	cfg := zsim.DefaultConfig(*boxes)
+	cfg.Seed = *seed
+	cfg.Start = t
+	cfg.Duration = *duration
+
+	sim, err := zsim.NewSimulator(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("ZapGen simulating %v boxes from %v (seed %v)", *boxes, *start, *seed)
+
+	return &simulation{sim: sim}, nil
+}
+
+func (s *simulation) next() (string, time.Time, error) {
+	event, t, ok := s.sim.Next()
+	if !ok {
+		return "", time.Time{}, io.EOF
+	}
+	return event, t, nil
+}
+
+// writeTruth writes the true viewer counts of the simulation to a file, sorted by viewers
+func (s *simulation) writeTruth(filename string) {
+	if filename == "" {
+		return
+	}
+
+	f, err := os.Create(filename)
+	if err != nil {
+		log.Printf("Could not write viewer counts: %v", err)
+		return
+	}
+	defer f.Close()
+
+	viewers := s.sim.Viewers()
+	channels := make([]string, 0, len(viewers))
+	for ch := range viewers {
+		channels = append(channels, ch)
+	}
+	sort.Slice(channels, func(i, j int) bool {
+		if viewers[channels[i]] != viewers[channels[j]] {
+			return viewers[channels[i]] > viewers[channels[j]]
+		}
+		return channels[i] < channels[j]
+	})
+
+	fmt.Fprintf(f, "%v, %v\n", zsim.Off, *boxes-s.sim.PoweredOn())
+	for _, ch := range channels {
+		fmt.Fprintf(f, "%v, %v\n", ch, viewers[ch])
+	}
+}
+
+// lineWriter writes each event on its own line
+type lineWriter struct {
+	*bufio.Writer
+}
+
+func (lw lineWriter) Write(p []byte) (int, error) {
+	n, err := lw.Writer.Write(p)
+	if err != nil {
+		return n, err
+	}
+	return n, lw.WriteByte('\n')
+}
+
+// encodingWriter writes each event in one of the other dataset formats
+type encodingWriter struct {
+	enc *zap.Encoder
+}
+
+func (ew encodingWriter) Write(p []byte) (int, error) {
+	zCh, ztat, err := zap.ZapBox2013.Parse(string(p))
+	if err != nil {
+		return 0, err
+	}
+	if err := ew.enc.Encode(zCh, ztat); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// dateRewriter replaces the date of each event. The first event is moved to the
+// given date and later events keep their distance in days from the first.
+type dateRewriter struct {
+	date  time.Time
+	first time.Time
+}
+
+// newDateRewriter parses the -date flag. An empty value returns nil, which
+// leaves the events unchanged.
+func newDateRewriter(value string) (*dateRewriter, error) {
+	switch value {
+	case "":
+		return nil, nil
+	case "today":
+		// Today where the events were recorded
+		y, m, d := time.Now().In(zap.ZapBox2013.Location()).Date()
+		return &dateRewriter{date: time.Date(y, m, d, 0, 0, 0, 0, time.UTC)}, nil
+	}
+
+	t, err := time.Parse(dateFormat, value)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse date '%v': %v", value, err)
+	}
+
+	return &dateRewriter{date: t}, nil
+}
+
+// apply moves the event to its new date, keeping its time of day, and formats
+// it again, since dates in the dataset need not be zero-padded
+func (r *dateRewriter) apply(event string, t time.Time) string {
+	if r == nil {
+		return event
+	}
+
+	zCh, ztat, err := zap.ZapBox2013.Parse(event)
+	if err != nil {
+		return event
+	}
+
+	t = t.In(zap.ZapBox2013.Location())
+	y, m, d := t.Date()
+	day := time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+	if r.first.IsZero() {
+		r.first = day
+	}
+
+	days := int(day.Sub(r.first) / (24 * time.Hour))
+	y, m, d = r.date.AddDate(0, 0, days).Date()
+	h, min, sec := t.Clock()
+	moved := time.Date(y, m, d, h, min, sec, t.Nanosecond(), t.Location())
+
+	if zCh != nil {
+		zCh.Time = moved
+		return string(zCh.AppendFormat(nil))
+	}
+	ztat.Time = moved
+	return string(ztat.AppendFormat(nil))
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	zap "github.com/ltlian/glabs/lab7"
+)
+
+var rewritetests = []struct {
+	date   string
+	events []string
+	want   []string
+}{
+	// Later days keep their distance from the first, across month ends
+	{"2020/02/28", []string{
+		"2013/07/31, 23:59:59, 10.0.0.1, NRK1, NRK2",
+		"2013/08/01, 00:00:01, 10.0.0.1, Volume: 50",
+		"2013/08/02, 12:00:00, 10.0.0.1, NRK2, NRK1",
+	}, []string{
+		"2020/02/28, 23:59:59, 10.0.0.1, NRK1, NRK2",
+		"2020/02/29, 00:00:01, 10.0.0.1, Volume: 50",
+		"2020/03/01, 12:00:00, 10.0.0.1, NRK2, NRK1",
+	}},
+	// Dates and times without zero padding
+	{"2020/12/31", []string{
+		"2013/7/2, 9:5:3, 10.0.0.2, NRK1, NRK2",
+		"2013/7/3, 9:5:3, 10.0.0.2, Mute_Status: 1",
+	}, []string{
+		"2020/12/31, 09:05:03, 10.0.0.2, NRK1, NRK2",
+		"2021/01/01, 09:05:03, 10.0.0.2, Mute_Status: 1",
+	}},
+	// The clocks are set forward in Oslo on 2026/03/29, so 02:30 is moved to
+	// 03:30 like the schema does, and set back on 2026/10/25, when 02:30 happens
+	// twice
+	{"2026/03/28", []string{
+		"2013/07/20, 02:30:00, 10.0.0.1, NRK1, NRK2",
+		"2013/07/21, 02:30:00, 10.0.0.1, NRK2, NRK1",
+		"2013/07/21, 04:00:00, 10.0.0.1, NRK1, NRK2",
+	}, []string{
+		"2026/03/28, 02:30:00, 10.0.0.1, NRK1, NRK2",
+		"2026/03/29, 03:30:00, 10.0.0.1, NRK2, NRK1",
+		"2026/03/29, 04:00:00, 10.0.0.1, NRK1, NRK2",
+	}},
+	{"2026/10/25", []string{
+		"2013/07/20, 02:30:00, 10.0.0.1, NRK1, NRK2",
+		"2013/07/20, 03:30:00, 10.0.0.1, NRK2, NRK1",
+	}, []string{
+		"2026/10/25, 02:30:00, 10.0.0.1, NRK1, NRK2",
+		"2026/10/25, 03:30:00, 10.0.0.1, NRK2, NRK1",
+	}},
+}
+
+func TestDateRewriter(t *testing.T) {
+	for _, tt := range rewritetests {
+		r, err := newDateRewriter(tt.date)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for i, event := range tt.events {
+			zCh, ztat, err := zap.ZapBox2013.Parse(event)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ts := eventTime(zCh, ztat)
+
+			if got := r.apply(event, ts); got != tt.want[i] {
+				t.Errorf("-date %v: apply(%q) => %q, want %q", tt.date, event, got, tt.want[i])
+			}
+		}
+	}
+
+	if _, err := newDateRewriter("20/07/2013"); err == nil {
+		t.Error("newDateRewriter(20/07/2013) => nil error")
+	}
+}
+
+// eventTime returns the timestamp of the zap or status change, whichever is set
+func eventTime(zCh *zap.ChZap, ztat *zap.StatusChange) time.Time {
+	if zCh != nil {
+		return zCh.Time
+	}
+	return ztat.Time
+}
+
+// TestSendEvents checks that a dataset is sent with its dates rewritten and its
+// malformed events skipped
+func TestSendEvents(t *testing.T) {
+	dataset := "2013/07/20, 21:56:13, 10.0.0.1, NRK1, NRK2\n" +
+		"garbage\n" +
+		"2013/07/21, 21:56:14, 10.0.0.1, Volume: 50\n"
+
+	dec, err := zap.NewFormatDecoder(strings.NewReader(dataset), zap.FormatAuto, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pacer, err := zap.NewPacer(zap.PaceFast, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rewrite, err := newDateRewriter("2020/02/29")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	w := lineWriter{bufio.NewWriter(&buf)}
+	if err := sendEvents(&datasetSource{dec: dec}, w, pacer, rewrite); err != nil {
+		t.Fatalf("sendEvents() => %v", err)
+	}
+	w.Flush()
+
+	want := "2020/02/29, 21:56:13, 10.0.0.1, NRK1, NRK2\n" +
+		"2020/03/01, 21:56:14, 10.0.0.1, Volume: 50\n"
+	if buf.String() != want {
+		t.Errorf("sendEvents() wrote %q, want %q", buf.String(), want)
+	}
+}
+
+// TestClockSchedule checks that with clock pacing the events of a dataset are
+// due at their time of day on today's date in Oslo, and on the following days
+// for the dataset's following days
+func TestClockSchedule(t *testing.T) {
+	oslo := zap.ZapBox2013.Location()
+	now := time.Now().In(oslo)
+	base := now.Add(-time.Minute)
+	if base.Day() != now.Day() || now.Add(time.Minute).Day() != now.Day() {
+		t.Skip("too close to midnight in Oslo")
+	}
+
+	clock := base.Format("15:04:05")
+	later := base.Add(30 * time.Second).Format("15:04:05")
+	dataset := "2013/07/20, " + clock + ", 10.0.0.1, NRK1, NRK2\n" +
+		"2013/07/20, " + later + ", 10.0.0.1, NRK2, NRK1\n" +
+		"2013/07/21, " + clock + ", 10.0.0.1, NRK1, NRK2\n"
+
+	dec, err := zap.NewFormatDecoder(strings.NewReader(dataset), zap.FormatAuto, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := &datasetSource{dec: dec}
+	pacer, err := zap.NewPacer(zap.PaceClock, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	y, m, d := now.Date()
+	today := func(days int, tod string) time.Time {
+		c, err := time.Parse("15:04:05", tod)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return time.Date(y, m, d+days, c.Hour(), c.Minute(), c.Second(), 0, oslo)
+	}
+	want := []time.Time{today(0, clock), today(0, later), today(1, clock)}
+
+	for i := range want {
+		_, ts, err := src.next()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// The first event is earlier in the day than now, so it is sent right away
+		if i == 0 {
+			pacer.Wait(ts)
+		}
+		if due := pacer.Due(ts); !due.Equal(want[i]) {
+			t.Errorf("Due(%v) => %v, want %v", ts, due, want[i])
+		}
+	}
+}
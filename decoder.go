@@ -0,0 +1,218 @@
+// +build !solution
+
+package lab7
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Decoder reads STB events from an input stream, one event per line, such as
+// a recorded dataset file, stdin or a TCP connection. Datasets in the other
+// formats are read with NewFormatDecoder, where binary records count as lines.
+type Decoder struct {
+	r      *bufio.Reader
+	schema *Schema
+	format string
+	line   int
+	offset int64
+	text   string
+	err    error
+
+	// Whether the first line of a CSV dataset has been read
+	header bool
+	// The state of a binary dataset, once its magic number has been read
+	bin *binaryState
+	br  *binaryReader
+}
+
+// LineError reports a malformed line found by a Decoder. The decoder can keep
+// reading after a LineError has been returned.
+type LineError struct {
+	Line   int
+	Offset int64
+	Text   string
+	Err    error
+}
+
+func (e *LineError) Error() string {
+	return fmt.Sprintf("line %v (byte offset %v): %v", e.Line, e.Offset, e.Err)
+}
+
+// NewDecoder returns a decoder that reads events from r
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r: bufio.NewReader(r), format: FormatLine}
+}
+
+// NewSchemaDecoder returns a decoder that reads events in the given format
+// from r. A nil schema reads events like NewSTBEvent.
+func NewSchemaDecoder(r io.Reader, s *Schema) *Decoder {
+	return &Decoder{r: bufio.NewReader(r), schema: s, format: FormatLine}
+}
+
+// NewFormatDecoder returns a decoder that reads events in one of the dataset
+// formats from r, or in the format detected from the first bytes with
+// FormatAuto. Events in the line format are parsed with the schema, and times
+// in the other formats are put in its time zone. A nil schema reads events
+// like NewSTBEvent.
+func NewFormatDecoder(r io.Reader, format string, s *Schema) (*Decoder, error) {
+	if err := checkFormat(format, true); err != nil {
+		return nil, fmt.Errorf("NewFormatDecoder: %v", err)
+	}
+	if format == "" {
+		format = FormatAuto
+	}
+	return &Decoder{r: bufio.NewReader(r), schema: s, format: format}, nil
+}
+
+// Decode returns the next event in the stream. Like NewSTBEvent, either a ChZap
+// or a StatusChange is returned. A malformed line is reported as a *LineError,
+// after which Decode may be called again to continue with the next line. Empty
+// lines are skipped. At the end of the stream Decode returns io.EOF, and any
+// other read error is returned on every following call.
+func (d *Decoder) Decode() (*ChZap, *StatusChange, error) {
+	if d.format == FormatAuto {
+		d.format = detectFormat(d.r)
+	}
+	if d.format == FormatBinary {
+		return d.decodeBinary()
+	}
+
+	for d.err == nil {
+		raw, err := d.r.ReadString('\n')
+		if err != nil {
+			d.err = err
+			if raw == "" {
+				break
+			}
+		}
+
+		d.line++
+		start := d.offset
+		d.offset += int64(len(raw))
+
+		text := strings.TrimRight(raw, "\r\n")
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+
+		if d.format == FormatCSV && !d.header {
+			d.header = true
+			if text == csvHeaderLine {
+				continue
+			}
+		}
+
+		d.text = text
+		zap, ztat, err := d.parse(text)
+		if err != nil {
+			return nil, nil, &LineError{Line: d.line, Offset: start, Text: text, Err: err}
+		}
+
+		if d.format != FormatLine {
+			d.text = formatEvent(zap, ztat)
+		}
+		return zap, ztat, nil
+	}
+
+	return nil, nil, d.err
+}
+
+// parse parses an event in the decoder's format
+func (d *Decoder) parse(text string) (*ChZap, *StatusChange, error) {
+	switch d.format {
+	case FormatJSON:
+		return parseJSON(text, d.location())
+	case FormatCSV:
+		record, err := csv.NewReader(strings.NewReader(text)).Read()
+		if err != nil {
+			return nil, nil, err
+		}
+		return parseCSV(record, d.location())
+	}
+
+	if d.schema == nil {
+		return NewSTBEvent(text)
+	}
+	return d.schema.Parse(text)
+}
+
+// decodeBinary returns the next record of a binary dataset. A corrupt record
+// ends the dataset, since the records after it cannot be found.
+func (d *Decoder) decodeBinary() (*ChZap, *StatusChange, error) {
+	if d.err != nil {
+		return nil, nil, d.err
+	}
+
+	if d.bin == nil {
+		d.bin = &binaryState{}
+		d.br = &binaryReader{r: d.r}
+		magic, err := d.br.bytes(uint64(len(binaryMagic)))
+		if err == io.EOF {
+			d.err = err
+			return nil, nil, err
+		} else if err != nil || string(magic) != string(binaryMagic) {
+			d.err = fmt.Errorf("Decode: not a binary dataset of version %v", binaryMagic[len(binaryMagic)-1])
+			return nil, nil, d.err
+		}
+		d.offset = d.br.n
+	}
+
+	zap, ztat, err := d.bin.readBinary(d.br, d.location())
+	if err == io.EOF {
+		d.err = err
+		return nil, nil, err
+	} else if err != nil {
+		d.err = fmt.Errorf("Decode: record %v (byte offset %v): %w", d.line+1, d.offset, err)
+		return nil, nil, d.err
+	}
+
+	d.line++
+	d.offset = d.br.n
+	d.text = formatEvent(zap, ztat)
+	return zap, ztat, nil
+}
+
+// location returns the time zone of the events
+func (d *Decoder) location() *time.Location {
+	if d.schema == nil {
+		return ZapBox2013.Location()
+	}
+	return d.schema.Location()
+}
+
+// formatEvent formats the zap or status change, whichever is set
+func formatEvent(zap *ChZap, ztat *StatusChange) string {
+	if zap != nil {
+		return zap.Format()
+	}
+	return ztat.Format()
+}
+
+// Text returns the line of the most recently decoded event, without the line
+// ending. This is the event string as it was sent by the set-top box. For
+// datasets in the other formats it is the event formatted like the set-top
+// boxes would send it.
+func (d *Decoder) Text() string {
+	return d.text
+}
+
+// Format returns the format of the dataset, which is FormatAuto until the
+// first event has been decoded
+func (d *Decoder) Format() string {
+	return d.format
+}
+
+// Line returns the number of lines read so far
+func (d *Decoder) Line() int {
+	return d.line
+}
+
+// Offset returns the number of bytes read so far
+func (d *Decoder) Offset() int64 {
+	return d.offset
+}
@@ -0,0 +1,65 @@
+package lab7
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+const decoderInput = "2013/07/20, 21:56:13, 252.126.91.56, HDMI_Status: 0\n" +
+	"2013/07/20, 21:56:55, 111.229.208.129, MAX, Viasat 4\r\n" +
+	"\n" +
+	"garbage\n" +
+	"2013/07/20, 21:57:42, 203.124.29.72, Volume: 50"
+
+var decodertests = []struct {
+	zap    bool
+	status bool
+	line   int
+	offset int64
+}{
+	{false, true, 0, 0},
+	{true, false, 0, 0},
+	{false, false, 4, 107},
+	{false, true, 0, 0},
+}
+
+func TestDecoder(t *testing.T) {
+	dec := NewDecoder(strings.NewReader(decoderInput))
+
+	for i, tt := range decodertests {
+		zap, schng, err := dec.Decode()
+		if (zap != nil) != tt.zap || (schng != nil) != tt.status {
+			t.Errorf("Decode() #%v => (%v, %v, %v), want zap %v, status %v",
+				i, zap, schng, err, tt.zap, tt.status)
+		}
+
+		if tt.line == 0 {
+			if err != nil {
+				t.Errorf("Decode() #%v => unexpected error %v", i, err)
+			}
+			continue
+		}
+
+		var lerr *LineError
+		if !errors.As(err, &lerr) {
+			t.Errorf("Decode() #%v => %v, want *LineError", i, err)
+			continue
+		}
+		if lerr.Line != tt.line || lerr.Offset != tt.offset {
+			t.Errorf("Decode() #%v => line %v offset %v, want line %v offset %v",
+				i, lerr.Line, lerr.Offset, tt.line, tt.offset)
+		}
+	}
+
+	if _, _, err := dec.Decode(); err != io.EOF {
+		t.Errorf("Decode() at end of input => %v, want io.EOF", err)
+	}
+	if dec.Line() != 5 {
+		t.Errorf("Line() => %v, want 5", dec.Line())
+	}
+	if dec.Offset() != int64(len(decoderInput)) {
+		t.Errorf("Offset() => %v, want %v", dec.Offset(), len(decoderInput))
+	}
+}
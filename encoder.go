@@ -0,0 +1,119 @@
+// +build !solution
+
+package lab7
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Encoder writes events to a dataset in one of the dataset formats, which a
+// Decoder from NewFormatDecoder reads back. Events are buffered, so Flush must
+// be called after the last one. An Encoder is not safe for concurrent use.
+type Encoder struct {
+	w      *bufio.Writer
+	format string
+	csv    *csv.Writer
+	bin    *binaryState
+	buf    []byte
+}
+
+// NewEncoder returns an encoder that writes events to w in the given format,
+// which must not be FormatAuto. The CSV header and the binary magic number are
+// written right away.
+func NewEncoder(w io.Writer, format string) (*Encoder, error) {
+	if err := checkFormat(format, false); err != nil {
+		return nil, fmt.Errorf("NewEncoder: %v", err)
+	}
+
+	e := &Encoder{w: bufio.NewWriter(w), format: format}
+	switch format {
+	case FormatCSV:
+		e.csv = csv.NewWriter(e.w)
+		e.csv.Write(csvHeader)
+	case FormatBinary:
+		e.bin = &binaryState{channels: make(map[string]uint64)}
+		e.w.Write(binaryMagic)
+	}
+	return e, nil
+}
+
+// Encode writes the zap or the status change, whichever is set. Events that
+// the line format cannot hold, such as a channel name with a comma, are
+// rejected in that format.
+func (e *Encoder) Encode(zap *ChZap, ztat *StatusChange) error {
+	if (zap == nil) == (ztat == nil) {
+		return errors.New("Encode: need either a zap or a status change")
+	}
+
+	switch e.format {
+	case FormatLine:
+		if err := checkLine(zap, ztat); err != nil {
+			return err
+		}
+		if zap != nil {
+			e.buf = zap.AppendFormat(e.buf[:0])
+		} else {
+			e.buf = ztat.AppendFormat(e.buf[:0])
+		}
+		e.buf = append(e.buf, '\n')
+
+	case FormatJSON:
+		je := jsonEvent{}
+		if zap != nil {
+			je.Time, je.IP, je.To, je.From = zap.Time, zap.IP, zap.ToChan, zap.FromChan
+		} else {
+			je.Time, je.IP, je.Status, je.Value = ztat.Time, ztat.IP, ztat.Kind.String(), &ztat.Value
+		}
+		data, err := json.Marshal(je)
+		if err != nil {
+			return err
+		}
+		e.buf = append(append(e.buf[:0], data...), '\n')
+
+	case FormatCSV:
+		if zap != nil {
+			return e.csv.Write([]string{zap.Time.Format(time.RFC3339Nano), zap.IP, zap.ToChan, zap.FromChan, "", ""})
+		}
+		return e.csv.Write([]string{ztat.Time.Format(time.RFC3339Nano), ztat.IP, "", "", ztat.Kind.String(), strconv.Itoa(ztat.Value)})
+
+	case FormatBinary:
+		e.buf = e.bin.appendBinary(e.buf[:0], zap, ztat)
+	}
+
+	_, err := e.w.Write(e.buf)
+	return err
+}
+
+// checkLine checks that the event parses back into itself in the line format
+func checkLine(zap *ChZap, ztat *StatusChange) error {
+	_, ip, _ := eventOf(zap, ztat)
+	fields := []string{ip}
+	if zap != nil {
+		fields = append(fields, zap.ToChan, zap.FromChan)
+	}
+	for _, f := range fields {
+		if f == "" || f != strings.TrimSpace(f) || strings.ContainsAny(f, ",\n") {
+			return fmt.Errorf("Encode: %q cannot be written in the line format", f)
+		}
+	}
+	return nil
+}
+
+// Flush writes the buffered events to the underlying writer
+func (e *Encoder) Flush() error {
+	if e.csv != nil {
+		e.csv.Flush()
+		if err := e.csv.Error(); err != nil {
+			return err
+		}
+	}
+	return e.w.Flush()
+}
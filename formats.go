@@ -0,0 +1,370 @@
+// +build !solution
+
+package lab7
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"strconv"
+	"time"
+)
+
+// The dataset formats that events can be encoded in and decoded from
+const (
+	// FormatAuto detects the format when decoding
+	FormatAuto = "auto"
+	// FormatLine is the ZapBox 2013 format sent by the set-top boxes, one
+	// event per line as formatted by ChZap.Format and StatusChange.Format
+	FormatLine = "line"
+	// FormatJSON is JSON Lines, one object per event
+	FormatJSON = "jsonl"
+	// FormatCSV is CSV with a header, one record per event
+	FormatCSV = "csv"
+	// FormatBinary is a compact binary format, where channel names are written
+	// once and referred to by number after that
+	FormatBinary = "binary"
+)
+
+// Formats lists the dataset formats, for flag help and validation
+var Formats = []string{FormatLine, FormatJSON, FormatCSV, FormatBinary}
+
+// checkFormat checks that the format is known. FormatAuto is accepted when
+// decoding.
+func checkFormat(format string, decoding bool) error {
+	if decoding && (format == FormatAuto || format == "") {
+		return nil
+	}
+	for _, f := range Formats {
+		if f == format {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown event format '%v'", format)
+}
+
+// csvHeader is the first record of a CSV dataset. Zaps leave status and value
+// empty, and status changes leave to and from empty.
+var csvHeader = []string{"time", "ip", "to", "from", "status", "value"}
+
+// csvHeaderLine is the header as written by encoding/csv
+const csvHeaderLine = "time,ip,to,from,status,value"
+
+// binaryMagic starts a binary dataset, followed by the version of the format
+var binaryMagic = []byte("ZAPB\x01")
+
+// Binary record kinds
+const (
+	binaryZap    byte = 1
+	binaryStatus byte = 2
+)
+
+// detectFormat guesses the format of a dataset from its first bytes, without
+// reading further than the shortest event
+func detectFormat(r *bufio.Reader) string {
+	head, _ := r.Peek(len(csvHeaderLine))
+	switch {
+	case bytes.HasPrefix(head, binaryMagic):
+		return FormatBinary
+	case bytes.HasPrefix(head, []byte("{")):
+		return FormatJSON
+	case string(head) == csvHeaderLine:
+		return FormatCSV
+	}
+	return FormatLine
+}
+
+// jsonEvent is an event in JSON Lines. Zaps set To and From, and status
+// changes Status and Value.
+type jsonEvent struct {
+	Time   time.Time `json:"time"`
+	IP     string    `json:"ip"`
+	To     string    `json:"to,omitempty"`
+	From   string    `json:"from,omitempty"`
+	Status string    `json:"status,omitempty"`
+	Value  *int      `json:"value,omitempty"`
+}
+
+// newEvent checks the fields of a decoded event and returns it in loc. Either
+// to and from or a status is set.
+func newEvent(t time.Time, ip, to, from, status string, value int, loc *time.Location) (*ChZap, *StatusChange, error) {
+	if ip == "" {
+		return nil, nil, errors.New("event without ip")
+	}
+	addr, _ := netip.ParseAddr(ip)
+
+	if status == "" {
+		if to == "" || from == "" {
+			return nil, nil, errors.New("zap without both channels")
+		}
+		return &ChZap{Time: t.In(loc), IP: ip, Addr: addr, ToChan: to, FromChan: from}, nil, nil
+	}
+
+	kind, ok := statusNames[status]
+	if !ok {
+		return nil, nil, fmt.Errorf("unknown status '%v'", status)
+	}
+	if value < 0 || value > kind.maxValue() {
+		return nil, nil, fmt.Errorf("%v value %v is outside [0, %v]", kind, value, kind.maxValue())
+	}
+	return nil, &StatusChange{Time: t.In(loc), IP: ip, Addr: addr, Kind: kind, Value: value}, nil
+}
+
+// parseJSON parses an event in JSON Lines
+func parseJSON(text string, loc *time.Location) (*ChZap, *StatusChange, error) {
+	var je jsonEvent
+	if err := json.Unmarshal([]byte(text), &je); err != nil {
+		return nil, nil, err
+	}
+	if je.Status != "" && je.Value == nil {
+		return nil, nil, errors.New("status change without value")
+	}
+
+	var value int
+	if je.Value != nil {
+		value = *je.Value
+	}
+	return newEvent(je.Time, je.IP, je.To, je.From, je.Status, value, loc)
+}
+
+// parseCSV parses an event from the fields of a CSV record
+func parseCSV(record []string, loc *time.Location) (*ChZap, *StatusChange, error) {
+	if len(record) != len(csvHeader) {
+		return nil, nil, fmt.Errorf("record with %v fields, want %v", len(record), len(csvHeader))
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, record[0])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var value int
+	if record[4] != "" {
+		if value, err = strconv.Atoi(record[5]); err != nil {
+			return nil, nil, fmt.Errorf("%v value '%v' is not a number", record[4], record[5])
+		}
+	}
+	return newEvent(t, record[1], record[2], record[3], record[4], value, loc)
+}
+
+// binaryState holds what the encoder and decoder of a binary dataset have in
+// common: the channel names written so far and the time of the previous event,
+// which the next is stored relative to
+type binaryState struct {
+	names    []string
+	channels map[string]uint64
+	prev     int64
+}
+
+// appendBinary appends an event as a binary record
+func (bs *binaryState) appendBinary(b []byte, zap *ChZap, ztat *StatusChange) []byte {
+	t, ip, addr := eventOf(zap, ztat)
+	if zap != nil {
+		b = append(b, binaryZap)
+	} else {
+		b = append(b, binaryStatus)
+	}
+
+	sec := t.Unix()
+	b = binary.AppendVarint(b, sec-bs.prev)
+	b = binary.AppendUvarint(b, uint64(t.Nanosecond()))
+	bs.prev = sec
+
+	// Addresses are stored as such when that gives back the same string
+	switch {
+	case addr.IsValid() && addr.Is4() && addr.String() == ip:
+		a := addr.As4()
+		b = append(append(b, 4), a[:]...)
+	case addr.IsValid() && addr.String() == ip:
+		a := addr.As16()
+		b = append(append(b, 16), a[:]...)
+	default:
+		b = append(b, 0)
+		b = appendString(b, ip)
+	}
+
+	if zap != nil {
+		b = bs.appendChannel(b, zap.ToChan)
+		return bs.appendChannel(b, zap.FromChan)
+	}
+	b = append(b, byte(ztat.Kind))
+	return binary.AppendUvarint(b, uint64(ztat.Value))
+}
+
+// eventOf returns the time and IP of the zap or status change, whichever is set
+func eventOf(zap *ChZap, ztat *StatusChange) (time.Time, string, netip.Addr) {
+	if zap != nil {
+		return zap.Time, zap.IP, zap.Addr
+	}
+	return ztat.Time, ztat.IP, ztat.Addr
+}
+
+// appendChannel appends the number of a channel. A new channel gets the next
+// number, and its name follows. Beyond MaxChannels names are written every
+// time with the next number.
+func (bs *binaryState) appendChannel(b []byte, name string) []byte {
+	if n, ok := bs.channels[name]; ok {
+		return binary.AppendUvarint(b, n)
+	}
+
+	b = binary.AppendUvarint(b, uint64(len(bs.names)))
+	if len(bs.names) < MaxChannels {
+		bs.channels[name] = uint64(len(bs.names))
+		bs.names = append(bs.names, name)
+	}
+	return appendString(b, name)
+}
+
+func appendString(b []byte, s string) []byte {
+	b = binary.AppendUvarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+// binaryReader reads the fields of binary records and counts the bytes read
+type binaryReader struct {
+	r *bufio.Reader
+	n int64
+}
+
+func (br *binaryReader) ReadByte() (byte, error) {
+	c, err := br.r.ReadByte()
+	if err == nil {
+		br.n++
+	}
+	return c, err
+}
+
+func (br *binaryReader) bytes(n uint64) ([]byte, error) {
+	if n > maxFieldLen {
+		return nil, fmt.Errorf("field of %v bytes", n)
+	}
+	b := make([]byte, n)
+	m, err := io.ReadFull(br.r, b)
+	br.n += int64(m)
+	return b, err
+}
+
+func (br *binaryReader) string() (string, error) {
+	n, err := binary.ReadUvarint(br)
+	if err != nil {
+		return "", err
+	}
+	b, err := br.bytes(n)
+	return string(b), err
+}
+
+// maxFieldLen bounds the length of the strings in a binary record, which are
+// shorter than a datagram
+const maxFieldLen = 4096
+
+// readBinary reads a binary record. At the end of the dataset it returns
+// io.EOF, and io.ErrUnexpectedEOF in the middle of a record.
+func (bs *binaryState) readBinary(br *binaryReader, loc *time.Location) (*ChZap, *StatusChange, error) {
+	kind, err := br.ReadByte()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	zap, ztat, err := bs.readRecord(br, kind, loc)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return zap, ztat, err
+}
+
+func (bs *binaryState) readRecord(br *binaryReader, kind byte, loc *time.Location) (*ChZap, *StatusChange, error) {
+	if kind != binaryZap && kind != binaryStatus {
+		return nil, nil, fmt.Errorf("unknown record kind %v", kind)
+	}
+
+	delta, err := binary.ReadVarint(br)
+	if err != nil {
+		return nil, nil, err
+	}
+	nsec, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, nil, err
+	}
+	if nsec >= uint64(time.Second) {
+		return nil, nil, fmt.Errorf("%v nanoseconds", nsec)
+	}
+	bs.prev += delta
+	t := time.Unix(bs.prev, int64(nsec))
+
+	ip, err := bs.readIP(br)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if kind == binaryZap {
+		to, err := bs.readChannel(br)
+		if err != nil {
+			return nil, nil, err
+		}
+		from, err := bs.readChannel(br)
+		if err != nil {
+			return nil, nil, err
+		}
+		return newEvent(t, ip, to, from, "", 0, loc)
+	}
+
+	status, err := br.ReadByte()
+	if err != nil {
+		return nil, nil, err
+	}
+	value, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, nil, err
+	}
+	if value > 100 {
+		return nil, nil, fmt.Errorf("status value %v", value)
+	}
+	return newEvent(t, ip, "", "", StatusKind(status).String(), int(value), loc)
+}
+
+func (bs *binaryState) readIP(br *binaryReader) (string, error) {
+	n, err := br.ReadByte()
+	if err != nil {
+		return "", err
+	}
+
+	switch n {
+	case 0:
+		return br.string()
+	case 4, 16:
+		b, err := br.bytes(uint64(n))
+		if err != nil {
+			return "", err
+		}
+		addr, _ := netip.AddrFromSlice(b)
+		return addr.String(), nil
+	}
+	return "", fmt.Errorf("address of %v bytes", n)
+}
+
+func (bs *binaryState) readChannel(br *binaryReader) (string, error) {
+	n, err := binary.ReadUvarint(br)
+	if err != nil {
+		return "", err
+	}
+	if n < uint64(len(bs.names)) {
+		return bs.names[n], nil
+	}
+	if n > uint64(len(bs.names)) {
+		return "", fmt.Errorf("channel %v before channel %v", n, len(bs.names))
+	}
+
+	name, err := br.string()
+	if err != nil {
+		return "", err
+	}
+	if len(bs.names) < MaxChannels {
+		bs.names = append(bs.names, name)
+	}
+	return name, nil
+}
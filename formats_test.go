@@ -0,0 +1,200 @@
+package lab7
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+// formatEvents are events that every format can hold, with channel names that
+// need quoting in CSV and JSON
+var formatEvents = []string{
+	"2013/07/20, 21:56:13, 252.126.91.56, HDMI_Status: 0",
+	"2013/07/20, 21:56:55, 111.229.208.129, MAX, Viasat 4",
+	"2013/07/20, 21:57:42, 203.124.29.72, Volume: 50",
+	"2013/07/20, 21:57:44, 12.23.36.158, \"Canal 9\", MAX",
+	"2013/07/20, 21:57:45, 10.0.0.1, Kanal Ø, Sjøfartskanalen",
+	"2013/07/20, 21:57:45, box-17, MAX, Viasat 4",
+	"2013/07/19, 23:59:59, 10.0.0.1, Mute_Status: 1",
+	"2013/10/27, 02:30:00, 10.0.0.1, NRK1, NRK2",
+}
+
+// encodeEvents encodes formatEvents in the format
+func encodeEvents(t *testing.T, format string) []byte {
+	var buf bytes.Buffer
+	enc, err := NewEncoder(&buf, format)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, event := range formatEvents {
+		zap, ztat, err := ZapBox2013.Parse(event)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := enc.Encode(zap, ztat); err != nil {
+			t.Fatalf("%v: Encode(%q) => %v", format, event, err)
+		}
+	}
+	if err := enc.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestFormatsRoundTrip(t *testing.T) {
+	for _, format := range Formats {
+		for _, decodeAs := range []string{format, FormatAuto} {
+			data := encodeEvents(t, format)
+			dec, err := NewFormatDecoder(bytes.NewReader(data), decodeAs, ZapBox2013)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, event := range formatEvents {
+				wantZap, wantStatus, _ := ZapBox2013.Parse(event)
+				zap, ztat, err := dec.Decode()
+				switch {
+				case err != nil:
+					t.Errorf("%v as %v: Decode() => %v, want %v", format, decodeAs, err, event)
+				case wantZap != nil:
+					if zap == nil || !zap.Time.Equal(wantZap.Time) || zap.Time.Location() != wantZap.Time.Location() ||
+						zap.IP != wantZap.IP || zap.Addr != wantZap.Addr ||
+						zap.ToChan != wantZap.ToChan || zap.FromChan != wantZap.FromChan {
+						t.Errorf("%v as %v: Decode() => %v, want %v", format, decodeAs, zap, wantZap)
+					}
+				default:
+					if ztat == nil || !ztat.Time.Equal(wantStatus.Time) || ztat.IP != wantStatus.IP ||
+						ztat.Addr != wantStatus.Addr || ztat.Kind != wantStatus.Kind || ztat.Value != wantStatus.Value {
+						t.Errorf("%v as %v: Decode() => %v, want %v", format, decodeAs, ztat, wantStatus)
+					}
+				}
+				if err == nil && dec.Text() != formatEvent(wantZap, wantStatus) {
+					t.Errorf("%v as %v: Text() => %q, want %q", format, decodeAs, dec.Text(), formatEvent(wantZap, wantStatus))
+				}
+			}
+
+			if _, _, err := dec.Decode(); err != io.EOF {
+				t.Errorf("%v as %v: Decode() at end of dataset => %v, want io.EOF", format, decodeAs, err)
+			}
+			if dec.Format() != format {
+				t.Errorf("%v as %v: Format() => %v", format, decodeAs, dec.Format())
+			}
+			if dec.Offset() != int64(len(data)) {
+				t.Errorf("%v as %v: Offset() => %v, want %v", format, decodeAs, dec.Offset(), len(data))
+			}
+		}
+	}
+}
+
+// TestBinaryFormatSize checks that channel names are written once
+func TestBinaryFormatSize(t *testing.T) {
+	binary, line := encodeEvents(t, FormatBinary), encodeEvents(t, FormatLine)
+	if len(binary) >= len(line)/2 {
+		t.Errorf("binary dataset of %v bytes, want less than half of %v", len(binary), len(line))
+	}
+}
+
+func TestBinaryFormatTruncated(t *testing.T) {
+	data := encodeEvents(t, FormatBinary)
+	dec, err := NewFormatDecoder(bytes.NewReader(data[:len(data)-1]), FormatAuto, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < len(formatEvents)-1; i++ {
+		if _, _, err := dec.Decode(); err != nil {
+			t.Fatalf("Decode() #%v => %v", i, err)
+		}
+	}
+	_, _, err = dec.Decode()
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("Decode() of truncated record => %v, want io.ErrUnexpectedEOF", err)
+	}
+	if _, _, again := dec.Decode(); again != err {
+		t.Errorf("Decode() after truncated record => %v, want %v", again, err)
+	}
+}
+
+var formaterrortests = []struct {
+	format string
+	input  string
+	valid  int
+}{
+	{FormatJSON, `{"time":"2013-07-20T21:56:13+02:00","ip":"10.0.0.1","to":"NRK1"}`, 0},
+	{FormatJSON, `{"time":"2013-07-20T21:56:13+02:00","ip":"10.0.0.1","status":"Volume"}`, 0},
+	{FormatJSON, `{"time":"2013-07-20T21:56:13+02:00","ip":"10.0.0.1","status":"Volume","value":101}`, 0},
+	{FormatJSON, `{"time":"yesterday","ip":"10.0.0.1","to":"NRK1","from":"NRK2"}`, 0},
+	{FormatCSV, csvHeaderLine + "\n2013-07-20T21:56:13+02:00,10.0.0.1,NRK1,NRK2,,\n2013-07-20T21:56:13+02:00,,NRK1,NRK2,,", 1},
+	{FormatCSV, csvHeaderLine + "\n2013-07-20T21:56:13+02:00,10.0.0.1,NRK1,NRK2,,\n2013-07-20T21:56:13+02:00,10.0.0.1,,,Volume,loud", 1},
+	{FormatCSV, csvHeaderLine + "\n2013-07-20T21:56:13+02:00,10.0.0.1,NRK1,NRK2,,\n2013-07-20T21:56:13+02:00,10.0.0.1,NRK1", 1},
+}
+
+// TestFormatLineErrors checks that a malformed event in the text formats is a
+// LineError, after which decoding goes on
+func TestFormatLineErrors(t *testing.T) {
+	for _, tt := range formaterrortests {
+		// The events follow the header of the input
+		events := strings.TrimPrefix(string(encodeEvents(t, tt.format)), csvHeaderLine+"\n")
+		input := tt.input + "\n" + events
+		dec, err := NewFormatDecoder(strings.NewReader(input), FormatAuto, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var lerr *LineError
+		var decoded int
+		for {
+			_, _, err := dec.Decode()
+			if err == io.EOF {
+				break
+			}
+			if err == nil {
+				decoded++
+			} else if !errors.As(err, &lerr) {
+				t.Fatalf("%q: Decode() => %v, want *LineError", tt.input, err)
+			}
+		}
+		if lerr == nil {
+			t.Errorf("%q: Decode() => no LineError", tt.input)
+		}
+		if want := len(formatEvents) + tt.valid; decoded != want {
+			t.Errorf("%q: decoded %v events, want %v", tt.input, decoded, want)
+		}
+	}
+}
+
+var encodertests = []struct {
+	zap  *ChZap
+	ztat *StatusChange
+}{
+	{nil, nil},
+	{&ChZap{IP: "10.0.0.1", ToChan: "NRK1, NRK2", FromChan: "MAX"}, nil},
+	{&ChZap{IP: "10.0.0.1", ToChan: " NRK1", FromChan: "MAX"}, nil},
+	{&ChZap{IP: "10.0.0.1", ToChan: "", FromChan: "MAX"}, nil},
+	{nil, &StatusChange{IP: "10.0.0.1\n", Kind: StatusVolume}},
+}
+
+// TestEncoderLine checks that events the line format cannot hold are rejected
+// rather than written as other events
+func TestEncoderLine(t *testing.T) {
+	enc, err := NewEncoder(io.Discard, FormatLine)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range encodertests {
+		if err := enc.Encode(tt.zap, tt.ztat); err == nil {
+			t.Errorf("Encode(%v, %v) => nil error", tt.zap, tt.ztat)
+		}
+	}
+
+	for _, format := range []string{FormatAuto, "xml"} {
+		if _, err := NewEncoder(io.Discard, format); err == nil {
+			t.Errorf("NewEncoder(%q) => nil error", format)
+		}
+	}
+	if _, err := NewFormatDecoder(strings.NewReader(""), "xml", nil); err == nil {
+		t.Error("NewFormatDecoder(xml) => nil error")
+	}
+}
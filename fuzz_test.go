@@ -0,0 +1,114 @@
+package lab7
+
+import (
+	"testing"
+	"unicode/utf8"
+)
+
+// fuzzSeeds are the sample events of the assignment, and events with the
+// channel names and padding that have tripped up parsers before
+var fuzzSeeds = []string{
+	"2013/07/20, 21:56:13, 252.126.91.56, HDMI_Status: 0",
+	"2013/07/20, 21:56:55, 111.229.208.129, MAX, Viasat 4",
+	"2013/07/20, 21:57:48, 98.202.244.97, FEM, TVNORGE",
+	"2013/07/20, 21:57:44, 12.23.36.158, Canal 9, MAX",
+	"2013/07/20, 21:57:46, 81.187.186.219, TV2 Bliss, TV2 Zebra",
+	"2013/07/20, 21:57:42, 61.77.4.101, TV2 Film, TV2 Bliss",
+	"2013/07/20, 21:57:42, 203.124.29.72, Volume: 50",
+	"2013/07/20, 21:57:42, 203.124.29.72, Mute_Status: 0",
+	"2013/07/20, 21:57:42, 10.0.0.1, Kanal Ø, Sjøfartskanalen",
+	"2013/07/20, 21:57:42, 10.0.0.1, 日本, \xff\xfe",
+	"2013/7/2, 9:5:3, 10.0.0.1,NRK1,NRK2          ",
+	"2013/10/27, 02:30:00, 10.0.0.1, NRK1, NRK2",
+	"2013/03/31, 02:30:00, 10.0.0.1, Volume: 7",
+}
+
+// FuzzNewSTBEvent checks that no event makes the parser panic, that it returns
+// either an event or an error, and that formatting a parsed event and parsing
+// it again gives the same event. Formatted events are parsed again with the
+// schema, since NewSTBEvent rejects events shorter than the shortest event of
+// the assignment.
+func FuzzNewSTBEvent(f *testing.F) {
+	for _, event := range fuzzSeeds {
+		f.Add(event)
+	}
+
+	f.Fuzz(func(t *testing.T, event string) {
+		zap, ztat, err := NewSTBEvent(event)
+		switch {
+		case err != nil:
+			if zap != nil || ztat != nil {
+				t.Fatalf("NewSTBEvent(%q) => (%v, %v, %v), want only the error", event, zap, ztat, err)
+			}
+			if !utf8.ValidString(event) {
+				return
+			}
+			// Errors quote the event, so they must not cut it mid-rune
+			if !utf8.ValidString(err.Error()) {
+				t.Fatalf("NewSTBEvent(%q) => error %q, which is not valid UTF-8", event, err)
+			}
+		case (zap == nil) == (ztat == nil):
+			t.Fatalf("NewSTBEvent(%q) => (%v, %v), want exactly one event", event, zap, ztat)
+		case zap != nil:
+			formatted := zap.Format()
+			again, _, err := ZapBox2013.Parse(formatted)
+			if err != nil {
+				t.Fatalf("Parse(%q), formatted from %q => %v", formatted, event, err)
+			}
+			if !again.Time.Equal(zap.Time) || again.IP != zap.IP || again.Addr != zap.Addr ||
+				again.ToChan != zap.ToChan || again.FromChan != zap.FromChan {
+				t.Fatalf("Parse(%q) => %v, want %v parsed from %q", formatted, again, zap, event)
+			}
+		default:
+			formatted := ztat.Format()
+			_, again, err := ZapBox2013.Parse(formatted)
+			if err != nil {
+				t.Fatalf("Parse(%q), formatted from %q => %v", formatted, event, err)
+			}
+			if !again.Time.Equal(ztat.Time) || again.IP != ztat.IP || again.Addr != ztat.Addr ||
+				again.Kind != ztat.Kind || again.Value != ztat.Value {
+				t.Fatalf("Parse(%q) => %v, want %v parsed from %q", formatted, again, ztat, event)
+			}
+		}
+	})
+}
+
+// FuzzParseSTBEventBytes checks that the byte parser gives the results and
+// errors of the schema
+func FuzzParseSTBEventBytes(f *testing.F) {
+	for _, event := range fuzzSeeds {
+		f.Add([]byte(event))
+	}
+
+	p, err := NewParser(ZapBox2013, nil)
+	if err != nil {
+		f.Fatal(err)
+	}
+
+	f.Fuzz(func(t *testing.T, event []byte) {
+		wantZap, wantStatus, wantErr := ZapBox2013.Parse(string(event))
+
+		var zap ChZap
+		var ztat StatusChange
+		isZap, err := p.ParseSTBEventBytes(event, &zap, &ztat)
+
+		switch {
+		case wantErr != nil:
+			if err == nil || err.Error() != wantErr.Error() {
+				t.Fatalf("ParseSTBEventBytes(%q) => %v, want %v", event, err, wantErr)
+			}
+		case err != nil:
+			t.Fatalf("ParseSTBEventBytes(%q) => %v, want %v", event, err, wantZap)
+		case wantZap != nil:
+			if !isZap || !zap.Time.Equal(wantZap.Time) || zap.IP != wantZap.IP || zap.Addr != wantZap.Addr ||
+				zap.ToChan != wantZap.ToChan || zap.FromChan != wantZap.FromChan {
+				t.Fatalf("ParseSTBEventBytes(%q) => zap %v (%v), want %v", event, zap, isZap, *wantZap)
+			}
+		default:
+			if isZap || !ztat.Time.Equal(wantStatus.Time) || ztat.IP != wantStatus.IP || ztat.Addr != wantStatus.Addr ||
+				ztat.Kind != wantStatus.Kind || ztat.Value != wantStatus.Value {
+				t.Fatalf("ParseSTBEventBytes(%q) => status %v (%v), want %v", event, ztat, isZap, *wantStatus)
+			}
+		}
+	})
+}
@@ -0,0 +1,91 @@
+// +build !solution
+
+package lab7
+
+import (
+	"fmt"
+	"time"
+)
+
+// Pacing modes used when replaying recorded events
+const (
+	// PaceClock synchronizes the time of day of the events with the clock in
+	// the events' time zone, like the original traffic generator. The date is
+	// not synchronized.
+	PaceClock = "clock"
+	// PaceSpeed replays the events at a multiple of their original rate
+	PaceSpeed = "speed"
+	// PaceFast replays the events as fast as possible
+	PaceFast = "fast"
+)
+
+// Pacer delays replayed events according to their timestamps
+type Pacer struct {
+	mode  string
+	speed float64
+
+	// Timestamp of the first event and the wall clock time it was replayed at
+	first time.Time
+	start time.Time
+}
+
+// NewPacer creates a pacer for the given mode. The speed factor is only used
+// by PaceSpeed and must be positive.
+func NewPacer(mode string, speed float64) (*Pacer, error) {
+	switch mode {
+	case PaceClock, PaceFast:
+	case PaceSpeed:
+		if speed <= 0 {
+			return nil, fmt.Errorf("NewPacer: speed must be positive, got %v", speed)
+		}
+	default:
+		return nil, fmt.Errorf("NewPacer: unknown pacing mode '%v'", mode)
+	}
+
+	return &Pacer{mode: mode, speed: speed}, nil
+}
+
+// Wait blocks until the event with timestamp t is due. Events that are already
+// due, such as events earlier than the current time of day with PaceClock, are
+// returned right away.
+func (p *Pacer) Wait(t time.Time) {
+	if p.first.IsZero() {
+		p.first = t
+		p.start = time.Now()
+	}
+
+	if p.mode == PaceFast {
+		return
+	}
+
+	if delay := time.Until(p.Due(t)); delay > 0 {
+		time.Sleep(delay)
+	}
+}
+
+// Due returns the wall clock time at which the event with timestamp t should
+// be replayed. Wait must have been called at least once.
+func (p *Pacer) Due(t time.Time) time.Time {
+	switch p.mode {
+	case PaceSpeed:
+		return p.start.Add(time.Duration(float64(t.Sub(p.first)) / p.speed))
+	case PaceClock:
+		// The event's time of day in its own time zone, on the day as many days
+		// after the replay started as the event is after the first event. Days
+		// are calendar days, so the clocks being changed does not shift events.
+		loc := t.Location()
+		y, m, d := p.start.In(loc).Date()
+		h, min, sec := t.Clock()
+		return time.Date(y, m, d+days(p.first.In(loc), t), h, min, sec, t.Nanosecond(), loc)
+	}
+	return p.start
+}
+
+// days returns the number of calendar days from the date of a to that of b
+func days(a, b time.Time) int {
+	ya, ma, da := a.Date()
+	yb, mb, db := b.Date()
+	ua := time.Date(ya, ma, da, 0, 0, 0, 0, time.UTC)
+	ub := time.Date(yb, mb, db, 0, 0, 0, 0, time.UTC)
+	return int(ub.Sub(ua) / (24 * time.Hour))
+}
@@ -0,0 +1,96 @@
+package lab7
+
+import (
+	"testing"
+	"time"
+)
+
+// TestPaceClockDST checks that events are due at their time of day however the
+// clocks are changed between them and during the replay
+func TestPaceClockDST(t *testing.T) {
+	oslo, err := time.LoadLocation("Europe/Oslo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := NewPacer(PaceClock, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The recording spans the night the clocks were set back, and the replay
+	// the night they are set forward
+	p.first = time.Date(2013, 10, 26, 23, 0, 0, 0, oslo)
+	p.start = time.Date(2026, 3, 28, 23, 0, 0, 0, oslo)
+
+	event := time.Date(2013, 10, 27, 4, 0, 0, 0, oslo)
+	want := time.Date(2026, 3, 29, 4, 0, 0, 0, oslo)
+	if due := p.Due(event); !due.Equal(want) {
+		t.Errorf("Due(%v) => %v, want %v", event, due, want)
+	}
+}
+
+var pacertests = []struct {
+	mode  string
+	speed float64
+	after time.Duration
+	due   time.Duration
+}{
+	{PaceSpeed, 1, 10 * time.Minute, 10 * time.Minute},
+	{PaceSpeed, 60, 10 * time.Minute, 10 * time.Second},
+	{PaceSpeed, 0.5, time.Minute, 2 * time.Minute},
+	{PaceSpeed, 60, 0, 0},
+	{PaceFast, 0, 10 * time.Hour, 0},
+}
+
+// TestPacerDue checks when events after the first one are due, relative to the
+// time the first one was replayed
+func TestPacerDue(t *testing.T) {
+	first := time.Date(2013, 7, 20, 21, 0, 0, 0, time.UTC)
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	for _, tt := range pacertests {
+		p, err := NewPacer(tt.mode, tt.speed)
+		if err != nil {
+			t.Fatalf("NewPacer(%v, %v) => %v", tt.mode, tt.speed, err)
+		}
+		p.first, p.start = first, start
+
+		if due := p.Due(first.Add(tt.after)); !due.Equal(start.Add(tt.due)) {
+			t.Errorf("%v at %v: Due(first + %v) => %v, want start + %v", tt.mode, tt.speed, tt.after, due, tt.due)
+		}
+	}
+}
+
+func TestPaceFastWait(t *testing.T) {
+	p, err := NewPacer(PaceFast, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first := time.Date(2013, 7, 20, 21, 0, 0, 0, time.UTC)
+	begin := time.Now()
+	for i := 0; i < 100; i++ {
+		p.Wait(first.Add(time.Duration(i) * time.Hour))
+	}
+	if elapsed := time.Since(begin); elapsed > time.Second {
+		t.Errorf("Wait() for 100 hours of events took %v with %v", elapsed, PaceFast)
+	}
+}
+
+var badpacertests = []struct {
+	mode  string
+	speed float64
+}{
+	{PaceSpeed, 0},
+	{PaceSpeed, -2},
+	{"slow", 1},
+	{"", 1},
+}
+
+func TestNewPacerErrors(t *testing.T) {
+	for _, tt := range badpacertests {
+		if _, err := NewPacer(tt.mode, tt.speed); err == nil {
+			t.Errorf("NewPacer(%q, %v) => nil error", tt.mode, tt.speed)
+		}
+	}
+}
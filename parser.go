@@ -0,0 +1,316 @@
+// +build !solution
+
+package lab7
+
+import (
+	"bytes"
+	"fmt"
+	"net/netip"
+	"sync"
+	"time"
+)
+
+// MaxChannels is the number of channel names a ChannelTable learns. Further
+// names are still parsed, but allocated for every event, so that a stream of
+// made up names cannot grow the table without bound.
+const MaxChannels = 1000
+
+// ChannelTable interns channel names, so that events on the same channel share
+// one copy of its name and parsing a known name does not allocate. It is safe
+// for concurrent use, so the parsers of several workers can share a table.
+type ChannelTable struct {
+	names map[string]string
+	mu    sync.RWMutex
+}
+
+// NewChannelTable creates a table of the given channel names and Off. Names
+// that are not in the table are added as they are seen.
+func NewChannelTable(names ...string) *ChannelTable {
+	ct := &ChannelTable{names: make(map[string]string, len(names)+1)}
+	ct.names[Off] = Off
+	for _, name := range names {
+		ct.names[name] = name
+	}
+	return ct
+}
+
+// Intern returns the channel name as a string, adding it to the table if it is
+// new
+func (ct *ChannelTable) Intern(name []byte) string {
+	ct.mu.RLock()
+	s, ok := ct.names[string(name)]
+	ct.mu.RUnlock()
+	if ok {
+		return s
+	}
+
+	s = string(name)
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	if len(ct.names) < MaxChannels {
+		ct.names[s] = s
+	}
+	return s
+}
+
+// Len returns the number of channel names in the table
+func (ct *ChannelTable) Len() int {
+	ct.mu.RLock()
+	defer ct.mu.RUnlock()
+
+	return len(ct.names)
+}
+
+// Parser parses events laid out like ZapBox 2013 from byte slices, such as
+// datagrams, into events provided by the caller. Channel names are interned in
+// a ChannelTable, and IP addresses are parsed into netip.Addr and kept with one
+// string per box, so once the channels and boxes have been seen, parsing a
+// well-formed event does not allocate.
+//
+// Events the fast path does not handle, such as malformed ones, are handed to
+// the schema, so the results and errors are those of Schema.Parse. A Parser is
+// not safe for concurrent use; give each worker its own, sharing the table.
+type Parser struct {
+	schema   *Schema
+	channels *ChannelTable
+	ips      map[netip.Addr]string
+
+	// The date of the latest event, as midnight in UTC, and the UTC offset of
+	// the time zone that day, unless the clocks were changed around it
+	day    time.Time
+	offset time.Duration
+	steady bool
+}
+
+// NewParser creates a parser for the schema, which must have the fields,
+// separators and time layout of ZapBox2013 but may have another time zone and
+// DST policy. Channel names are interned in a new table if channels is nil.
+func NewParser(s *Schema, channels *ChannelTable) (*Parser, error) {
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+	if !zapboxLayout(s) {
+		return nil, fmt.Errorf("NewParser: schema '%v' is not laid out like ZapBox 2013", s.Name)
+	}
+	if channels == nil {
+		channels = NewChannelTable()
+	}
+
+	return &Parser{
+		schema:   s,
+		channels: channels,
+		ips:      make(map[netip.Addr]string),
+	}, nil
+}
+
+// zapboxLayout reports whether the schema's events are laid out like ZapBox2013
+func zapboxLayout(s *Schema) bool {
+	z := ZapBox2013
+	return s.Separator == z.Separator && s.StatusSeparator == z.StatusSeparator &&
+		s.TimeLayout == z.TimeLayout && sameFields(s.Zap, z.Zap) && sameFields(s.Status, z.Status)
+}
+
+func sameFields(a, b []Field) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseSTBEventBytes parses an event into zap or ztat, and reports which: true
+// for a zap and false for a status change. The other struct is left as it is.
+// The event is not retained.
+func (p *Parser) ParseSTBEventBytes(event []byte, zap *ChZap, ztat *StatusChange) (bool, error) {
+	var fields [5][]byte
+	switch splitFields(event, &fields) {
+	case len(p.schema.Zap):
+		if p.parseZap(&fields, zap) {
+			return true, nil
+		}
+	case len(p.schema.Status):
+		if p.parseStatus(&fields, ztat) {
+			return false, nil
+		}
+	}
+	return p.parseSlow(event, zap, ztat)
+}
+
+// splitFields splits an event at the commas into fields without the whitespace
+// around them, and returns the number of fields, or -1 if there are too many
+func splitFields(event []byte, fields *[5][]byte) int {
+	for n := 0; n < len(fields); n++ {
+		i := bytes.IndexByte(event, ',')
+		if i < 0 {
+			fields[n] = bytes.TrimSpace(event)
+			return n + 1
+		}
+		fields[n] = bytes.TrimSpace(event[:i])
+		event = event[i+1:]
+	}
+	return -1
+}
+
+// parseZap parses the fields of a zap, and reports whether they were well-formed
+func (p *Parser) parseZap(fields *[5][]byte, zap *ChZap) bool {
+	t, ok := p.parseTime(fields[0], fields[1])
+	if !ok {
+		return false
+	}
+	addr, ip, ok := p.parseIP(fields[2])
+	if !ok || len(fields[3]) == 0 || len(fields[4]) == 0 {
+		return false
+	}
+
+	*zap = ChZap{
+		Time:     t,
+		IP:       ip,
+		Addr:     addr,
+		ToChan:   p.channels.Intern(fields[3]),
+		FromChan: p.channels.Intern(fields[4]),
+	}
+	return true
+}
+
+// parseStatus parses the fields of a status change, and reports whether they
+// were well-formed
+func (p *Parser) parseStatus(fields *[5][]byte, ztat *StatusChange) bool {
+	t, ok := p.parseTime(fields[0], fields[1])
+	if !ok {
+		return false
+	}
+	addr, ip, ok := p.parseIP(fields[2])
+	if !ok {
+		return false
+	}
+
+	i := bytes.IndexByte(fields[3], ':')
+	if i < 0 {
+		return false
+	}
+	kind, ok := statusNames[string(bytes.TrimSpace(fields[3][:i]))]
+	if !ok {
+		return false
+	}
+	v, _, ok := number(bytes.TrimSpace(fields[3][i+1:]), 1, 3, 0)
+	if !ok || v > kind.maxValue() {
+		return false
+	}
+
+	*ztat = StatusChange{Time: t, IP: ip, Addr: addr, Kind: kind, Value: v}
+	return true
+}
+
+// parseTime parses a date such as 2013/07/20 and a time such as 21:56:13, where
+// everything but the year may have one digit, in the schema's time zone
+func (p *Parser) parseTime(date, clock []byte) (time.Time, bool) {
+	y, date, ok1 := number(date, 4, 4, '/')
+	m, date, ok2 := number(date, 1, 2, '/')
+	d, _, ok3 := number(date, 1, 2, 0)
+	h, clock, ok4 := number(clock, 1, 2, ':')
+	min, clock, ok5 := number(clock, 1, 2, ':')
+	sec, _, ok6 := number(clock, 1, 2, 0)
+	if !(ok1 && ok2 && ok3 && ok4 && ok5 && ok6) {
+		return time.Time{}, false
+	}
+
+	if m < 1 || m > 12 || d < 1 || d > daysIn(y, time.Month(m)) || h > 23 || min > 59 || sec > 59 {
+		return time.Time{}, false
+	}
+
+	wall := time.Date(y, time.Month(m), d, h, min, sec, 0, time.UTC)
+	if day := time.Date(y, time.Month(m), d, 0, 0, 0, 0, time.UTC); !day.Equal(p.day) {
+		p.setDay(day)
+	}
+	if p.steady {
+		return wall.Add(-p.offset).In(p.schema.loc), true
+	}
+
+	t, err := localTime(wall, p.schema.loc, p.schema.DST)
+	return t, err == nil
+}
+
+// setDay looks up the UTC offset of the date, given as midnight in UTC. Days
+// next to a change of the clocks are left to localTime.
+func (p *Parser) setDay(day time.Time) {
+	_, before := day.Add(-24 * time.Hour).In(p.schema.loc).Zone()
+	_, after := day.Add(48 * time.Hour).In(p.schema.loc).Zone()
+
+	p.day = day
+	p.offset = time.Duration(before) * time.Second
+	p.steady = before == after
+}
+
+// daysIn returns the number of days in the month
+func daysIn(y int, m time.Month) int {
+	return time.Date(y, m+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
+
+// parseIP parses a dotted IPv4 address, and returns it along with the box's
+// copy of its string
+func (p *Parser) parseIP(b []byte) (netip.Addr, string, bool) {
+	var octets [4]byte
+	for i := range octets {
+		sep := byte('.')
+		if i == len(octets)-1 {
+			sep = 0
+		}
+
+		// Like netip.ParseAddr, leading zeros are not accepted
+		v, rest, ok := number(b, 1, 3, sep)
+		if !ok || v > 255 || (b[0] == '0' && len(b) > 1 && '0' <= b[1] && b[1] <= '9') {
+			return netip.Addr{}, "", false
+		}
+		octets[i] = byte(v)
+		b = rest
+	}
+
+	addr := netip.AddrFrom4(octets)
+	ip, ok := p.ips[addr]
+	if !ok {
+		ip = addr.String()
+		p.ips[addr] = ip
+	}
+	return addr, ip, true
+}
+
+// number parses a decimal number of min to max digits at the start of b, which
+// must be followed by sep, or by the end of b if sep is 0. It returns the
+// number and the rest of b after sep.
+func number(b []byte, min, max int, sep byte) (int, []byte, bool) {
+	var v, i int
+	for i < len(b) && i < max && '0' <= b[i] && b[i] <= '9' {
+		v = v*10 + int(b[i]-'0')
+		i++
+	}
+	if i < min {
+		return 0, nil, false
+	}
+
+	if sep == 0 {
+		return v, nil, i == len(b)
+	}
+	if i == len(b) || b[i] != sep {
+		return 0, nil, false
+	}
+	return v, b[i+1:], true
+}
+
+// parseSlow parses the event with the schema, for the events the fast path does
+// not handle
+func (p *Parser) parseSlow(event []byte, zap *ChZap, ztat *StatusChange) (bool, error) {
+	z, s, err := p.schema.Parse(string(event))
+	if err != nil {
+		return false, err
+	}
+	if z != nil {
+		*zap = *z
+		return true, nil
+	}
+	*ztat = *s
+	return false, nil
+}
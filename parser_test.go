@@ -0,0 +1,219 @@
+package lab7
+
+import (
+	"bufio"
+	"os"
+	"testing"
+	"time"
+)
+
+// TestParserMatchesSchema checks that the parser gives the results and errors
+// of the schema for every event in testdata/zapbox2013.txt
+func TestParserMatchesSchema(t *testing.T) {
+	f, err := os.Open("testdata/zapbox2013.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	p, err := NewParser(ZapBox2013, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		event := sc.Text()
+		wantZap, wantStatus, wantErr := ZapBox2013.Parse(event)
+
+		var zap ChZap
+		var ztat StatusChange
+		isZap, err := p.ParseSTBEventBytes([]byte(event), &zap, &ztat)
+
+		switch {
+		case wantErr != nil:
+			if err == nil || err.Error() != wantErr.Error() {
+				t.Errorf("ParseSTBEventBytes(%q) => %v, want %v", event, err, wantErr)
+			}
+		case err != nil:
+			t.Errorf("ParseSTBEventBytes(%q) => %v", event, err)
+		case wantZap != nil:
+			if !isZap || !zap.Time.Equal(wantZap.Time) || zap.IP != wantZap.IP || zap.Addr != wantZap.Addr ||
+				zap.ToChan != wantZap.ToChan || zap.FromChan != wantZap.FromChan {
+				t.Errorf("ParseSTBEventBytes(%q) => zap %v (%v), want %v", event, zap, isZap, *wantZap)
+			}
+		default:
+			if isZap || !ztat.Time.Equal(wantStatus.Time) || ztat.IP != wantStatus.IP || ztat.Addr != wantStatus.Addr ||
+				ztat.Kind != wantStatus.Kind || ztat.Value != wantStatus.Value {
+				t.Errorf("ParseSTBEventBytes(%q) => status %v (%v), want %v", event, ztat, isZap, *wantStatus)
+			}
+		}
+	}
+}
+
+var parsertests = []struct {
+	event string
+	ip    string
+}{
+	// Addresses that are not in canonical form take the schema's path
+	{"2013/07/20, 21:56:13, 010.0.0.1, NRK1, NRK2", "010.0.0.1"},
+	{"2013/07/20, 21:56:13, 10.0.0.00, NRK1, NRK2", "10.0.0.00"},
+	{"2013/07/20, 21:56:13, box-17, NRK1, NRK2", "box-17"},
+	{"2013/07/20, 21:56:13, 0.0.0.0, NRK1, NRK2", "0.0.0.0"},
+	{"2013/07/20, 21:57:42, 255.255.255.255, Volume: 007", "255.255.255.255"},
+	{"2013/07/20, 21:57:42, 10.0.0.1, Volume: +7", "10.0.0.1"},
+}
+
+func TestParserFallback(t *testing.T) {
+	p, err := NewParser(ZapBox2013, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range parsertests {
+		var zap ChZap
+		var ztat StatusChange
+		isZap, err := p.ParseSTBEventBytes([]byte(tt.event), &zap, &ztat)
+		if err != nil {
+			t.Errorf("ParseSTBEventBytes(%q) => %v", tt.event, err)
+			continue
+		}
+		if ip := ztat.IP; isZap {
+			if zap.IP != tt.ip {
+				t.Errorf("ParseSTBEventBytes(%q) => IP %q, want %q", tt.event, zap.IP, tt.ip)
+			}
+		} else if ip != tt.ip {
+			t.Errorf("ParseSTBEventBytes(%q) => IP %q, want %q", tt.event, ip, tt.ip)
+		}
+	}
+}
+
+// TestParserDST checks that the parser resolves local times around changes of
+// the clocks like the schema, whichever day it parsed before
+func TestParserDST(t *testing.T) {
+	for _, tt := range dsttests {
+		s := ZapBox2013.In(ZapBox2013.Location())
+		s.DST = tt.policy
+		p, err := NewParser(s, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, before := range []string{"2013/07/20, 21:56:13, 10.0.0.1, NRK1, NRK2", tt.event} {
+			var zap ChZap
+			var ztat StatusChange
+			p.ParseSTBEventBytes([]byte(before), &zap, &ztat)
+			_, err := p.ParseSTBEventBytes([]byte(tt.event), &zap, &ztat)
+
+			if tt.want == "" {
+				if err == nil {
+					t.Errorf("%v with %q after %v: ParseSTBEventBytes() => %v, want error", tt.event, tt.policy, before, zap.Time)
+				}
+			} else if got := zap.Time.UTC().Format(time.RFC3339); err != nil || got != tt.want {
+				t.Errorf("%v with %q after %v: ParseSTBEventBytes() => %v, %v, want %v", tt.event, tt.policy, before, got, err, tt.want)
+			}
+		}
+	}
+}
+
+func TestParserAllocs(t *testing.T) {
+	p, err := NewParser(ZapBox2013, NewChannelTable("NRK1", "TV2 Norge"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	zapEvent := []byte("2013/07/20, 21:56:13, 252.126.91.56, NRK1, TV2 Norge")
+	statusEvent := []byte("2013/07/20, 21:57:42, 252.126.91.56, Volume: 50")
+
+	var zap ChZap
+	var ztat StatusChange
+	allocs := testing.AllocsPerRun(100, func() {
+		p.ParseSTBEventBytes(zapEvent, &zap, &ztat)
+		p.ParseSTBEventBytes(statusEvent, &zap, &ztat)
+	})
+	if allocs != 0 {
+		t.Errorf("ParseSTBEventBytes allocates %v times per run, want 0", allocs)
+	}
+	if zap.ToChan != "NRK1" || ztat.Value != 50 {
+		t.Errorf("ParseSTBEventBytes => %v and %v", zap, ztat)
+	}
+}
+
+func TestChannelTable(t *testing.T) {
+	ct := NewChannelTable("NRK1")
+	if ct.Len() != 2 {
+		t.Errorf("Len() => %v, want NRK1 and OFF", ct.Len())
+	}
+
+	for i := 0; i < 2*MaxChannels; i++ {
+		ct.Intern([]byte{'C', byte(i >> 8), byte(i)})
+	}
+	if ct.Len() != MaxChannels {
+		t.Errorf("Len() => %v after many channels, want %v", ct.Len(), MaxChannels)
+	}
+	if name := ct.Intern([]byte("NRK1")); name != "NRK1" {
+		t.Errorf("Intern(NRK1) => %q", name)
+	}
+}
+
+func TestNewParser(t *testing.T) {
+	s := ZapBox2013.In(ZapBox2013.Location())
+	s.DST = DSTReject
+	if _, err := NewParser(s, nil); err != nil {
+		t.Errorf("NewParser(ZapBox2013 with DSTReject) => %v", err)
+	}
+
+	other := &Schema{Name: "other", Separator: ";", StatusSeparator: ":",
+		Zap: ZapBox2013.Zap, Status: ZapBox2013.Status, TimeLayout: ZapBox2013.TimeLayout}
+	if _, err := NewParser(other, nil); err == nil {
+		t.Error("NewParser(schema separated by ;) => nil error")
+	}
+}
+
+// benchEvents are typical events, mostly zaps
+var benchEvents = []string{
+	"2013/07/20, 21:56:13, 252.126.91.56, NRK1, TV2 Norge",
+	"2013/07/20, 21:56:14, 10.0.0.1, TV2 Norge, NRK1",
+	"2013/07/20, 21:56:15, 10.200.8.24, NRK 3, Disney XD",
+	"2013/07/20, 21:56:16, 111.229.208.129, MAX, Viasat 4",
+	"2013/07/20, 21:57:42, 203.124.29.72, Volume: 50",
+	"2013/07/20, 21:57:43, 203.124.29.72, Mute_Status: 1",
+}
+
+// BenchmarkNewSTBEvent includes converting the datagram to a string, like the
+// ingester does
+func BenchmarkNewSTBEvent(b *testing.B) {
+	datagrams := make([][]byte, len(benchEvents))
+	for i, event := range benchEvents {
+		datagrams[i] = []byte(event)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, _, err := NewSTBEvent(string(datagrams[i%len(datagrams)])); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkParseSTBEventBytes(b *testing.B) {
+	datagrams := make([][]byte, len(benchEvents))
+	for i, event := range benchEvents {
+		datagrams[i] = []byte(event)
+	}
+	p, err := NewParser(ZapBox2013, nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	var zap ChZap
+	var ztat StatusChange
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := p.ParseSTBEventBytes(datagrams[i%len(datagrams)], &zap, &ztat); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -42,6 +42,9 @@ const (
 	SubscribeMessage_VIEWERCOUNT  SubscribeMessage_Statistics = 1
 	SubscribeMessage_AVGDURATIONS SubscribeMessage_Statistics = 2
 	SubscribeMessage_SAMPLESIZE   SubscribeMessage_Statistics = 3
+	SubscribeMessage_DISTRIBUTION SubscribeMessage_Statistics = 4
+	SubscribeMessage_MUTED        SubscribeMessage_Statistics = 5
+	SubscribeMessage_VOLUME       SubscribeMessage_Statistics = 6
 )
 
 var SubscribeMessage_Statistics_name = map[int32]string{
@@ -49,12 +52,18 @@ var SubscribeMessage_Statistics_name = map[int32]string{
 	1: "VIEWERCOUNT",
 	2: "AVGDURATIONS",
 	3: "SAMPLESIZE",
+	4: "DISTRIBUTION",
+	5: "MUTED",
+	6: "VOLUME",
 }
 var SubscribeMessage_Statistics_value = map[string]int32{
 	"SUMMARY":      0,
 	"VIEWERCOUNT":  1,
 	"AVGDURATIONS": 2,
 	"SAMPLESIZE":   3,
+	"DISTRIBUTION": 4,
+	"MUTED":        5,
+	"VOLUME":       6,
 }
 
 func (x SubscribeMessage_Statistics) String() string {
@@ -91,6 +100,9 @@ func (m *SubscribeMessage) GetStatistics() SubscribeMessage_Statistics {
 type NotificationMessage struct {
 	Status string                       `protobuf:"bytes,1,opt,name=status" json:"status,omitempty"`
 	Top10  []*NotificationMessage_Top10 `protobuf:"bytes,2,rep,name=top10" json:"top10,omitempty"`
+	// Estimated share of the audience that the viewer counts are based on, from
+	// 0 right after the server started towards 1 once it has seen most boxes
+	Coverage float64 `protobuf:"fixed64,3,opt,name=coverage" json:"coverage,omitempty"`
 }
 
 func (m *NotificationMessage) Reset()                    { *m = NotificationMessage{} }
@@ -112,14 +124,45 @@ func (m *NotificationMessage) GetTop10() []*NotificationMessage_Top10 {
 	return nil
 }
 
+func (m *NotificationMessage) GetCoverage() float64 {
+	if m != nil {
+		return m.Coverage
+	}
+	return 0
+}
+
 type NotificationMessage_Top10 struct {
 	ChannelName string `protobuf:"bytes,1,opt,name=channelName" json:"channelName,omitempty"`
 	Viewcount   uint32 `protobuf:"varint,2,opt,name=viewcount" json:"viewcount,omitempty"`
 	// Could also return duration as a scalar (seconds, nanoseconds)
 	AvgDuration string `protobuf:"bytes,3,opt,name=avgDuration" json:"avgDuration,omitempty"`
-	// Could return the whole log of zaps if the client wanted to calculate eg. variance and st. deviation, but
-	// would be very expensive.
-	SampleSize uint32 `protobuf:"varint,4,opt,name=sampleSize" json:"sampleSize,omitempty"`
+	SampleSize  uint32 `protobuf:"varint,4,opt,name=sampleSize" json:"sampleSize,omitempty"`
+	// Distribution of the viewing durations. The server computes these as zaps arrive, so
+	// clients do not need the whole log of zaps. Variance is in seconds squared.
+	StdDeviation string  `protobuf:"bytes,5,opt,name=stdDeviation" json:"stdDeviation,omitempty"`
+	Variance     float64 `protobuf:"fixed64,6,opt,name=variance" json:"variance,omitempty"`
+	MinDuration  string  `protobuf:"bytes,7,opt,name=minDuration" json:"minDuration,omitempty"`
+	MaxDuration  string  `protobuf:"bytes,8,opt,name=maxDuration" json:"maxDuration,omitempty"`
+	// Percentiles estimated by the server, accurate to within 1%
+	P50Duration string `protobuf:"bytes,9,opt,name=p50Duration" json:"p50Duration,omitempty"`
+	P90Duration string `protobuf:"bytes,10,opt,name=p90Duration" json:"p90Duration,omitempty"`
+	P99Duration string `protobuf:"bytes,11,opt,name=p99Duration" json:"p99Duration,omitempty"`
+	// Muted time per viewer, and the number of muted viewers now and at the
+	// time of day the channel had the most
+	AvgMuted      string `protobuf:"bytes,12,opt,name=avgMuted" json:"avgMuted,omitempty"`
+	MutedViewers  uint32 `protobuf:"varint,13,opt,name=mutedViewers" json:"mutedViewers,omitempty"`
+	PeakMuted     uint32 `protobuf:"varint,14,opt,name=peakMuted" json:"peakMuted,omitempty"`
+	PeakMutedTime string `protobuf:"bytes,15,opt,name=peakMutedTime" json:"peakMutedTime,omitempty"`
+	// Viewers that have their TV turned on, out of the viewcount tuned to the
+	// channel
+	Watching uint32 `protobuf:"varint,16,opt,name=watching" json:"watching,omitempty"`
+	// Volume of the current viewers: the average, the number of viewers in
+	// each range of ten volume levels from 0-9 up, and the number of times many
+	// viewers turned the volume up at once along with the time of the latest
+	AvgVolume       float64  `protobuf:"fixed64,17,opt,name=avgVolume" json:"avgVolume,omitempty"`
+	VolumeHistogram []uint32 `protobuf:"varint,18,rep,packed,name=volumeHistogram" json:"volumeHistogram,omitempty"`
+	VolumeJumps     uint32   `protobuf:"varint,19,opt,name=volumeJumps" json:"volumeJumps,omitempty"`
+	LastVolumeJump  string   `protobuf:"bytes,20,opt,name=lastVolumeJump" json:"lastVolumeJump,omitempty"`
 }
 
 func (m *NotificationMessage_Top10) Reset()                    { *m = NotificationMessage_Top10{} }
@@ -155,6 +198,118 @@ func (m *NotificationMessage_Top10) GetSampleSize() uint32 {
 	return 0
 }
 
+func (m *NotificationMessage_Top10) GetStdDeviation() string {
+	if m != nil {
+		return m.StdDeviation
+	}
+	return ""
+}
+
+func (m *NotificationMessage_Top10) GetVariance() float64 {
+	if m != nil {
+		return m.Variance
+	}
+	return 0
+}
+
+func (m *NotificationMessage_Top10) GetMinDuration() string {
+	if m != nil {
+		return m.MinDuration
+	}
+	return ""
+}
+
+func (m *NotificationMessage_Top10) GetMaxDuration() string {
+	if m != nil {
+		return m.MaxDuration
+	}
+	return ""
+}
+
+func (m *NotificationMessage_Top10) GetP50Duration() string {
+	if m != nil {
+		return m.P50Duration
+	}
+	return ""
+}
+
+func (m *NotificationMessage_Top10) GetP90Duration() string {
+	if m != nil {
+		return m.P90Duration
+	}
+	return ""
+}
+
+func (m *NotificationMessage_Top10) GetP99Duration() string {
+	if m != nil {
+		return m.P99Duration
+	}
+	return ""
+}
+
+func (m *NotificationMessage_Top10) GetAvgMuted() string {
+	if m != nil {
+		return m.AvgMuted
+	}
+	return ""
+}
+
+func (m *NotificationMessage_Top10) GetMutedViewers() uint32 {
+	if m != nil {
+		return m.MutedViewers
+	}
+	return 0
+}
+
+func (m *NotificationMessage_Top10) GetPeakMuted() uint32 {
+	if m != nil {
+		return m.PeakMuted
+	}
+	return 0
+}
+
+func (m *NotificationMessage_Top10) GetPeakMutedTime() string {
+	if m != nil {
+		return m.PeakMutedTime
+	}
+	return ""
+}
+
+func (m *NotificationMessage_Top10) GetWatching() uint32 {
+	if m != nil {
+		return m.Watching
+	}
+	return 0
+}
+
+func (m *NotificationMessage_Top10) GetAvgVolume() float64 {
+	if m != nil {
+		return m.AvgVolume
+	}
+	return 0
+}
+
+func (m *NotificationMessage_Top10) GetVolumeHistogram() []uint32 {
+	if m != nil {
+		return m.VolumeHistogram
+	}
+	return nil
+}
+
+func (m *NotificationMessage_Top10) GetVolumeJumps() uint32 {
+	if m != nil {
+		return m.VolumeJumps
+	}
+	return 0
+}
+
+func (m *NotificationMessage_Top10) GetLastVolumeJump() string {
+	if m != nil {
+		return m.LastVolumeJump
+	}
+	return ""
+}
+
 func init() {
 	proto1.RegisterType((*SubscribeMessage)(nil), "proto.SubscribeMessage")
 	proto1.RegisterType((*NotificationMessage)(nil), "proto.NotificationMessage")
@@ -269,28 +424,43 @@ var _Subscription_serviceDesc = grpc.ServiceDesc{
 func init() { proto1.RegisterFile("subscribe.proto", fileDescriptor0) }
 
 var fileDescriptor0 = []byte{
-	// 353 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x74, 0x91, 0xdf, 0x6a, 0xe2, 0x40,
-	0x14, 0xc6, 0x1d, 0x5d, 0x5d, 0x3c, 0xf1, 0x4f, 0x98, 0x85, 0xdd, 0x20, 0xcb, 0x12, 0x72, 0x95,
-	0xab, 0xe0, 0xba, 0xb0, 0xf7, 0xd9, 0x35, 0x2d, 0x82, 0x89, 0x65, 0xa2, 0x96, 0xf6, 0x6e, 0x0c,
-	0xa3, 0x0e, 0x68, 0x12, 0x32, 0x13, 0x0b, 0x7d, 0x83, 0xbe, 0x58, 0xdf, 0xa7, 0x6f, 0x50, 0x32,
-	0x46, 0x0d, 0xa5, 0x5e, 0x0d, 0xf3, 0x3b, 0xdf, 0xf9, 0xce, 0x9c, 0x6f, 0xa0, 0x2f, 0xf2, 0x95,
-	0x88, 0x32, 0xbe, 0x62, 0x4e, 0x9a, 0x25, 0x32, 0xc1, 0x4d, 0x75, 0x58, 0xaf, 0x08, 0xf4, 0xf0,
-	0x54, 0xf2, 0x99, 0x10, 0x74, 0xc3, 0xb0, 0x09, 0x1a, 0x61, 0xeb, 0x8c, 0x89, 0x2d, 0xa1, 0x92,
-	0x19, 0xc8, 0x44, 0x76, 0x97, 0x54, 0x11, 0xfe, 0x07, 0x20, 0x24, 0x95, 0x5c, 0x48, 0x1e, 0x09,
-	0xa3, 0x6e, 0x22, 0xbb, 0x37, 0xb2, 0x8e, 0xce, 0xce, 0x47, 0x3b, 0x27, 0x3c, 0x2b, 0x49, 0xa5,
-	0xcb, 0x9a, 0x02, 0x5c, 0x2a, 0x58, 0x83, 0xaf, 0xe1, 0xc2, 0xf7, 0x5d, 0xf2, 0xa0, 0xd7, 0x70,
-	0x1f, 0xb4, 0xe5, 0xc4, 0xbb, 0xf7, 0xc8, 0xff, 0xd9, 0x22, 0x98, 0xeb, 0x08, 0xeb, 0xd0, 0x71,
-	0x97, 0xb7, 0xe3, 0x05, 0x71, 0xe7, 0x93, 0x59, 0x10, 0xea, 0x75, 0xdc, 0x03, 0x08, 0x5d, 0xff,
-	0x6e, 0xea, 0x85, 0x93, 0x47, 0x4f, 0x6f, 0x58, 0x6f, 0x08, 0xbe, 0x05, 0x89, 0xe4, 0x6b, 0x1e,
-	0x51, 0xc9, 0x93, 0xf8, 0xb4, 0xcb, 0x77, 0x68, 0x15, 0x33, 0x73, 0xa1, 0xd6, 0x68, 0x93, 0xf2,
-	0x86, 0xff, 0x42, 0x53, 0x26, 0xe9, 0xef, 0xa1, 0x51, 0x37, 0x1b, 0xb6, 0x36, 0x32, 0xcb, 0xc7,
-	0x7f, 0x62, 0xe1, 0xcc, 0x0b, 0x1d, 0x39, 0xca, 0x07, 0x2f, 0x08, 0x9a, 0x0a, 0x14, 0x29, 0x45,
-	0x5b, 0x1a, 0xc7, 0x6c, 0x17, 0xd0, 0x3d, 0x2b, 0xed, 0xab, 0x08, 0xff, 0x84, 0xf6, 0x81, 0xb3,
-	0xa7, 0x28, 0xc9, 0x63, 0xa9, 0x42, 0xea, 0x92, 0x0b, 0x28, 0xfa, 0xe9, 0x61, 0x33, 0xce, 0x33,
-	0x35, 0xcc, 0x68, 0x1c, 0xfb, 0x2b, 0x08, 0xff, 0x02, 0x10, 0x74, 0x9f, 0xee, 0x58, 0xc8, 0x9f,
-	0x99, 0xf1, 0x45, 0x19, 0x54, 0xc8, 0x68, 0x09, 0x9d, 0x32, 0xec, 0x54, 0xe9, 0x6f, 0xa0, 0x7d,
-	0x0e, 0x1f, 0xff, 0xb8, 0xf2, 0x1d, 0x83, 0xc1, 0xf5, 0x55, 0xad, 0x9a, 0x8d, 0x86, 0x68, 0xd5,
-	0x52, 0x82, 0x3f, 0xef, 0x01, 0x00, 0x00, 0xff, 0xff, 0xcb, 0x0e, 0x46, 0x36, 0x35, 0x02, 0x00,
-	0x00,
+	// 597 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x74, 0x93, 0x5f, 0x6f, 0xd3, 0x30,
+	0x10, 0xc0, 0x97, 0x75, 0xe9, 0xd6, 0xeb, 0xbf, 0xe0, 0x21, 0xb0, 0x2a, 0x84, 0xa2, 0x0a, 0xa1,
+	0x3c, 0x55, 0x63, 0x08, 0xa4, 0x3d, 0x76, 0xb4, 0x40, 0xd1, 0xd2, 0x21, 0xa7, 0x0d, 0x82, 0x37,
+	0x2f, 0xf3, 0x32, 0x8b, 0xe6, 0x8f, 0x62, 0x27, 0x9b, 0xf8, 0x3e, 0x3c, 0xf0, 0xe9, 0xf8, 0x0a,
+	0xc8, 0x4e, 0x9b, 0x66, 0x15, 0x7b, 0x4a, 0xee, 0xe7, 0x5f, 0xce, 0x77, 0x17, 0x1d, 0xf4, 0x45,
+	0x7e, 0x25, 0x82, 0x8c, 0x5f, 0xb1, 0x51, 0x9a, 0x25, 0x32, 0x41, 0xa6, 0x7e, 0x0c, 0xff, 0x1a,
+	0x60, 0x79, 0x9b, 0x23, 0x97, 0x09, 0x41, 0x43, 0x86, 0x6c, 0x68, 0x13, 0x76, 0x93, 0x31, 0x71,
+	0x4b, 0xa8, 0x64, 0xd8, 0xb0, 0x0d, 0xa7, 0x4b, 0xea, 0x08, 0x9d, 0x03, 0x08, 0x49, 0x25, 0x17,
+	0x92, 0x07, 0x02, 0xef, 0xdb, 0x86, 0xd3, 0x3b, 0x1d, 0x96, 0x99, 0x47, 0xbb, 0xe9, 0x46, 0x5e,
+	0x65, 0x92, 0xda, 0x57, 0xc3, 0x1c, 0x60, 0x7b, 0x82, 0xda, 0x70, 0xe8, 0x2d, 0x5d, 0x77, 0x4c,
+	0xbe, 0x5b, 0x7b, 0xa8, 0x0f, 0x6d, 0x7f, 0x36, 0xfd, 0x36, 0x25, 0x1f, 0x2e, 0x97, 0xf3, 0x85,
+	0x65, 0x20, 0x0b, 0x3a, 0x63, 0xff, 0xd3, 0x64, 0x49, 0xc6, 0x8b, 0xd9, 0xe5, 0xdc, 0xb3, 0xf6,
+	0x51, 0x0f, 0xc0, 0x1b, 0xbb, 0x5f, 0x2f, 0xa6, 0xde, 0xec, 0xc7, 0xd4, 0x6a, 0x28, 0x63, 0x32,
+	0xf3, 0x16, 0x64, 0x76, 0xbe, 0x54, 0x8a, 0x75, 0x80, 0x5a, 0x60, 0xba, 0xcb, 0xc5, 0x74, 0x62,
+	0x99, 0x08, 0xa0, 0xe9, 0x5f, 0x5e, 0x2c, 0xdd, 0xa9, 0xd5, 0x1c, 0xfe, 0x69, 0xc2, 0xf1, 0x3c,
+	0x91, 0xfc, 0x86, 0x07, 0x54, 0xf2, 0x24, 0xde, 0x34, 0xfd, 0x0c, 0x9a, 0xaa, 0xb8, 0x5c, 0xe8,
+	0x7e, 0x5b, 0x64, 0x1d, 0xa1, 0xf7, 0x60, 0xca, 0x24, 0x7d, 0x73, 0x82, 0xf7, 0xed, 0x86, 0xd3,
+	0x3e, 0xb5, 0xd7, 0x5d, 0xfe, 0x27, 0xc5, 0x68, 0xa1, 0x3c, 0x52, 0xea, 0x68, 0x00, 0x47, 0x41,
+	0x52, 0xb0, 0x8c, 0x86, 0x0c, 0x37, 0x6c, 0xc3, 0x31, 0x48, 0x15, 0x0f, 0x7e, 0x9b, 0x60, 0x6a,
+	0x59, 0x8d, 0x3a, 0xb8, 0xa5, 0x71, 0xcc, 0x56, 0x73, 0x1a, 0xb1, 0xf5, 0xd5, 0x75, 0x84, 0x5e,
+	0x40, 0xab, 0xe0, 0xec, 0x2e, 0x48, 0xf2, 0x58, 0xea, 0x49, 0x77, 0xc9, 0x16, 0xa8, 0xef, 0x69,
+	0x11, 0x4e, 0xf2, 0x4c, 0x17, 0xa2, 0x2f, 0x6a, 0x91, 0x3a, 0x42, 0x2f, 0x01, 0x04, 0x8d, 0xd2,
+	0x15, 0xf3, 0xf8, 0x2f, 0x86, 0x0f, 0x74, 0x82, 0x1a, 0x41, 0x43, 0xe8, 0x08, 0x79, 0x3d, 0x61,
+	0x05, 0x2f, 0x53, 0x98, 0x3a, 0xc5, 0x03, 0xa6, 0x7a, 0x29, 0x68, 0xc6, 0x69, 0x1c, 0x30, 0xdc,
+	0x2c, 0x7b, 0xd9, 0xc4, 0xaa, 0x82, 0x88, 0xc7, 0x55, 0x05, 0x87, 0x65, 0x05, 0x35, 0xa4, 0x0d,
+	0x7a, 0x5f, 0x19, 0x47, 0x6b, 0x83, 0xde, 0xd7, 0x8d, 0xf4, 0xdd, 0x49, 0x65, 0xb4, 0x4a, 0xa3,
+	0x86, 0xb4, 0x71, 0xb6, 0x35, 0x60, 0x6d, 0x9c, 0xed, 0x18, 0x67, 0x95, 0xd1, 0xde, 0x18, 0x15,
+	0x52, 0x5d, 0xd0, 0x22, 0x74, 0x73, 0xc9, 0xae, 0x71, 0x47, 0x1f, 0x57, 0xb1, 0x9a, 0x42, 0xa4,
+	0x5e, 0x7c, 0xce, 0xee, 0x58, 0x26, 0x70, 0x57, 0xcf, 0xe9, 0x01, 0x53, 0x7f, 0x22, 0x65, 0xf4,
+	0x67, 0x99, 0xa0, 0x57, 0xfe, 0x89, 0x0a, 0xa0, 0x57, 0xd0, 0xad, 0x82, 0x05, 0x8f, 0x18, 0xee,
+	0xeb, 0x2b, 0x1e, 0x42, 0x55, 0xc3, 0x1d, 0x95, 0xc1, 0x2d, 0x8f, 0x43, 0x6c, 0xe9, 0x14, 0x55,
+	0xac, 0xf2, 0xd3, 0x22, 0xf4, 0x93, 0x55, 0x1e, 0x31, 0xfc, 0x44, 0x8f, 0x79, 0x0b, 0x90, 0x03,
+	0xfd, 0x42, 0xbf, 0x7d, 0xe6, 0x42, 0x26, 0x61, 0x46, 0x23, 0x8c, 0xec, 0x86, 0xd3, 0x25, 0xbb,
+	0x58, 0x4d, 0xa2, 0x44, 0x5f, 0xf2, 0x28, 0x15, 0xf8, 0xb8, 0x5c, 0xdf, 0x1a, 0x42, 0xaf, 0xa1,
+	0xb7, 0xa2, 0x42, 0xfa, 0x15, 0xc2, 0x4f, 0x75, 0xb1, 0x3b, 0xf4, 0xd4, 0x87, 0xce, 0x7a, 0x9b,
+	0x53, 0x3d, 0xc1, 0x8f, 0xd0, 0xaa, 0xb6, 0x1b, 0x3d, 0x7f, 0x64, 0xdf, 0x07, 0x83, 0xc7, 0x57,
+	0x64, 0xb8, 0xe7, 0x18, 0x27, 0xc6, 0x55, 0x53, 0x0b, 0x6f, 0xff, 0x0d, 0x00, 0x32, 0xda, 0x74,
+	0x16, 0x96, 0x04, 0x00, 0x00,
 }
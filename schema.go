@@ -0,0 +1,506 @@
+// +build !solution
+
+package lab7
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	// The schemas' time zones are available without a zoneinfo database
+	_ "time/tzdata"
+)
+
+// Field identifies what a field of an event holds
+type Field uint8
+
+// The fields of an event. A timestamp may span several fields, such as a date
+// and a time, which are joined by a space before parsing. Skipped fields hold
+// anything else a firmware sends.
+const (
+	FieldSkip Field = iota
+	FieldTimestamp
+	FieldIP
+	FieldToChan
+	FieldFromChan
+	FieldStatus
+)
+
+// fieldNames are the names of the fields in schema files
+var fieldNames = map[Field]string{
+	FieldSkip:      "skip",
+	FieldTimestamp: "timestamp",
+	FieldIP:        "ip",
+	FieldToChan:    "to",
+	FieldFromChan:  "from",
+	FieldStatus:    "status",
+}
+
+func (f Field) String() string {
+	if name, ok := fieldNames[f]; ok {
+		return name
+	}
+	return fmt.Sprintf("Field(%d)", uint8(f))
+}
+
+// MarshalText returns the name of the field
+func (f Field) MarshalText() ([]byte, error) {
+	if _, ok := fieldNames[f]; !ok {
+		return nil, fmt.Errorf("unknown field %d", uint8(f))
+	}
+	return []byte(f.String()), nil
+}
+
+// UnmarshalText sets the field from its name
+func (f *Field) UnmarshalText(text []byte) error {
+	for field, name := range fieldNames {
+		if name == string(text) {
+			*f = field
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown field '%s'", text)
+}
+
+// DSTPolicy decides how local timestamps that are ambiguous or do not exist,
+// because of a daylight saving time transition, are parsed
+type DSTPolicy string
+
+// The DST policies. When the clocks are set back, the hour before the change
+// happens twice: DSTEarlier takes such times to be the first occurrence, and
+// DSTLater the second. When the clocks are set forward, the skipped times are
+// moved forward by the length of the gap with either policy, as if the clocks
+// had not been changed yet. DSTReject rejects both kinds of times.
+const (
+	DSTEarlier DSTPolicy = "earlier"
+	DSTLater   DSTPolicy = "later"
+	DSTReject  DSTPolicy = "reject"
+)
+
+// Schema describes the format of the events sent by a set-top box firmware.
+// Zaps and status changes are told apart by their number of fields, so Zap
+// and Status must have different lengths. Whitespace around fields is ignored,
+// so fields may be padded or not.
+//
+// Timestamps are the broadcaster's local time, and parsed times are in the
+// schema's Location, so that their Date and time of day are those of the
+// broadcaster. A layout with a time zone offset is parsed as it is.
+//
+// A Schema is safe for concurrent use once it has been validated, which Parse
+// does on first use.
+type Schema struct {
+	Name string
+	// Separator separates the fields of an event
+	Separator string
+	// StatusSeparator separates the name and value of a status, as in "Volume: 50"
+	StatusSeparator string
+
+	// Zap and Status list the fields of the two kinds of events in order
+	Zap    []Field
+	Status []Field
+
+	// TimeLayout is the time.Parse layout of the timestamp fields joined by a
+	// space. TimeZone is the IANA name of the time zone of the timestamps, or
+	// empty for UTC. DST is the DSTPolicy, by default DSTEarlier.
+	TimeLayout string
+	TimeZone   string    `json:",omitempty"`
+	DST        DSTPolicy `json:",omitempty"`
+
+	once  sync.Once
+	loc   *time.Location
+	zoned bool
+	err   error
+}
+
+// ZapBox2013 is the event format of the set-top boxes in the 2013 ZapBox
+// dataset, as specified in the assignment. Zaps hold the new channel before the
+// previous one:
+//
+//	2013/07/20, 21:56:13, 252.126.91.56, NRK1, TV2 Norge
+//	2013/07/20, 21:57:42, 203.124.29.72, Volume: 50
+//
+// Single-digit dates and times are accepted as well. Timestamps are Norwegian
+// local time.
+var ZapBox2013 = &Schema{
+	Name:            "ZapBox 2013",
+	Separator:       ",",
+	StatusSeparator: ":",
+	Zap:             []Field{FieldTimestamp, FieldTimestamp, FieldIP, FieldToChan, FieldFromChan},
+	Status:          []Field{FieldTimestamp, FieldTimestamp, FieldIP, FieldStatus},
+	TimeLayout:      "2006/1/2 15:4:5",
+	TimeZone:        "Europe/Oslo",
+}
+
+// Schemas are the built-in schemas by name, for selecting one by configuration
+var Schemas = map[string]*Schema{
+	"zapbox2013": ZapBox2013,
+}
+
+// LookupSchema returns the built-in schema of the given name, or else loads the
+// schema from the JSON file of that name
+func LookupSchema(name string) (*Schema, error) {
+	if s, ok := Schemas[name]; ok {
+		return s, nil
+	}
+
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("LookupSchema: '%v' is neither a built-in schema nor a schema file: %v", name, err)
+	}
+	defer f.Close()
+
+	return LoadSchema(f)
+}
+
+// In returns a copy of the schema that parses timestamps in the given time
+// zone, such as one loaded with time.LoadLocation
+func (s *Schema) In(loc *time.Location) *Schema {
+	return &Schema{
+		Name:            s.Name,
+		Separator:       s.Separator,
+		StatusSeparator: s.StatusSeparator,
+		Zap:             s.Zap,
+		Status:          s.Status,
+		TimeLayout:      s.TimeLayout,
+		TimeZone:        loc.String(),
+		DST:             s.DST,
+		loc:             loc,
+	}
+}
+
+// LoadSchema reads a schema in JSON from r and validates it. Fields are given
+// by name, ie. "timestamp", "ip", "to", "from", "status" or "skip".
+func LoadSchema(r io.Reader) (*Schema, error) {
+	s := new(Schema)
+	if err := json.NewDecoder(r).Decode(s); err != nil {
+		return nil, fmt.Errorf("LoadSchema: %v", err)
+	}
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Validate checks that the schema can tell the kinds of events apart and that
+// each kind has the fields it needs
+func (s *Schema) Validate() error {
+	s.once.Do(func() { s.err = s.validate() })
+	return s.err
+}
+
+func (s *Schema) validate() error {
+	if s.Separator == "" || s.StatusSeparator == "" {
+		return fmt.Errorf("Validate: schema '%v' needs both separators", s.Name)
+	}
+	if len(s.Zap) == len(s.Status) {
+		return fmt.Errorf("Validate: schema '%v' has %v fields for both zaps and status changes", s.Name, len(s.Zap))
+	}
+	if s.TimeLayout == "" {
+		return fmt.Errorf("Validate: schema '%v' has no time layout", s.Name)
+	}
+	switch s.DST {
+	case "", DSTEarlier, DSTLater, DSTReject:
+	default:
+		return fmt.Errorf("Validate: schema '%v' has unknown DST policy '%v'", s.Name, s.DST)
+	}
+
+	if err := checkFields(s.Zap, FieldIP, FieldToChan, FieldFromChan); err != nil {
+		return fmt.Errorf("Validate: zaps of schema '%v': %v", s.Name, err)
+	}
+	if err := checkFields(s.Status, FieldIP, FieldStatus); err != nil {
+		return fmt.Errorf("Validate: status changes of schema '%v': %v", s.Name, err)
+	}
+
+	if s.loc == nil {
+		loc, err := time.LoadLocation(s.TimeZone)
+		if err != nil {
+			return fmt.Errorf("Validate: schema '%v': %v", s.Name, err)
+		}
+		s.loc = loc
+	}
+	s.zoned = layoutHasZone(s.TimeLayout)
+	return nil
+}
+
+// layoutHasZone reports whether a time layout includes a time zone, as a name
+// or an offset
+func layoutHasZone(layout string) bool {
+	return strings.Contains(layout, "MST") || strings.Contains(layout, "Z07") || strings.Contains(layout, "-07")
+}
+
+// checkFields checks that the fields include a timestamp and exactly one of
+// each of the given fields, and no other fields
+func checkFields(fields []Field, want ...Field) error {
+	count := make(map[Field]int)
+	for _, f := range fields {
+		if _, ok := fieldNames[f]; !ok {
+			return fmt.Errorf("unknown field %d", uint8(f))
+		}
+		count[f]++
+	}
+
+	if count[FieldTimestamp] == 0 {
+		return fmt.Errorf("no timestamp")
+	}
+	for _, f := range want {
+		if count[f] != 1 {
+			return fmt.Errorf("%v %v fields, want 1", count[f], f)
+		}
+		delete(count, f)
+	}
+	delete(count, FieldTimestamp)
+	delete(count, FieldSkip)
+
+	for f := range count {
+		return fmt.Errorf("unexpected %v field", f)
+	}
+	return nil
+}
+
+// Location returns the time zone of the timestamps
+func (s *Schema) Location() *time.Location {
+	if s.Validate() != nil {
+		return time.UTC
+	}
+	return s.loc
+}
+
+// split splits an event into its fields, without the whitespace around them
+func (s *Schema) split(event string) []string {
+	fields := strings.Split(event, s.Separator)
+	for i := range fields {
+		fields[i] = strings.TrimSpace(fields[i])
+	}
+	return fields
+}
+
+// IP returns the IP field of an event without parsing the rest of it, or an
+// empty string if the event has the wrong number of fields
+func (s *Schema) IP(event string) string {
+	n := strings.Count(event, s.Separator) + 1
+
+	var layout []Field
+	switch n {
+	case len(s.Zap):
+		layout = s.Zap
+	case len(s.Status):
+		layout = s.Status
+	default:
+		return ""
+	}
+
+	fields := s.split(event)
+	for i, f := range layout {
+		if f == FieldIP {
+			return fields[i]
+		}
+	}
+	return ""
+}
+
+// IPBytes is IP for an event in a byte slice. It returns the IP field as a
+// slice of the event, or nil, so it does not allocate.
+func (s *Schema) IPBytes(event []byte) []byte {
+	sep := []byte(s.Separator)
+
+	var layout []Field
+	switch bytes.Count(event, sep) + 1 {
+	case len(s.Zap):
+		layout = s.Zap
+	case len(s.Status):
+		layout = s.Status
+	default:
+		return nil
+	}
+
+	for i, f := range layout {
+		if f != FieldIP {
+			continue
+		}
+		for ; i > 0; i-- {
+			event = event[bytes.Index(event, sep)+len(sep):]
+		}
+		if j := bytes.Index(event, sep); j >= 0 {
+			event = event[:j]
+		}
+		return bytes.TrimSpace(event)
+	}
+	return nil
+}
+
+// Parse takes an event string and returns a ChZap or StatusChange event
+func (s *Schema) Parse(event string) (*ChZap, *StatusChange, error) {
+	if err := s.Validate(); err != nil {
+		return nil, nil, err
+	}
+
+	fields := s.split(event)
+	switch len(fields) {
+	case len(s.Zap):
+		zap, err := s.parseZap(fields)
+		if err != nil {
+			return nil, nil, err
+		}
+		return zap, nil, nil
+	case len(s.Status):
+		ztat, err := s.parseStatus(fields)
+		if err != nil {
+			return nil, nil, err
+		}
+		return nil, ztat, nil
+	}
+
+	if len(fields) < len(s.Zap) && len(fields) < len(s.Status) {
+		return nil, nil, fmt.Errorf("Parse: event with too few fields: %v", event)
+	}
+	return nil, nil, fmt.Errorf("Parse: Could not parse event string: '%v'", event)
+}
+
+// parseTime parses the timestamp fields of an event
+func (s *Schema) parseTime(layout []Field, fields []string) (time.Time, error) {
+	var parts []string
+	for i, f := range layout {
+		if f == FieldTimestamp {
+			parts = append(parts, fields[i])
+		}
+	}
+
+	// The wall clock time, which is placed in the time zone below
+	t, err := time.Parse(s.TimeLayout, strings.Join(parts, " "))
+	if err != nil {
+		return t, err
+	}
+	if s.zoned {
+		return t.In(s.loc), nil
+	}
+	return localTime(t, s.loc, s.DST)
+}
+
+// dstError is returned for local times that are ambiguous or skipped because of
+// a daylight saving time transition, with DSTReject
+type dstError struct {
+	wall      time.Time
+	loc       *time.Location
+	ambiguous bool
+}
+
+func (e *dstError) Error() string {
+	if e.ambiguous {
+		return fmt.Sprintf("Parse: %v happens twice in %v", e.wall.Format("2006/01/02 15:04:05"), e.loc)
+	}
+	return fmt.Sprintf("Parse: %v does not exist in %v", e.wall.Format("2006/01/02 15:04:05"), e.loc)
+}
+
+// localTime returns the time at which the clocks in loc show the wall clock
+// time, given in UTC. Unlike time.Date, it resolves times around daylight
+// saving time transitions by the policy.
+func localTime(wall time.Time, loc *time.Location, policy DSTPolicy) (time.Time, error) {
+	// The UTC offsets in effect a day before and after. Time zones are less
+	// than a day from UTC, and change their offset at most once a day.
+	_, before := wall.Add(-24 * time.Hour).In(loc).Zone()
+	_, after := wall.Add(24 * time.Hour).In(loc).Zone()
+
+	early := wall.Add(-time.Duration(before) * time.Second).In(loc)
+	late := wall.Add(-time.Duration(after) * time.Second).In(loc)
+	earlyOK := sameClock(early, wall)
+	lateOK := sameClock(late, wall)
+
+	if early.After(late) {
+		early, late = late, early
+		earlyOK, lateOK = lateOK, earlyOK
+	}
+
+	switch {
+	case earlyOK && lateOK && !early.Equal(late):
+		if policy == DSTReject {
+			return time.Time{}, &dstError{wall, loc, true}
+		}
+		if policy == DSTLater {
+			return late, nil
+		}
+		return early, nil
+	case earlyOK:
+		return early, nil
+	case lateOK:
+		return late, nil
+	}
+
+	// The clocks skipped the time, so it is moved forward by the offset in
+	// effect before the gap
+	if policy == DSTReject {
+		return time.Time{}, &dstError{wall, loc, false}
+	}
+	return wall.Add(-time.Duration(before) * time.Second).In(loc), nil
+}
+
+// sameClock reports whether t shows the wall clock time, given in UTC
+func sameClock(t, wall time.Time) bool {
+	y, m, d := t.Date()
+	h, min, sec := t.Clock()
+	return time.Date(y, m, d, h, min, sec, t.Nanosecond(), time.UTC).Equal(wall)
+}
+
+func (s *Schema) parseZap(fields []string) (*ChZap, error) {
+	var zap ChZap
+
+	for i, f := range s.Zap {
+		switch f {
+		case FieldIP:
+			zap.IP = fields[i]
+		case FieldToChan:
+			zap.ToChan = fields[i]
+		case FieldFromChan:
+			zap.FromChan = fields[i]
+		default:
+			continue
+		}
+		if fields[i] == "" {
+			return nil, &eventFieldsError{eventFields: fields, reason: fmt.Sprintf("empty %v field", f)}
+		}
+	}
+
+	t, err := s.parseTime(s.Zap, fields)
+	if _, ok := err.(*dstError); ok {
+		return nil, err
+	} else if err != nil {
+		return nil, &eventDateTimeError{err: err, event: strings.Join(fields, s.Separator+" ")}
+	}
+
+	zap.Addr, _ = netip.ParseAddr(zap.IP)
+	zap.Time = t
+	return &zap, nil
+}
+
+func (s *Schema) parseStatus(fields []string) (*StatusChange, error) {
+	var ip, status string
+	for i, f := range s.Status {
+		switch f {
+		case FieldIP:
+			ip = fields[i]
+		case FieldStatus:
+			status = fields[i]
+		}
+	}
+	if ip == "" {
+		return nil, &eventFieldsError{eventFields: fields, reason: "empty ip field"}
+	}
+
+	ztat, err := parseStatus(fields, ip, status, s.StatusSeparator)
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := s.parseTime(s.Status, fields)
+	if err != nil {
+		return nil, &eventDateTimeError{err: err, event: strings.Join(fields, s.Separator+" ")}
+	}
+
+	ztat.Time = t
+	return ztat, nil
+}
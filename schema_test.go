@@ -0,0 +1,227 @@
+package lab7
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "update the golden files")
+
+// golden describes the result of parsing an event, naming every field
+func golden(zap *ChZap, ztat *StatusChange, err error) string {
+	switch {
+	case err != nil:
+		// Some errors span lines, which would split the golden file entry
+		return fmt.Sprintf("error  %v", strings.ReplaceAll(err.Error(), "\n", `\n`))
+	case zap != nil:
+		return fmt.Sprintf("zap    %v ip=%q to=%q from=%q", zap.Time.Format(time.RFC3339), zap.IP, zap.ToChan, zap.FromChan)
+	default:
+		return fmt.Sprintf("status %v ip=%q %v=%v", ztat.Time.Format(time.RFC3339), ztat.IP, ztat.Kind, ztat.Value)
+	}
+}
+
+// TestSchemaGolden parses the events in testdata/zapbox2013.txt and compares
+// the results with testdata/zapbox2013.golden. Run with -update to rewrite the
+// golden file.
+func TestSchemaGolden(t *testing.T) {
+	in, err := os.ReadFile("testdata/zapbox2013.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	sc := bufio.NewScanner(strings.NewReader(string(in)))
+	for sc.Scan() {
+		got = append(got, golden(ZapBox2013.Parse(sc.Text())))
+	}
+
+	const path = "testdata/zapbox2013.golden"
+	if *update {
+		if err := os.WriteFile(path, []byte(strings.Join(got, "\n")+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+
+	if len(got) != len(want) {
+		t.Fatalf("parsed %v events, golden file has %v", len(got), len(want))
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Errorf("line %v:\n got %v\nwant %v", i+1, got[i], want[i])
+		}
+	}
+}
+
+// firmwareSchema puts the channels in the opposite order of ZapBox2013, uses
+// ISO timestamps and semicolons, and has an extra field
+var firmwareSchema = `{
+	"Name": "Firmware 2",
+	"Separator": ";",
+	"StatusSeparator": "=",
+	"Zap": ["timestamp", "ip", "skip", "from", "to"],
+	"Status": ["timestamp", "ip", "skip", "status"],
+	"TimeLayout": "2006-01-02T15:04:05",
+	"TimeZone": "Europe/Oslo"
+}`
+
+func TestLoadSchema(t *testing.T) {
+	s, err := LoadSchema(strings.NewReader(firmwareSchema))
+	if err != nil {
+		t.Fatalf("LoadSchema() => %v", err)
+	}
+
+	oslo, err := time.LoadLocation("Europe/Oslo")
+	if err != nil {
+		t.Skip("no time zone database:", err)
+	}
+	at := time.Date(2013, 7, 20, 21, 56, 13, 0, oslo)
+
+	zap, _, err := s.Parse("2013-07-20T21:56:13; 10.0.0.1; v2.1; NRK1; TV2 Norge")
+	want := &ChZap{Time: at, IP: "10.0.0.1", FromChan: "NRK1", ToChan: "TV2 Norge"}
+	if err != nil || !zap.Time.Equal(at) || zap.IP != want.IP || zap.FromChan != want.FromChan || zap.ToChan != want.ToChan {
+		t.Errorf("Parse(zap) => %v, %v, want %v", zap, err, want)
+	}
+
+	_, ztat, err := s.Parse("2013-07-20T21:56:13; 10.0.0.1; v2.1; Volume=30")
+	wantStatus := &StatusChange{Time: at, IP: "10.0.0.1", Kind: StatusVolume, Value: 30}
+	if err != nil || !ztat.Time.Equal(at) || ztat.IP != wantStatus.IP || ztat.Kind != wantStatus.Kind || ztat.Value != wantStatus.Value {
+		t.Errorf("Parse(status) => %v, %v, want %v", ztat, err, wantStatus)
+	}
+
+	if ip := s.IP("2013-07-20T21:56:13; 10.0.0.1 ; v2.1; NRK1; TV2 Norge"); ip != "10.0.0.1" {
+		t.Errorf("IP() => %q, want 10.0.0.1", ip)
+	}
+	for _, event := range []string{"2013-07-20T21:56:13; 10.0.0.1 ; v2.1; NRK1; TV2 Norge", "2013-07-20T21:56:13;10.0.0.1;v2.1;Volume=30"} {
+		if ip := s.IPBytes([]byte(event)); string(ip) != "10.0.0.1" {
+			t.Errorf("IPBytes(%q) => %q, want 10.0.0.1", event, ip)
+		}
+	}
+	if ip := s.IPBytes([]byte("10.0.0.1")); ip != nil {
+		t.Errorf("IPBytes(10.0.0.1) => %q, want nil", ip)
+	}
+}
+
+var badschematests = []struct {
+	name   string
+	schema Schema
+}{
+	{"no separator", Schema{StatusSeparator: ":", Zap: ZapBox2013.Zap, Status: ZapBox2013.Status, TimeLayout: "15:04"}},
+	{"same lengths", Schema{Separator: ",", StatusSeparator: ":", Zap: ZapBox2013.Zap, Status: ZapBox2013.Zap, TimeLayout: "15:04"}},
+	{"no layout", Schema{Separator: ",", StatusSeparator: ":", Zap: ZapBox2013.Zap, Status: ZapBox2013.Status}},
+	{"two ips", Schema{Separator: ",", StatusSeparator: ":", TimeLayout: "15:04",
+		Zap: []Field{FieldTimestamp, FieldIP, FieldIP, FieldToChan, FieldFromChan}, Status: ZapBox2013.Status}},
+	{"no from", Schema{Separator: ",", StatusSeparator: ":", TimeLayout: "15:04",
+		Zap: []Field{FieldTimestamp, FieldIP, FieldToChan}, Status: ZapBox2013.Status}},
+	{"status in zap", Schema{Separator: ",", StatusSeparator: ":", TimeLayout: "15:04",
+		Zap: []Field{FieldTimestamp, FieldIP, FieldToChan, FieldFromChan, FieldStatus}, Status: ZapBox2013.Status}},
+	{"no timestamp", Schema{Separator: ",", StatusSeparator: ":", TimeLayout: "15:04",
+		Zap: ZapBox2013.Zap, Status: []Field{FieldIP, FieldStatus}}},
+	{"bad time zone", Schema{Separator: ",", StatusSeparator: ":", TimeLayout: "15:04", TimeZone: "Nowhere/Atlantis",
+		Zap: ZapBox2013.Zap, Status: ZapBox2013.Status}},
+	{"bad dst policy", Schema{Separator: ",", StatusSeparator: ":", TimeLayout: "15:04", DST: "latest",
+		Zap: ZapBox2013.Zap, Status: ZapBox2013.Status}},
+}
+
+func TestSchemaValidate(t *testing.T) {
+	if err := ZapBox2013.Validate(); err != nil {
+		t.Errorf("ZapBox2013.Validate() => %v", err)
+	}
+
+	for i := range badschematests {
+		tt := &badschematests[i]
+		if err := tt.schema.Validate(); err == nil {
+			t.Errorf("%v: Validate() => nil, want error", tt.name)
+		}
+		if _, _, err := tt.schema.Parse("2013/07/20, 21:56:13, 10.0.0.1, NRK1, NRK2"); err == nil {
+			t.Errorf("%v: Parse() => nil error, want the validation error", tt.name)
+		}
+	}
+}
+
+func TestLookupSchema(t *testing.T) {
+	if s, err := LookupSchema("zapbox2013"); s != ZapBox2013 || err != nil {
+		t.Errorf("LookupSchema(zapbox2013) => %v, %v, want ZapBox2013", s, err)
+	}
+	if _, err := LookupSchema("testdata/no-such-schema.json"); err == nil {
+		t.Error("LookupSchema(missing file) => nil error")
+	}
+}
+
+// The clocks in Norway were set back from 03:00 to 02:00 on 2013/10/27 and
+// forward from 02:00 to 03:00 on 2013/03/31
+var dsttests = []struct {
+	event  string
+	policy DSTPolicy
+	want   string // in UTC, or empty for an error
+}{
+	{"2013/10/27, 01:30:00, 10.0.0.1, NRK1, NRK2", DSTReject, "2013-10-26T23:30:00Z"},
+	{"2013/10/27, 02:30:00, 10.0.0.1, NRK1, NRK2", "", "2013-10-27T00:30:00Z"},
+	{"2013/10/27, 02:30:00, 10.0.0.1, NRK1, NRK2", DSTEarlier, "2013-10-27T00:30:00Z"},
+	{"2013/10/27, 02:30:00, 10.0.0.1, NRK1, NRK2", DSTLater, "2013-10-27T01:30:00Z"},
+	{"2013/10/27, 02:30:00, 10.0.0.1, NRK1, NRK2", DSTReject, ""},
+	{"2013/10/27, 03:00:00, 10.0.0.1, NRK1, NRK2", DSTReject, "2013-10-27T02:00:00Z"},
+	{"2013/03/31, 01:59:59, 10.0.0.1, NRK1, NRK2", DSTReject, "2013-03-31T00:59:59Z"},
+	{"2013/03/31, 02:30:00, 10.0.0.1, NRK1, NRK2", DSTEarlier, "2013-03-31T01:30:00Z"},
+	{"2013/03/31, 02:30:00, 10.0.0.1, NRK1, NRK2", DSTLater, "2013-03-31T01:30:00Z"},
+	{"2013/03/31, 02:30:00, 10.0.0.1, NRK1, NRK2", DSTReject, ""},
+	{"2013/03/31, 03:00:00, 10.0.0.1, NRK1, NRK2", DSTReject, "2013-03-31T01:00:00Z"},
+}
+
+func TestSchemaDST(t *testing.T) {
+	oslo, err := time.LoadLocation("Europe/Oslo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range dsttests {
+		s := ZapBox2013.In(oslo)
+		s.DST = tt.policy
+
+		z, _, err := s.Parse(tt.event)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("%v with %q: Parse() => %v, want error", tt.event, tt.policy, z.Time)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v with %q: Parse() => %v", tt.event, tt.policy, err)
+			continue
+		}
+		if got := z.Time.UTC().Format(time.RFC3339); got != tt.want {
+			t.Errorf("%v with %q: Parse() => %v, want %v", tt.event, tt.policy, got, tt.want)
+		}
+		if z.Time.Location() != oslo {
+			t.Errorf("%v with %q: time in %v, want %v", tt.event, tt.policy, z.Time.Location(), oslo)
+		}
+	}
+}
+
+// TestSchemaLocalDay checks that dates are the broadcaster's, and that
+// durations span the extra hour of the night the clocks are set back
+func TestSchemaLocalDay(t *testing.T) {
+	z, _, err := ZapBox2013.Parse("2013/07/21, 00:30:00, 10.0.0.1, NRK1, NRK2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := z.Date(); d != "2013/07/21" {
+		t.Errorf("Date() => %v, want 2013/07/21", d)
+	}
+
+	before, _, _ := ZapBox2013.Parse("2013/10/27, 01:00:00, 10.0.0.1, NRK1, NRK2")
+	after, _, _ := ZapBox2013.Parse("2013/10/27, 04:00:00, 10.0.0.1, NRK2, NRK1")
+	if d := after.Duration(*before); d != 4*time.Hour {
+		t.Errorf("Duration() => %v, want 4h", d)
+	}
+}
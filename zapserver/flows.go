@@ -0,0 +1,46 @@
+// Audience flow export
+
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+
+	"../zlog"
+)
+
+var flowFile = flag.String("flows", "", "write the flow logger's transition matrix to this .csv or .json file on exit")
+
+// writeFlows writes the transitions since the server started to the -flows
+// file, as CSV or as JSON for drawing a Sankey diagram depending on its
+// extension
+func writeFlows() {
+	fzl, ok := ztore.(*zlog.FlowZapLogger)
+	if *flowFile == "" || !ok {
+		return
+	}
+
+	f, err := os.Create(*flowFile)
+	if err != nil {
+		log.Printf("Writing flows failed: %v", err)
+		return
+	}
+
+	m := fzl.Matrix()
+	if filepath.Ext(*flowFile) == ".csv" {
+		err = m.WriteCSV(f)
+	} else {
+		err = m.WriteJSON(f)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+
+	if err != nil {
+		log.Printf("Writing flows failed: %v", err)
+		return
+	}
+	log.Printf("Wrote %v transitions to %v", len(m.Transitions), *flowFile)
+}
@@ -35,9 +35,20 @@ func main() {
 		panic(err)
 	}
 
-	// Wait for CTRL-C or other kill signal
-	s := <-signalChan
-	fmt.Println("Server stopping on", s, "signal")
+	// Wait for CTRL-C or other kill signal, or for the ingester to fail
+	exitCode := 0
+	select {
+	case s := <-signalChan:
+		fmt.Println("Server stopping on", s, "signal")
+	case err := <-fatal:
+		fmt.Println("Server stopping on error:", err)
+		exitCode = 1
+	}
+
+	stopServer()
+	closeStore()
+	writeFlows()
+
 	if *memprofile != "" {
 		f, err := os.Create(*memprofile)
 		if err != nil {
@@ -49,4 +60,6 @@ func main() {
 		fmt.Println("Saved memory profile")
 		fmt.Println("Analyze with: go tool pprof $GOPATH/bin/zapserver", *memprofile)
 	}
+
+	os.Exit(exitCode)
 }
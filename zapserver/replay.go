@@ -0,0 +1,150 @@
+// Offline replay of recorded datasets
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	zap "github.com/ltlian/glabs/lab7"
+)
+
+var (
+	replay = flag.String("replay", "", "replay events from this dataset file instead of listening for multicast")
+	pace   = flag.String("pace", zap.PaceClock, "replay pacing: 'clock' syncs dataset time of day with the local clock, 'speed' replays at -speed times real time, 'fast' replays as fast as possible")
+	speed  = flag.Float64("speed", 1, "speed factor used with -pace speed")
+
+	bootstrap = flag.String("bootstrap", "", "before receiving events, log the part of this dataset file that is earlier in the day than the local clock")
+	format    = flag.String("format", zap.FormatAuto, "format of the -replay and -bootstrap datasets: auto, line, jsonl, csv or binary")
+)
+
+// replayEvents reads a recorded dataset and logs each event as if it had been
+// received from the multicast stream
+func replayEvents(f io.Closer, dec *zap.Decoder, p *zap.Pacer) {
+	defer f.Close()
+
+	for {
+		zCh, ztat, err := dec.Decode()
+		if err == io.EOF {
+			break
+		} else if _, ok := err.(*zap.LineError); ok {
+			log.Printf("Skipping malformed event: %v", err)
+			continue
+		} else if err != nil {
+			stop(fmt.Errorf("replay of %v stopped after %v lines: %v", *replay, dec.Line(), err))
+			return
+		}
+
+		p.Wait(eventTime(zCh, ztat))
+
+		// Dump to console and skip logging
+		if *labnum == "a" {
+			if zCh != nil {
+				log.Printf("Replayed: %v", zCh)
+			} else {
+				log.Printf("Replayed: %v", ztat)
+			}
+			continue
+		}
+
+		logEvent(zCh, ztat)
+	}
+
+	log.Printf("Replay of %v finished after %v lines", *replay, dec.Line())
+}
+
+// openReplay opens the dataset given by the -replay flag
+func openReplay() (io.Closer, *zap.Decoder, *zap.Pacer, error) {
+	p, err := zap.NewPacer(*pace, *speed)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	f, err := os.Open(*replay)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	dec, err := zap.NewFormatDecoder(f, *format, schema)
+	if err != nil {
+		f.Close()
+		return nil, nil, nil, err
+	}
+
+	log.Printf("ZapServer replaying %v (pacing: %v)", *replay, *pace)
+
+	return f, dec, p, nil
+}
+
+// bootstrapFrom logs the events of a recorded dataset up to the current time of
+// day, so that a server started in the middle of the day knows the channel of
+// the boxes that were turned on earlier. Only the first day of the dataset is
+// used, and its events must be in time order.
+func bootstrapFrom(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// The current time of day where the events were recorded
+	cutoff := clock(time.Now().In(schema.Location()))
+
+	var first time.Time
+	var n int
+
+	dec, err := zap.NewFormatDecoder(f, *format, schema)
+	if err != nil {
+		return err
+	}
+	for {
+		zCh, ztat, err := dec.Decode()
+		if err == io.EOF {
+			break
+		} else if _, ok := err.(*zap.LineError); ok {
+			log.Printf("Skipping malformed event: %v", err)
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		t := eventTime(zCh, ztat)
+		if first.IsZero() {
+			first = midnight(t)
+		}
+		if !midnight(t).Equal(first) || clock(t) >= cutoff {
+			break
+		}
+
+		logEvent(zCh, ztat)
+		n++
+	}
+
+	log.Printf("Bootstrapped %v events from %v, coverage %v", n, path, ztore.Coverage())
+	return nil
+}
+
+// eventTime returns the timestamp of the zap or status change, whichever is set
+func eventTime(zCh *zap.ChZap, ztat *zap.StatusChange) time.Time {
+	if zCh != nil {
+		return zCh.Time
+	}
+	return ztat.Time
+}
+
+// midnight returns the start of t's day
+func midnight(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
+
+// clock returns the time of day that t's clock shows, which differs from the
+// time since midnight on the days the clocks are changed
+func clock(t time.Time) time.Duration {
+	h, m, s := t.Clock()
+	return time.Duration(h)*time.Hour + time.Duration(m)*time.Minute + time.Duration(s)*time.Second
+}
@@ -0,0 +1,57 @@
+// Persistent logger state
+
+package main
+
+import (
+	"flag"
+	"log"
+	"time"
+
+	"../zlog"
+)
+
+var (
+	stateDir   = flag.String("state", "", "keep the logger state in this directory and restore it on startup")
+	checkpoint = flag.Duration("checkpoint", time.Minute, "how often the logger state is saved with -state")
+
+	store *zlog.Store
+)
+
+// openStore restores the logger state from the -state directory, and starts
+// saving it periodically
+func openStore() error {
+	var err error
+	store, err = zlog.OpenStore(*stateDir, ztore)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Restored state from %v: %v zaps, %v channels, coverage %v",
+		*stateDir, store.Seq(), ztore.Entries(), ztore.Coverage())
+
+	go checkpoints(store, *checkpoint)
+	return nil
+}
+
+// checkpoints saves the logger state at the given interval
+func checkpoints(s *zlog.Store, freq time.Duration) {
+	for {
+		time.Sleep(freq)
+		if err := s.Checkpoint(); err != nil {
+			log.Printf("Saving state failed: %v", err)
+		}
+	}
+}
+
+// closeStore saves the logger state before the server exits
+func closeStore() {
+	if store == nil {
+		return
+	}
+
+	if err := store.Close(); err != nil {
+		log.Printf("Saving state failed: %v", err)
+		return
+	}
+	log.Printf("Saved state to %v", *stateDir)
+}
@@ -11,6 +11,7 @@ import (
 	"net"
 	"time"
 
+	"../zingest"
 	"../zlog"
 	"../zubclient"
 	"../zubpub"
@@ -24,20 +25,52 @@ var (
 	showHelp   = flag.Bool("h", false, "show this help message and exit")
 	memprofile = flag.String("memprofile", "", "write memory profile to this file")
 	printTime  = flag.Bool("time", false, "log execution times to console")
+	deadLetter = flag.String("deadletter", "", "append malformed events to this file (default keeps the latest in memory)")
+	statsFreq  = flag.Duration("stats", 0, "log ingest counters at this interval")
+	workers    = flag.Int("workers", 4, "number of event parser workers")
+	queueSize  = flag.Int("queue", 1024, "capacity of the queues between the ingest stages")
+	overflow   = flag.String("overflow", "block", "what to do when an ingest queue is full: block, drop-oldest or drop-newest")
+	logger     = flag.String("logger", "", "override the lab's logger: simple, viewers, advanced, snapshot, ranked, mute or flow")
+	statistic  = flag.Uint("statistic", 3, "statistic requested by the grpc lab's client: 0 summary, 1 viewers, 2 durations, 3 sample sizes, 4 distribution, 5 muted, 6 volume")
+	snapFreq   = flag.Duration("snapshot", time.Second, "how often the snapshot logger publishes its state")
+	windowSize = flag.Duration("window", 0, "also aggregate viewers over tumbling windows of this size, such as 15m")
+	slideSize  = flag.Duration("slide", 5*time.Minute, "sliding window for counting zaps with -window")
+	trackVol   = flag.Bool("volume", false, "also track the volume levels of each channel's viewers")
+	schemaName = flag.String("schema", "zapbox2013", "format of the events: a built-in schema or a JSON schema file")
+	timeZone   = flag.String("tz", "", "time zone of the event timestamps, such as Europe/Oslo, overriding the schema's")
+	schema     *zap.Schema
 	ztore      zlog.ZapLogger
+	windows    *zlog.WindowStats
+	volume     *zlog.VolumeStats
+
+	listener *net.UDPConn
+	ingester *zingest.Ingester
+	rejects  zingest.DeadLetterSink
+	// ingested is closed when the ingester has handled every event it read
+	ingested = make(chan struct{})
+
+	// fatal receives the error that stopped the ingester, the replay or the state
+	// store
+	fatal = make(chan error, 1)
 )
 
-// The buffer size to be used for reading from the event listener
-const bufSize = 4096
+// The number of malformed events kept in memory when no dead-letter file is given
+const ringSize = 100
 
 func runLab() error {
 
-	listener, err := startServer()
+	var err error
+	schema, err = zap.LookupSchema(*schemaName)
 	if err != nil {
 		return err
 	}
-
-	go readFromServer(listener)
+	if *timeZone != "" {
+		loc, err := time.LoadLocation(*timeZone)
+		if err != nil {
+			return err
+		}
+		schema = schema.In(loc)
+	}
 
 	// Create logger
 	switch *labnum {
@@ -49,6 +82,62 @@ func runLab() error {
 		ztore = zlog.NewAdvancedZapLogger()
 	}
 
+	switch *logger {
+	case "":
+	case "simple":
+		ztore = zlog.NewSimpleZapLogger()
+	case "viewers":
+		ztore = zlog.NewViewersZapLogger()
+	case "advanced":
+		ztore = zlog.NewAdvancedZapLogger()
+	case "snapshot":
+		szl := zlog.NewSnapshotZapLogger(*snapFreq).(*zlog.SnapshotZapLogger)
+		szl.Start()
+		ztore = szl
+	case "ranked":
+		ztore = zlog.NewRankedZapLogger()
+	case "mute":
+		ztore = zlog.NewMuteZapLogger()
+	case "flow":
+		// Flows are counted in the -window size, or 15 minutes, for a day
+		size := *windowSize
+		if size <= 0 {
+			size = 15 * time.Minute
+		}
+		retain := int(24 * time.Hour / size)
+		if retain < 1 {
+			retain = 1
+		}
+
+		ztore, err = zlog.NewFlowZapLogger(size, retain)
+		if err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown logger '%v'", *logger)
+	}
+
+	// A day of windows is kept
+	if *windowSize > 0 {
+		retain := int(24 * time.Hour / *windowSize)
+		if retain < 1 {
+			retain = 1
+		}
+
+		windows, err = zlog.NewWindowStats(*windowSize, *slideSize, retain)
+		if err != nil {
+			return err
+		}
+	}
+
+	// A jump is a fifth of the volume range on five boxes within ten seconds
+	if *trackVol {
+		volume, err = zlog.NewVolumeStats(20, 5, 10*time.Second)
+		if err != nil {
+			return err
+		}
+	}
+
 	// Toggle whether the logger should print the time taken to fetch and
 	// process various data
 	switch *labnum {
@@ -62,6 +151,35 @@ func runLab() error {
 	log.Printf("Logger:\t\t%s", ztore)
 	log.Printf("Time measurements:\t%v\n\n", zlog.PrintTimes)
 
+	// Restore the state saved by a previous run
+	if *stateDir != "" {
+		if err := openStore(); err != nil {
+			return err
+		}
+	}
+
+	// Catch up on the earlier part of the day before receiving live events
+	if *bootstrap != "" {
+		if err := bootstrapFrom(*bootstrap); err != nil {
+			return err
+		}
+	}
+
+	// Start receiving events once the logger is ready
+	if *replay != "" {
+		dataset, dec, p, err := openReplay()
+		if err != nil {
+			return fmt.Errorf("replay: %v", err)
+		}
+
+		go replayEvents(dataset, dec, p)
+	} else {
+		err := readFromServer()
+		if err != nil {
+			return err
+		}
+	}
+
 	// Select task
 	switch *labnum {
 	case "c1", "c2", "d":
@@ -69,7 +187,7 @@ func runLab() error {
 	case "e", "f":
 		go showTopTen()
 	case "grpc":
-		go zubpub.NewPublisher(&ztore)
+		go zubpub.NewPublisher(&ztore, volume)
 
 		client, err := zubclient.NewZubClient()
 		if err != nil {
@@ -79,7 +197,7 @@ func runLab() error {
 		//clientRequest := &zubclient.ZubRequest{}
 		clientRequest := &zubclient.ZubRequest{
 			Refreshinterval: 2,
-			Statistic:       3,
+			Statistic:       uint8(*statistic),
 		}
 
 		err = client.RequestSub(clientRequest)
@@ -125,38 +243,140 @@ func showViewers(chName string) {
 	}
 }
 
-// readFromServer() launches the client which listens for, parses, and logs zap
-// events
-func readFromServer(listener *net.UDPConn) {
+// readFromServer() launches the ingester which listens for, parses, and logs zap
+// events. Malformed events are set aside in the dead-letter sink.
+func readFromServer() error {
+	policy, err := zingest.ParsePolicy(*overflow)
+	if err != nil {
+		return err
+	}
 
-	b := make([]byte, bufSize)
+	listener, err = startServer()
+	if err != nil {
+		return err
+	}
 
-	for {
-		// Listen to UDP address and write result to b
-		n, addr, err := listener.ReadFromUDP(b)
+	if *deadLetter != "" {
+		rejects, err = zingest.NewFileSink(*deadLetter)
 		if err != nil {
-			panic(err)
+			return err
 		}
+	} else {
+		rejects = zingest.NewRingBuffer(ringSize)
+	}
 
-		res := string(b[:n])
+	handle := logEvent
 
-		// Dump to console and skip logging
-		if *labnum == "a" {
-			log.Printf("Received from %v: %v", addr, res)
-			continue
+	// Dump to console and skip logging
+	if *labnum == "a" {
+		handle = dumpEvent
+	}
+
+	ingester = zingest.New(listener, handle, rejects)
+	ingester.Workers = *workers
+	ingester.QueueSize = *queueSize
+	ingester.Overflow = policy
+	ingester.Schema = schema
+
+	go func() {
+		defer close(ingested)
+		if err := ingester.Run(); err != nil {
+			stop(err)
 		}
+	}()
 
-		zCh, ztat, err := zap.NewSTBEvent(res)
-		if err != nil {
-			panic(err)
-		} else if zCh != nil {
-			ztore.LogZap(*zCh)
+	if *statsFreq > 0 {
+		go showStats(*statsFreq)
+	}
+
+	return nil
+}
+
+// stopServer() stops publishing snapshots, closes the listener and waits for the
+// ingester to handle the events already read before reporting what was ingested
+func stopServer() {
+	if szl, ok := ztore.(*zlog.SnapshotZapLogger); ok {
+		szl.Stop()
+	}
+
+	if listener == nil {
+		return
+	}
+
+	listener.Close()
+	<-ingested
+	log.Printf("Ingested events: %v", ingester.Stats())
+
+	switch sink := rejects.(type) {
+	case *zingest.FileSink:
+		sink.Close()
+	case *zingest.RingBuffer:
+		for _, dl := range sink.Entries() {
+			log.Printf("Rejected: %v", dl)
+		}
+	}
+}
+
+// showStats() logs the ingest counters and stage metrics periodically
+func showStats(freq time.Duration) {
+	for {
+		time.Sleep(freq)
+		log.Printf("Ingested events: %v", ingester.Stats())
+		for _, stage := range ingester.Stages() {
+			log.Printf("  %v", stage)
+		}
+	}
+}
+
+// dumpEvent() prints an event to the console without logging it
+func dumpEvent(zCh *zap.ChZap, ztat *zap.StatusChange) {
+	if zCh != nil {
+		log.Printf("Received: %v", zCh)
+	} else {
+		log.Printf("Received: %v", ztat)
+	}
+}
+
+// stop stops the server with the error, unless it is already stopping on another
+func stop(err error) {
+	select {
+	case fatal <- err:
+	default:
+	}
+}
+
+// logEvent() stores a parsed event in the logger. It is shared by the multicast
+// listener and the dataset replay.
+func logEvent(zCh *zap.ChZap, ztat *zap.StatusChange) {
+	if zCh != nil && windows != nil {
+		windows.LogZap(*zCh)
+	}
+	if volume != nil {
+		if zCh != nil {
+			volume.LogZap(*zCh)
 		} else if ztat != nil {
-			// Statuschange is ignored, however the HDMI status can be used for channel view statistics
-			// ztore.LogZap(*ztat)
-		} else {
-			panic(fmt.Errorf("Nothing to handle from NewSTBEvent response"))
+			volume.LogStatus(*ztat)
+		}
+	}
+
+	if zCh != nil && store != nil {
+		if err := store.LogZap(*zCh); err != nil {
+			stop(err)
+		}
+	} else if zCh != nil {
+		ztore.LogZap(*zCh)
+	} else if ztat != nil && store != nil {
+		if err := store.LogStatus(*ztat); err != nil {
+			stop(err)
+		}
+	} else if ztat != nil {
+		// Status changes are only used by loggers that track them, such as muting
+		// and whether TVs are turned on
+		if sl, ok := ztore.(zlog.StatusLogger); ok {
+			sl.LogStatus(*ztat)
 		}
+	} else {
+		panic(fmt.Errorf("Nothing to handle from NewSTBEvent response"))
 	}
 }
 
@@ -176,19 +396,103 @@ func showTopTen() {
 
 		sortedChannels := ztore.FetchSorted(10)
 		println("len: ", len(sortedChannels))
-		fmt.Printf("\n    Channel\t     Viewers\n")
+		fmt.Printf("\nBoxes powered on: %v\n", ztore.PoweredOn())
+		fmt.Printf("Coverage: %v\n", ztore.Coverage())
+		fmt.Printf("\n    Channel\t     Viewers  Watching\n")
 		/* TODO
 		for as := sortedChannels.ChanViewersList [
 			println(as)
 		]*/
 
 		for r, ch := range sortedChannels {
-			fmt.Printf("%2v: %-18v%3v\n", r+1, ch.Channel, ch.Viewers)
+			fmt.Printf("%2v: %-18v%3v%10v\n", r+1, ch.Channel, ch.Viewers, ch.Watching)
 			if r > 8 { // Break after rank (9+1) or higher
 				break
 			}
 		}
 
+		if windows != nil {
+			showWindows(sortedChannels)
+		}
+
+		if volume != nil {
+			showVolume(sortedChannels)
+		}
+
+		if mzl, ok := ztore.(*zlog.MuteZapLogger); ok {
+			fmt.Printf("\nMost muted channels\n")
+			for r, ms := range mzl.TopMuted(10) {
+				fmt.Printf("%2v: %v\n", r+1, ms)
+			}
+		}
+
+		if fzl, ok := ztore.(*zlog.FlowZapLogger); ok && len(sortedChannels) > 0 {
+			showFlows(fzl, sortedChannels[0].Channel)
+		}
+
 		time.Sleep(retryInterval)
 	}
 }
+
+// showWindows() prints the windowed statistics of the given channels: zaps in
+// the sliding window, average viewers in the current window and the moving
+// average over the last four windows, and the peak viewers
+func showWindows(channels zlog.ChanViewersList) {
+	fmt.Printf("\n    Channel\t  Zaps/%v  Avg/%v   SMA(4)   Peak\n", *slideSize, *windowSize)
+	for r, ch := range channels {
+		buckets := windows.Buckets(ch.Channel)
+		var avg float64
+		if len(buckets) > 0 {
+			avg = buckets[len(buckets)-1].AvgViewers
+		}
+		peak := windows.Peak(ch.Channel)
+
+		fmt.Printf("%2v: %-18v%6v %9.1f %8.1f %6v at %v\n", r+1, ch.Channel,
+			windows.Zaps(ch.Channel), avg, windows.MovingAverage(ch.Channel, 4),
+			peak.Viewers, peak.Time.Format("15:04:05"))
+	}
+}
+
+// showVolume() prints the volume statistics of the given channels: the average
+// volume and histogram of the current viewers, and the number of volume jumps
+// followed by the latest ones on any channel
+func showVolume(channels zlog.ChanViewersList) {
+	fmt.Printf("\n    Channel\t  Volume  Histogram                          Jumps\n")
+	for r, ch := range channels {
+		cv := volume.Channel(ch.Channel)
+		fmt.Printf("%2v: %-18v%6.1f  %v %6v\n", r+1, ch.Channel, cv.Average, cv.Histogram, cv.Jumps)
+	}
+
+	if jumps := volume.LatestJumps(5); len(jumps) > 0 {
+		fmt.Printf("\nLatest volume jumps\n")
+		for _, vj := range jumps {
+			fmt.Printf("    %v\n", vj)
+		}
+	}
+}
+
+// showFlows() prints where the viewers of a channel came from and went to in
+// the latest window, and the most common zaps overall
+func showFlows(fzl *zlog.FlowZapLogger, chName string) {
+	starts := fzl.Windows()
+	if len(starts) == 0 {
+		return
+	}
+
+	latest := fzl.WindowMatrix(starts[len(starts)-1])
+	fmt.Printf("\n%v viewers since %v\n", chName, latest.Start.Format("15:04"))
+	for _, t := range latest.Inbound(chName, 5) {
+		fmt.Printf("    came from %-18v%4v\n", t.From, t.Zaps)
+	}
+	for _, t := range latest.Outbound(chName, 5) {
+		fmt.Printf("    went to   %-18v%4v\n", t.To, t.Zaps)
+	}
+
+	fmt.Printf("\nMost common zaps\n")
+	for r, t := range fzl.Matrix().Transitions {
+		if r > 4 {
+			break
+		}
+		fmt.Printf("%2v: %v\n", r+1, t)
+	}
+}
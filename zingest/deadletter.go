@@ -0,0 +1,98 @@
+package zingest
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// DeadLetterSink receives the events that could not be ingested
+type DeadLetterSink interface {
+	Reject(event string, err error)
+}
+
+// DeadLetter is an event that could not be ingested, along with the reason
+type DeadLetter struct {
+	Time  time.Time
+	Event string
+	Err   error
+}
+
+func (dl DeadLetter) String() string {
+	return fmt.Sprintf("%v: '%v': %v", dl.Time.Format(time.RFC3339), dl.Event, dl.Err)
+}
+
+// RingBuffer is a dead-letter sink that keeps the most recent rejected events in memory
+type RingBuffer struct {
+	entries []DeadLetter
+	next    int
+	full    bool
+	mu      sync.Mutex
+}
+
+// NewRingBuffer creates a ring buffer holding up to size events
+func NewRingBuffer(size int) *RingBuffer {
+	if size < 1 {
+		size = 1
+	}
+	return &RingBuffer{entries: make([]DeadLetter, size)}
+}
+
+// Reject adds an event to the buffer, overwriting the oldest event if the buffer is full
+func (rb *RingBuffer) Reject(event string, err error) {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+
+	rb.entries[rb.next] = DeadLetter{Time: time.Now(), Event: event, Err: err}
+	rb.next = (rb.next + 1) % len(rb.entries)
+	if rb.next == 0 {
+		rb.full = true
+	}
+}
+
+// Entries returns a copy of the buffered events, oldest first
+func (rb *RingBuffer) Entries() []DeadLetter {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+
+	if !rb.full {
+		return append([]DeadLetter(nil), rb.entries[:rb.next]...)
+	}
+
+	entries := make([]DeadLetter, 0, len(rb.entries))
+	entries = append(entries, rb.entries[rb.next:]...)
+	return append(entries, rb.entries[:rb.next]...)
+}
+
+// FileSink is a dead-letter sink that appends rejected events to a file, one per line
+type FileSink struct {
+	f  *os.File
+	mu sync.Mutex
+}
+
+// NewFileSink opens the file for appending, creating it if needed
+func NewFileSink(filename string) (*FileSink, error) {
+	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &FileSink{f: f}, nil
+}
+
+// Reject writes the event to the file. Write errors are ignored, since there is
+// nowhere left to report them.
+func (fs *FileSink) Reject(event string, err error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	fmt.Fprintln(fs.f, DeadLetter{Time: time.Now(), Event: event, Err: err})
+}
+
+// Close closes the underlying file
+func (fs *FileSink) Close() error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	return fs.f.Close()
+}
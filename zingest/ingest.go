@@ -0,0 +1,367 @@
+// Package zingest receives raw set-top box events from the network, parses them
+// and hands them to a logger without letting bad events stop the server
+package zingest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	zap ".."
+)
+
+// The buffer size to be used for reading from the event listener
+const bufSize = 4096
+
+// Handler is called with every event that was parsed successfully. Either zCh
+// or ztat is set, as returned by NewSTBEvent. The event is reused after the
+// handler returns, so a handler that keeps it must keep a copy.
+type Handler func(zCh *zap.ChZap, ztat *zap.StatusChange)
+
+// Stats holds the event counters of an Ingester
+type Stats struct {
+	// Received is the number of datagrams read from the connection
+	Received uint64
+	// Parsed is the number of events that were parsed successfully
+	Parsed uint64
+	// Rejected is the number of malformed events
+	Rejected uint64
+	// Dropped is the number of events discarded because they were truncated
+	// or a queue overflowed
+	Dropped uint64
+}
+
+func (s Stats) String() string {
+	return fmt.Sprintf("received: %v, parsed: %v, rejected: %v, dropped: %v",
+		s.Received, s.Parsed, s.Rejected, s.Dropped)
+}
+
+// Ingester reads events from a packet connection, such as the multicast
+// listener, until the connection is closed or fails permanently.
+//
+// The events pass through three stages connected by bounded queues: a reader,
+// a pool of parser workers and a single writer that calls the handler. Events
+// from the same IP are always parsed by the same worker, so they reach the
+// handler in the order they were received. Events laid out like ZapBox 2013
+// are parsed by a zap.Parser in each worker, sharing one channel table, so a
+// well-formed event is parsed without allocating.
+type Ingester struct {
+	conn   net.PacketConn
+	handle Handler
+	sink   DeadLetterSink
+
+	// MinBackoff and MaxBackoff bound the delay between retries after a read error
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// MaxRetries is the number of consecutive read errors tolerated before
+	// the error is considered fatal
+	MaxRetries int
+
+	// Workers is the number of parser workers
+	Workers int
+	// QueueSize is the capacity of each queue between the stages
+	QueueSize int
+	// Overflow decides what happens to events arriving at a full queue
+	Overflow Policy
+	// Schema is the format of the events, or nil to parse them with NewSTBEvent
+	Schema *zap.Schema
+
+	received uint64
+	parsed   uint64
+	rejected uint64
+	dropped  uint64
+
+	reader stageMetrics
+	parser stageMetrics
+	writer stageMetrics
+
+	// Set up when Run is called
+	started time.Time
+	parseq  []chan event
+	writeq  chan event
+	mu      sync.Mutex
+}
+
+// New creates an ingester reading from conn. Events that cannot be parsed are
+// given to sink, which may be nil.
+func New(conn net.PacketConn, handle Handler, sink DeadLetterSink) *Ingester {
+	return &Ingester{
+		conn:       conn,
+		handle:     handle,
+		sink:       sink,
+		MinBackoff: 10 * time.Millisecond,
+		MaxBackoff: 5 * time.Second,
+		MaxRetries: 10,
+		Workers:    4,
+		QueueSize:  1024,
+		Overflow:   Block,
+		reader:     stageMetrics{name: "reader"},
+		parser:     stageMetrics{name: "parser"},
+		writer:     stageMetrics{name: "writer"},
+	}
+}
+
+// Run reads and handles events until the connection is closed, in which case
+// nil is returned, or until reading fails more than MaxRetries times in a row.
+// Events already read are handled before Run returns.
+func (in *Ingester) Run() error {
+	workers := in.Workers
+	if workers < 1 {
+		workers = 1
+	}
+
+	in.mu.Lock()
+	in.started = time.Now()
+	in.parseq = make([]chan event, workers)
+	for i := range in.parseq {
+		in.parseq[i] = make(chan event, in.QueueSize)
+	}
+	in.writeq = make(chan event, in.QueueSize)
+	in.mu.Unlock()
+
+	channels := zap.NewChannelTable()
+	var wg sync.WaitGroup
+	for _, q := range in.parseq {
+		wg.Add(1)
+		go func(q chan event, p *zap.Parser) {
+			defer wg.Done()
+			in.parse(q, p)
+		}(q, in.newParser(channels))
+	}
+
+	written := make(chan struct{})
+	go func() {
+		in.write()
+		close(written)
+	}()
+
+	err := in.read()
+
+	// Drain the pipeline one stage at a time
+	for _, q := range in.parseq {
+		close(q)
+	}
+	wg.Wait()
+	close(in.writeq)
+	<-written
+
+	return err
+}
+
+// read is the reader stage, which passes datagrams on to the parser workers
+func (in *Ingester) read() error {
+	b := make([]byte, bufSize)
+	backoff := in.MinBackoff
+	var retries int
+
+	for {
+		n, _, err := in.conn.ReadFrom(b)
+		if errors.Is(err, net.ErrClosed) {
+			return nil
+		} else if err != nil {
+			retries++
+			if retries > in.MaxRetries {
+				return &readError{err: err, retries: in.MaxRetries}
+			}
+
+			time.Sleep(backoff)
+			backoff *= 2
+			if backoff > in.MaxBackoff {
+				backoff = in.MaxBackoff
+			}
+			continue
+		}
+
+		retries = 0
+		backoff = in.MinBackoff
+		start := time.Now()
+		atomic.AddUint64(&in.received, 1)
+
+		raw := bytes.TrimRight(b[:n], "\r\n")
+
+		// A full buffer means the datagram may have been truncated
+		if n == bufSize {
+			atomic.AddUint64(&in.reader.dropped, 1)
+			atomic.AddUint64(&in.dropped, 1)
+			in.reject(string(raw), errTruncated)
+			continue
+		}
+
+		// The buffer is reused for the next datagram
+		raw = append([]byte(nil), raw...)
+
+		q := in.parseq[hashIP(raw, in.Schema)%uint32(len(in.parseq))]
+		in.drop(&in.parser, push(q, event{raw: raw, queued: time.Now()}, in.Overflow))
+		in.reader.done(time.Time{}, start)
+	}
+}
+
+// parse is a parser worker, which passes parsed events on to the writer. p is
+// the worker's parser, or nil if the schema is not laid out like ZapBox 2013.
+func (in *Ingester) parse(q chan event, p *zap.Parser) {
+	for e := range q {
+		start := time.Now()
+
+		var out event
+		isZap, err := in.parseEvent(p, e.raw, &out.zCh, &out.ztat)
+		if err != nil {
+			atomic.AddUint64(&in.rejected, 1)
+			in.reject(string(e.raw), err)
+		} else {
+			atomic.AddUint64(&in.parsed, 1)
+			out.isZap = isZap
+			out.queued = time.Now()
+			in.drop(&in.writer, push(in.writeq, out, in.Overflow))
+		}
+
+		in.parser.done(e.queued, start)
+	}
+}
+
+// write is the writer stage, which hands the events to the handler
+func (in *Ingester) write() {
+	// The handler gets pointers to these, so they are reused rather than
+	// allocated for every event
+	var zCh zap.ChZap
+	var ztat zap.StatusChange
+
+	for e := range in.writeq {
+		start := time.Now()
+		if e.isZap {
+			zCh = e.zCh
+			in.handle(&zCh, nil)
+		} else {
+			ztat = e.ztat
+			in.handle(nil, &ztat)
+		}
+		in.writer.done(e.queued, start)
+	}
+}
+
+// drop counts the events discarded by a stage's input queue
+func (in *Ingester) drop(m *stageMetrics, n uint64) {
+	if n > 0 {
+		atomic.AddUint64(&m.dropped, n)
+		atomic.AddUint64(&in.dropped, n)
+	}
+}
+
+func (in *Ingester) reject(event string, err error) {
+	if in.sink != nil {
+		in.sink.Reject(event, err)
+	}
+}
+
+// Stats returns the current event counters. It is safe to call while Run is active.
+func (in *Ingester) Stats() Stats {
+	return Stats{
+		Received: atomic.LoadUint64(&in.received),
+		Parsed:   atomic.LoadUint64(&in.parsed),
+		Rejected: atomic.LoadUint64(&in.rejected),
+		Dropped:  atomic.LoadUint64(&in.dropped),
+	}
+}
+
+// Stages returns the metrics of the reader, parser and writer stages. It is
+// safe to call while Run is active.
+func (in *Ingester) Stages() []StageStats {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+
+	var uptime time.Duration
+	if !in.started.IsZero() {
+		uptime = time.Since(in.started)
+	}
+
+	var parseLen int
+	for _, q := range in.parseq {
+		parseLen += len(q)
+	}
+
+	return []StageStats{
+		in.reader.stats(0, uptime),
+		in.parser.stats(parseLen, uptime),
+		in.writer.stats(len(in.writeq), uptime),
+	}
+}
+
+// newParser returns a parser for the ingester's schema, or nil if the schema is
+// not laid out like ZapBox 2013
+func (in *Ingester) newParser(channels *zap.ChannelTable) *zap.Parser {
+	s := in.Schema
+	if s == nil {
+		s = zap.ZapBox2013
+	}
+	p, err := zap.NewParser(s, channels)
+	if err != nil {
+		return nil
+	}
+	return p
+}
+
+// parseEvent parses an event with the ingester's schema into zCh or ztat, and
+// reports which, like Parser.ParseSTBEventBytes
+func (in *Ingester) parseEvent(p *zap.Parser, raw []byte, zCh *zap.ChZap, ztat *zap.StatusChange) (bool, error) {
+	// Without a schema events are parsed like NewSTBEvent, which rejects short
+	// events the parser would accept
+	if p != nil && (in.Schema != nil || len(raw) >= zap.MinEventLen) {
+		return p.ParseSTBEventBytes(raw, zCh, ztat)
+	}
+
+	var z *zap.ChZap
+	var s *zap.StatusChange
+	var err error
+	if in.Schema == nil {
+		z, s, err = zap.NewSTBEvent(string(raw))
+	} else {
+		z, s, err = in.Schema.Parse(string(raw))
+	}
+
+	switch {
+	case err != nil:
+		return false, err
+	case z != nil:
+		*zCh = *z
+		return true, nil
+	}
+	*ztat = *s
+	return false, nil
+}
+
+// hashIP hashes the IP field of a raw event (FNV-1a), or the whole event if its
+// IP cannot be found. A nil schema stands for ZapBox2013.
+func hashIP(raw []byte, s *zap.Schema) uint32 {
+	if s == nil {
+		s = zap.ZapBox2013
+	}
+	ip := s.IPBytes(raw)
+	if ip == nil {
+		ip = raw
+	}
+
+	h := uint32(2166136261)
+	for i := 0; i < len(ip); i++ {
+		h ^= uint32(ip[i])
+		h *= 16777619
+	}
+	return h
+}
+
+var errTruncated = fmt.Errorf("datagram fills the %v byte buffer and may be truncated", bufSize)
+
+type readError struct {
+	err     error
+	retries int
+}
+
+func (e *readError) Error() string {
+	return fmt.Sprintf("Ingester gave up reading after %v retries: %v", e.retries, e.err)
+}
+
+func (e *readError) Unwrap() error {
+	return e.err
+}
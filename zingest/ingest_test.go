@@ -0,0 +1,242 @@
+package zingest
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	zap ".."
+)
+
+// fakeConn returns the queued datagrams or errors, and net.ErrClosed when empty
+type fakeConn struct {
+	net.PacketConn
+	reads []interface{}
+}
+
+func (fc *fakeConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	if len(fc.reads) == 0 {
+		return 0, nil, net.ErrClosed
+	}
+
+	r := fc.reads[0]
+	fc.reads = fc.reads[1:]
+
+	if err, ok := r.(error); ok {
+		return 0, nil, err
+	}
+	return copy(b, r.(string)), nil, nil
+}
+
+var errTransient = errors.New("transient")
+
+func TestIngesterRun(t *testing.T) {
+	conn := &fakeConn{reads: []interface{}{
+		"2013/07/20, 21:56:55, 111.229.208.129, MAX, Viasat 4",
+		errTransient,
+		"garbage",
+		"2013/07/20, 21:57:42, 203.124.29.72, Volume: 50\n",
+		errTransient,
+		"2013/07/20, 21:57:42, 203.124.29.72, Volume: 500",
+	}}
+
+	var zaps, statuses int
+	handle := func(zCh *zap.ChZap, ztat *zap.StatusChange) {
+		if zCh != nil {
+			zaps++
+		} else {
+			statuses++
+		}
+	}
+
+	ring := NewRingBuffer(10)
+	in := New(conn, handle, ring)
+	in.MinBackoff = time.Millisecond
+
+	if err := in.Run(); err != nil {
+		t.Fatalf("Run() => %v, want nil", err)
+	}
+
+	want := Stats{Received: 4, Parsed: 2, Rejected: 2}
+	if got := in.Stats(); got != want {
+		t.Errorf("Stats() => %v, want %v", got, want)
+	}
+	if zaps != 1 || statuses != 1 {
+		t.Errorf("handled %v zaps and %v status changes, want 1 and 1", zaps, statuses)
+	}
+
+	rejected := ring.Entries()
+	if len(rejected) != 2 || rejected[0].Event != "garbage" {
+		t.Errorf("Entries() => %v, want 'garbage' and the out-of-range volume", rejected)
+	}
+}
+
+func TestIngesterFatal(t *testing.T) {
+	conn := &fakeConn{reads: []interface{}{errTransient, errTransient, errTransient}}
+
+	in := New(conn, func(*zap.ChZap, *zap.StatusChange) {}, nil)
+	in.MinBackoff = time.Millisecond
+	in.MaxRetries = 2
+
+	err := in.Run()
+	if !errors.Is(err, errTransient) {
+		t.Errorf("Run() => %v, want error wrapping %v", err, errTransient)
+	}
+}
+
+func TestRingBuffer(t *testing.T) {
+	ring := NewRingBuffer(3)
+	for _, event := range []string{"a", "b", "c", "d", "e"} {
+		ring.Reject(event, errTransient)
+	}
+
+	entries := ring.Entries()
+	if len(entries) != 3 || entries[0].Event != "c" || entries[2].Event != "e" {
+		t.Errorf("Entries() => %v, want c, d, e", entries)
+	}
+}
+
+func TestIngesterOrdering(t *testing.T) {
+	ips := []string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.4", "10.0.0.5"}
+	start := time.Date(2013, 7, 20, 18, 0, 0, 0, time.UTC)
+
+	conn := &fakeConn{}
+	for i := 0; i < 2000; i++ {
+		ts := start.Add(time.Duration(i) * time.Second).Format("2006/01/02, 15:04:05")
+		conn.reads = append(conn.reads, ts+", "+ips[i%len(ips)]+", NRK1, NRK2")
+	}
+
+	last := make(map[string]time.Time)
+	var outOfOrder int
+	handle := func(zCh *zap.ChZap, ztat *zap.StatusChange) {
+		if zCh.Time.Before(last[zCh.IP]) {
+			outOfOrder++
+		}
+		last[zCh.IP] = zCh.Time
+	}
+
+	in := New(conn, handle, nil)
+	in.Workers = 4
+	in.QueueSize = 8
+
+	if err := in.Run(); err != nil {
+		t.Fatalf("Run() => %v, want nil", err)
+	}
+	if outOfOrder > 0 {
+		t.Errorf("%v events reached the handler out of order", outOfOrder)
+	}
+
+	stages := in.Stages()
+	for _, s := range stages {
+		if s.Processed != 2000 || s.Dropped != 0 || s.Queued != 0 {
+			t.Errorf("Stages() => %v, want 2000 processed and none dropped or queued", s)
+		}
+	}
+}
+
+// firmware2 lays events out differently from ZapBox 2013, so the ingester
+// parses them with the schema rather than a zap.Parser
+var firmware2 = &zap.Schema{Name: "Firmware 2", Separator: ";", StatusSeparator: "=",
+	Zap:        []zap.Field{zap.FieldTimestamp, zap.FieldIP, zap.FieldSkip, zap.FieldFromChan, zap.FieldToChan},
+	Status:     []zap.Field{zap.FieldTimestamp, zap.FieldIP, zap.FieldSkip, zap.FieldStatus},
+	TimeLayout: "2006-01-02T15:04:05", TimeZone: "Europe/Oslo"}
+
+var schematests = []struct {
+	schema *zap.Schema
+	event  string
+	zap    bool
+	parsed bool
+}{
+	{nil, "2013/07/20, 21:56:55, 111.229.208.129, MAX, Viasat 4", true, true},
+	{nil, "2013/07/20, 21:57:42, 203.124.29.72, Volume: 50", false, true},
+	// NewSTBEvent rejects events this short
+	{nil, "2013/7/2, 9:5:3, 1.2.3.4, A,B", true, false},
+	{zap.ZapBox2013, "2013/7/2, 9:5:3, 1.2.3.4, A,B", true, true},
+	{firmware2, "2013-07-20T21:56:13; 10.0.0.1; v2.1; NRK1; TV2 Norge", true, true},
+	{firmware2, "2013-07-20T21:56:13; 10.0.0.1; v2.1; Volume=30", false, true},
+	{firmware2, "2013/07/20, 21:56:55, 111.229.208.129, MAX, Viasat 4", true, false},
+}
+
+func TestIngesterSchemas(t *testing.T) {
+	for _, tt := range schematests {
+		want, wantStatus, err := zap.NewSTBEvent(tt.event)
+		if tt.schema != nil {
+			want, wantStatus, err = tt.schema.Parse(tt.event)
+		}
+		if (err == nil) != tt.parsed {
+			t.Fatalf("%q: parse error %v, want parsed %v", tt.event, err, tt.parsed)
+		}
+
+		var handled int
+		handle := func(zCh *zap.ChZap, ztat *zap.StatusChange) {
+			handled++
+			switch {
+			case (zCh != nil) != tt.zap:
+				t.Errorf("%q: handled (%v, %v), want zap %v", tt.event, zCh, ztat, tt.zap)
+			case zCh != nil:
+				if !zCh.Time.Equal(want.Time) || zCh.IP != want.IP || zCh.ToChan != want.ToChan || zCh.FromChan != want.FromChan {
+					t.Errorf("%q: handled %v, want %v", tt.event, zCh, want)
+				}
+			default:
+				if !ztat.Time.Equal(wantStatus.Time) || ztat.IP != wantStatus.IP || ztat.Kind != wantStatus.Kind || ztat.Value != wantStatus.Value {
+					t.Errorf("%q: handled %v, want %v", tt.event, ztat, wantStatus)
+				}
+			}
+		}
+
+		in := New(&fakeConn{reads: []interface{}{tt.event}}, handle, nil)
+		in.Schema = tt.schema
+		if err := in.Run(); err != nil {
+			t.Fatalf("%q: Run() => %v", tt.event, err)
+		}
+		if parsed := handled == 1; parsed != tt.parsed {
+			t.Errorf("%q: handled %v events, want parsed %v", tt.event, handled, tt.parsed)
+		}
+	}
+}
+
+// BenchmarkIngester measures the pipeline from datagram to handler. Reading
+// copies each datagram out of the buffer, and parsing should not allocate.
+func BenchmarkIngester(b *testing.B) {
+	events := []string{
+		"2013/07/20, 21:56:13, 252.126.91.56, NRK1, TV2 Norge",
+		"2013/07/20, 21:56:14, 10.0.0.1, TV2 Norge, NRK1",
+		"2013/07/20, 21:57:42, 203.124.29.72, Volume: 50",
+	}
+	conn := &fakeConn{reads: make([]interface{}, b.N)}
+	for i := range conn.reads {
+		conn.reads[i] = events[i%len(events)]
+	}
+
+	in := New(conn, func(*zap.ChZap, *zap.StatusChange) {}, nil)
+	b.ReportAllocs()
+	b.ResetTimer()
+	if err := in.Run(); err != nil {
+		b.Fatal(err)
+	}
+}
+
+var pushtests = []struct {
+	policy  Policy
+	dropped uint64
+	first   string
+}{
+	{DropNewest, 1, "a"},
+	{DropOldest, 1, "b"},
+}
+
+func TestPushOverflow(t *testing.T) {
+	for _, tt := range pushtests {
+		q := make(chan event, 2)
+		push(q, event{raw: []byte("a")}, tt.policy)
+		push(q, event{raw: []byte("b")}, tt.policy)
+
+		if n := push(q, event{raw: []byte("c")}, tt.policy); n != tt.dropped {
+			t.Errorf("push() with %v => %v dropped, want %v", tt.policy, n, tt.dropped)
+		}
+		if e := <-q; string(e.raw) != tt.first {
+			t.Errorf("push() with %v => queue starts with %q, want %q", tt.policy, e.raw, tt.first)
+		}
+	}
+}
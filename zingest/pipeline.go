@@ -0,0 +1,142 @@
+package zingest
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	zap ".."
+)
+
+// Policy decides what happens when an event arrives at a full queue
+type Policy int
+
+// Overflow policies
+const (
+	// Block waits for room in the queue, pushing back on the previous stage
+	Block Policy = iota
+	// DropOldest discards the oldest queued event to make room
+	DropOldest
+	// DropNewest discards the arriving event
+	DropNewest
+)
+
+var policyNames = []string{"block", "drop-oldest", "drop-newest"}
+
+func (p Policy) String() string {
+	if int(p) < len(policyNames) {
+		return policyNames[p]
+	}
+	return "unknown"
+}
+
+// ParsePolicy returns the policy with the given name
+func ParsePolicy(name string) (Policy, error) {
+	for i, n := range policyNames {
+		if n == name {
+			return Policy(i), nil
+		}
+	}
+	return Block, fmt.Errorf("ParsePolicy: unknown overflow policy '%v'", name)
+}
+
+// StageStats holds the metrics of a pipeline stage
+type StageStats struct {
+	Name string
+	// Processed is the number of events the stage has finished
+	Processed uint64
+	// Dropped is the number of events discarded by the stage's input queue
+	Dropped uint64
+	// Queued is the current length of the stage's input queue
+	Queued int
+	// Wait is the mean time events spent in the input queue
+	Wait time.Duration
+	// Latency is the mean time the stage spent on each event
+	Latency time.Duration
+	// Rate is the mean number of events processed per second since start
+	Rate float64
+}
+
+func (s StageStats) String() string {
+	return fmt.Sprintf("%v: processed %v (%.1f/s), dropped %v, queued %v, wait %v, latency %v",
+		s.Name, s.Processed, s.Rate, s.Dropped, s.Queued, s.Wait, s.Latency)
+}
+
+// stageMetrics collects the metrics of a stage. Durations are in nanoseconds.
+type stageMetrics struct {
+	name      string
+	processed uint64
+	dropped   uint64
+	wait      int64
+	busy      int64
+}
+
+// done records an event that was queued at queued, taken from the queue at
+// start, and finished now
+func (m *stageMetrics) done(queued, start time.Time) {
+	atomic.AddUint64(&m.processed, 1)
+	atomic.AddInt64(&m.busy, int64(time.Since(start)))
+	if !queued.IsZero() {
+		atomic.AddInt64(&m.wait, int64(start.Sub(queued)))
+	}
+}
+
+func (m *stageMetrics) stats(queued int, uptime time.Duration) StageStats {
+	s := StageStats{
+		Name:      m.name,
+		Processed: atomic.LoadUint64(&m.processed),
+		Dropped:   atomic.LoadUint64(&m.dropped),
+		Queued:    queued,
+	}
+
+	if s.Processed > 0 {
+		s.Wait = time.Duration(atomic.LoadInt64(&m.wait) / int64(s.Processed))
+		s.Latency = time.Duration(atomic.LoadInt64(&m.busy) / int64(s.Processed))
+	}
+	if uptime > 0 {
+		s.Rate = float64(s.Processed) / uptime.Seconds()
+	}
+
+	return s
+}
+
+// event is an event on its way through the pipeline. Parsed events are held by
+// value, so that passing them on does not allocate.
+type event struct {
+	raw    []byte
+	isZap  bool
+	zCh    zap.ChZap
+	ztat   zap.StatusChange
+	queued time.Time
+}
+
+// push adds an event to a bounded queue according to the overflow policy, and
+// returns the number of events that were discarded
+func push(q chan event, e event, policy Policy) uint64 {
+	switch policy {
+	case DropNewest:
+		select {
+		case q <- e:
+			return 0
+		default:
+			return 1
+		}
+	case DropOldest:
+		var dropped uint64
+		for {
+			select {
+			case q <- e:
+				return dropped
+			default:
+				select {
+				case <-q:
+					dropped++
+				default:
+				}
+			}
+		}
+	}
+
+	q <- e
+	return 0
+}
@@ -14,21 +14,15 @@ import (
 
 // AdvancedZapLogger pairs ips and zaps, channels and stats, and channels and
 // viewer counts
-// TODO read/write specific locks for reduced blocking
 type AdvancedZapLogger struct {
-	ipMap   map[string]zap.ChZap
-	stats   map[string]ZapStats
-	chanMap ZapsMap
-	mu      sync.Mutex
+	zapState
+	mu sync.RWMutex
 }
 
 // NewAdvancedZapLogger creates an advanced zap logger
 func NewAdvancedZapLogger() ZapLogger {
 	advLogger := new(AdvancedZapLogger)
-	// TODO consistent field types
-	advLogger.chanMap = make(ZapsMap)
-	advLogger.ipMap = make(map[string]zap.ChZap)
-	advLogger.stats = make(map[string]ZapStats)
+	advLogger.zapState = newZapState()
 	return advLogger
 }
 
@@ -38,39 +32,117 @@ func (azl *AdvancedZapLogger) LogZap(z zap.ChZap) {
 	azl.mu.Lock()
 	defer azl.mu.Unlock()
 
-	// Increment viewer count for a given channel in the chanMap
-	azl.chanMap[z.ToChan]++
+	azl.logZap(z)
+}
+
+// zapState holds the maps of the advanced logger. It does no locking of its own,
+// so that loggers can protect it as they see fit.
+type zapState struct {
+	boxes    boxTracker
+	stats    map[string]*durationStats
+	chanMap  ChannelCounts
+	watching ChannelCounts
+
+	// Number of boxes whose latest zap was not to OFF
+	on int
+}
+
+func newZapState() zapState {
+	return zapState{
+		chanMap:  make(ChannelCounts),
+		watching: make(ChannelCounts),
+		boxes:    newBoxTracker(),
+		stats:    make(map[string]*durationStats),
+	}
+}
 
-	// IP exists in map; log duration and decrement view for the zap's FromChan
-	if _, ok := azl.ipMap[z.IP]; ok {
-		azl.logDuration(z)
+func (zs *zapState) logZap(z zap.ChZap) {
+	// Increment viewer count for a given channel in the chanMap. OFF is a
+	// power state and is not counted as a channel.
+	if z.ToChan != zap.Off {
+		zs.chanMap[z.ToChan]++
+		zs.on++
+	}
 
-		// Decrement viewer count based on the zap event's 'FromChan' channel
-		azl.chanMap[z.FromChan]--
+	// Log duration and decrement view for the channel the box was counted on.
+	// Boxes seen for the first time were not counted anywhere, and time spent
+	// turned off is not a view.
+	m := zs.boxes.track(z)
+	if m.from != zap.Off {
+		zs.logDuration(z, m.prev)
 
-		// IP is not in map; add new IP key and zap value
-	} else {
-		azl.ipMap[z.IP] = z
+		zs.chanMap[m.from]--
+		zs.on--
 	}
+
+	zs.watching.move(m.watchFrom, m.watchTo)
 }
 
-func (azl *AdvancedZapLogger) logDuration(z zap.ChZap) {
-	dur := z.Duration(azl.ipMap[z.IP])
+// logStatus moves the box between the watching counts when its TV is turned
+// on or off
+func (zs *zapState) logStatus(s zap.StatusChange) {
+	zs.watching.move(zs.boxes.hdmi(s))
+}
+
+// logDuration logs the time since the box's previous zap as a view of the
+// zap's FromChan
+func (zs *zapState) logDuration(z, prev zap.ChZap) {
+	if z.FromChan == zap.Off {
+		return
+	}
+
+	dur := z.Duration(prev)
 
 	// Ignore "flip-through" views
 	if dur > minDur {
-		if stats, ok := azl.stats[z.FromChan]; ok {
-			// Channel exists in map; calculate a new average
-			stats.SampleSize = stats.SampleSize + 1
-			stats.AvgDur += (dur / time.Duration(stats.SampleSize))
-			azl.stats[z.FromChan] = stats
-		} else {
-			// Channel does not exist in map; initialize new key and value
-			// stats := (ZapStats{SampleSize: 1, AvgDur: dur})
-			azl.stats[z.FromChan] = ZapStats{SampleSize: 1, AvgDur: dur}
+		stats, ok := zs.stats[z.FromChan]
+		if !ok {
+			stats = newDurationStats()
+			zs.stats[z.FromChan] = stats
 		}
+		stats.add(dur)
+	}
+}
 
+// summaries returns the duration statistics of every channel
+func (zs *zapState) summaries() map[string]ZapStats {
+	stats := make(map[string]ZapStats, len(zs.stats))
+	for k, v := range zs.stats {
+		stats[k] = v.summary()
 	}
+	return stats
+}
+
+// LogStatus adds a status change to the log. Only HDMI_Status is used.
+func (azl *AdvancedZapLogger) LogStatus(s zap.StatusChange) {
+	azl.mu.Lock()
+	defer azl.mu.Unlock()
+
+	azl.logStatus(s)
+}
+
+// Watching returns the number of viewers of a given channel with their TV on
+func (azl *AdvancedZapLogger) Watching(chName string) int {
+	azl.mu.RLock()
+	defer azl.mu.RUnlock()
+
+	return azl.watching[chName]
+}
+
+// PoweredOn returns the number of boxes whose latest zap was not to OFF
+func (azl *AdvancedZapLogger) PoweredOn() int {
+	azl.mu.RLock()
+	defer azl.mu.RUnlock()
+
+	return azl.on
+}
+
+// Coverage tells how much of the audience the viewer counts are based on
+func (azl *AdvancedZapLogger) Coverage() Coverage {
+	azl.mu.RLock()
+	defer azl.mu.RUnlock()
+
+	return azl.boxes.coverage()
 }
 
 // Entries returns the number of channels in the log set
@@ -79,6 +151,9 @@ func (azl *AdvancedZapLogger) Entries() int {
 		defer zap.TimeElapsed(time.Now(), azl.String()+".Entries")
 	}
 
+	azl.mu.RLock()
+	defer azl.mu.RUnlock()
+
 	return len(azl.chanMap)
 }
 
@@ -93,6 +168,9 @@ func (azl *AdvancedZapLogger) Viewers(chName string) int {
 		defer zap.TimeElapsed(time.Now(), azl.String()+".Viewers")
 	}
 
+	azl.mu.RLock()
+	defer azl.mu.RUnlock()
+
 	return azl.chanMap[chName]
 }
 
@@ -102,6 +180,9 @@ func (azl *AdvancedZapLogger) Channels() []string {
 		defer zap.TimeElapsed(time.Now(), azl.String()+".Channels")
 	}
 
+	azl.mu.RLock()
+	defer azl.mu.RUnlock()
+
 	channels := make([]string, 0, len(azl.chanMap))
 
 	for k := range azl.chanMap {
@@ -113,26 +194,19 @@ func (azl *AdvancedZapLogger) Channels() []string {
 
 // ChannelsViewers creates a slice of ChannelViewers which is defined in zaplogger.go.
 // This is the number of viewers for each channel.
-// A positive non-zero input argument will return the given amount of elements, while a negative argument will return all elements in
-// the list.
 func (azl *AdvancedZapLogger) ChannelsViewers() []*ChannelViewers {
-	var ChanViewersList []*ChannelViewers
-
 	if PrintTimes {
 		defer zap.TimeElapsed(time.Now(), azl.String()+".ChannelsViewers")
 	}
 
-	for key, value := range azl.chanMap { // This is a risky read if there is a concurrent write to the map
-		chanViews := ChannelViewers{key, value}
-		ChanViewersList = append(ChanViewersList, &chanViews)
-	}
+	azl.mu.RLock()
+	defer azl.mu.RUnlock()
 
-	return ChanViewersList
+	return azl.chanMap.channelsViewers(azl.watching)
 }
 
 // FetchSorted returns a list of channels and viewers, sorted by viewers
-// A positive non-zero input argument will return the given amount of elements, while a negative argument will return all elements in
-// the list.
+// At most i elements are returned.
 func (azl *AdvancedZapLogger) FetchSorted(i uint8) ChanViewersList {
 	var bv ByViewers
 
@@ -140,10 +214,10 @@ func (azl *AdvancedZapLogger) FetchSorted(i uint8) ChanViewersList {
 		defer zap.TimeElapsed(time.Now(), azl.String()+".FetchSorted")
 	}
 
-	azl.mu.Lock()
-	defer azl.mu.Unlock()
+	azl.mu.RLock()
+	bv.ChanViewersList = azl.chanMap.channelsViewers(azl.watching)
+	azl.mu.RUnlock()
 
-	bv.ChanViewersList = azl.ChannelsViewers()
 	sort.Sort(sort.Reverse(ByViewers(bv)))
 
 	if bv.ChanViewersList.Len() > int(i) {
@@ -154,15 +228,14 @@ func (azl *AdvancedZapLogger) FetchSorted(i uint8) ChanViewersList {
 }
 
 // FetchStats returns a map of channel and Zapstat pairs
-// A positive non-zero input argument will return the given amount of elements, while a negative argument will return all elements in
-// the list.
 func (azl *AdvancedZapLogger) FetchStats() *map[string]ZapStats {
 	if PrintTimes {
 		defer zap.TimeElapsed(time.Now(), azl.String()+".FetchStats")
 	}
 
-	azl.mu.Lock()
-	defer azl.mu.Unlock()
+	azl.mu.RLock()
+	defer azl.mu.RUnlock()
 
-	return &azl.stats
+	stats := azl.summaries()
+	return &stats
 }
@@ -0,0 +1,154 @@
+// Cold-start reconciliation
+
+package zlog
+
+import (
+	"fmt"
+
+	zap "../"
+)
+
+// Coverage tells how much of the audience a logger's viewer counts are based
+// on. A logger started in the middle of the day only knows the channel of a box
+// once the box has zapped, so the counts start out low and catch up as more
+// boxes are seen.
+type Coverage struct {
+	// Boxes is the number of boxes seen so far
+	Boxes int
+	// UnknownOrigin is the number of boxes first seen zapping away from a
+	// channel, ie. boxes that were already watching when logging started.
+	// Their first zap is not subtracted from any channel.
+	UnknownOrigin int
+	// Ratio estimates the share of zaps that come from boxes which have
+	// already been seen, from 0 right after a cold start towards 1 once the
+	// logger has warmed up. Boxes that never zap are not part of the estimate.
+	Ratio float64
+}
+
+func (c Coverage) String() string {
+	return fmt.Sprintf("%.1f%% (%v boxes, %v of unknown origin)", c.Ratio*100, c.Boxes, c.UnknownOrigin)
+}
+
+// trackedBox holds the latest zap of a box and the number of zaps it has made
+type trackedBox struct {
+	last zap.ChZap
+	zaps uint32
+	// tvOff is set while the box reports that its TV is turned off or
+	// disconnected, see HDMI_Status
+	tvOff bool
+}
+
+// boxTracker keeps the current channel of every box seen, so that viewer counts
+// only include boxes with a known channel and never subtract a viewer which
+// was not counted. It does no locking of its own.
+//
+// Unlike the SessionTracker, which ends a viewing span after a timeout, it
+// never forgets a box. Boxes send nothing while their viewers stay on a
+// channel, so a box that is quiet for hours is still a viewer, and expiring it
+// would take the longest viewers out of the counts. The boxes kept are bounded
+// by the set-top boxes in the network rather than by the number of events.
+type boxTracker struct {
+	boxes map[string]*trackedBox
+
+	zaps    int
+	once    int
+	unknown int
+}
+
+// move tells which channels a zap moves a box between, where OFF stands for no
+// channel. A box is watching while it is tuned to a channel and its TV is on.
+type move struct {
+	// prev is the box's previous zap, if it has been seen before
+	prev zap.ChZap
+	seen bool
+
+	from, to           string
+	watchFrom, watchTo string
+}
+
+func newBoxTracker() boxTracker {
+	return boxTracker{boxes: make(map[string]*trackedBox)}
+}
+
+// track records the zap and returns the channels it moves the box between.
+// Boxes seen for the first time were not counted on any channel, and are
+// taken to have their TV on.
+func (bt *boxTracker) track(z zap.ChZap) move {
+	bt.zaps++
+
+	m := move{from: zap.Off, to: z.ToChan, watchFrom: zap.Off, watchTo: z.ToChan}
+
+	b, ok := bt.boxes[z.IP]
+	if !ok {
+		b = new(trackedBox)
+		bt.boxes[z.IP] = b
+		bt.once++
+		if z.FromChan != zap.Off {
+			bt.unknown++
+		}
+	} else {
+		m.prev, m.seen = b.last, true
+		m.from = b.last.ToChan
+		if !b.tvOff {
+			m.watchFrom = m.from
+		}
+		if b.zaps == 1 {
+			bt.once--
+		}
+	}
+
+	// A box being turned on is also connected to a TV, unless it says otherwise
+	if z.FromChan == zap.Off {
+		b.tvOff = false
+	}
+	if b.tvOff {
+		m.watchTo = zap.Off
+	}
+
+	b.last = z
+	b.zaps++
+	return m
+}
+
+// hdmi records an HDMI status change and returns the channels it moves the box
+// between in the watching counts. Boxes that have not zapped yet are ignored,
+// since their channel is not known.
+func (bt *boxTracker) hdmi(s zap.StatusChange) (from, to string) {
+	from, to = zap.Off, zap.Off
+
+	b, ok := bt.boxes[s.IP]
+	if !ok || s.Kind != zap.StatusHDMI {
+		return from, to
+	}
+
+	tvOff := s.Value == 0
+	if tvOff == b.tvOff {
+		return from, to
+	}
+	b.tvOff = tvOff
+
+	if tvOff {
+		return b.last.ToChan, to
+	}
+	return from, b.last.ToChan
+}
+
+// move moves a viewer from one channel to another, where OFF is no channel
+func (zm ChannelCounts) move(from, to string) {
+	if to != zap.Off {
+		zm[to]++
+	}
+	if from != zap.Off {
+		zm[from]--
+	}
+}
+
+// coverage estimates the coverage from the number of boxes seen only once, the
+// Good-Turing estimate of the chance that the next zap comes from a new box
+func (bt *boxTracker) coverage() Coverage {
+	c := Coverage{Boxes: len(bt.boxes), UnknownOrigin: bt.unknown}
+	if bt.zaps > 0 {
+		c.Ratio = 1 - float64(bt.once)/float64(bt.zaps)
+	}
+	return c
+}
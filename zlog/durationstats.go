@@ -0,0 +1,164 @@
+// Viewing duration statistics
+
+package zlog
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// sketchAccuracy is the relative error of the quantiles estimated by a DurationSketch
+const sketchAccuracy = 0.01
+
+// sketchGamma is the ratio between the bounds of a sketch bucket
+var sketchGamma = (1 + sketchAccuracy) / (1 - sketchAccuracy)
+
+// DurationSketch estimates quantiles of a set of durations. Durations are
+// counted in buckets whose bounds grow exponentially, so that every estimate
+// is within sketchAccuracy of the true quantile no matter how long the
+// durations are. Sketches of different sets can be merged, which gives the
+// same result as sketching the combined set.
+type DurationSketch struct {
+	buckets map[int]uint64
+	count   uint64
+}
+
+// NewDurationSketch creates an empty sketch
+func NewDurationSketch() *DurationSketch {
+	return &DurationSketch{buckets: make(map[int]uint64)}
+}
+
+// Add adds a duration to the sketch. Durations shorter than a nanosecond are
+// counted as one nanosecond.
+func (ds *DurationSketch) Add(d time.Duration) {
+	if d < 1 {
+		d = 1
+	}
+	ds.buckets[int(math.Ceil(math.Log(float64(d))/math.Log(sketchGamma)))]++
+	ds.count++
+}
+
+// Merge adds the durations counted by another sketch
+func (ds *DurationSketch) Merge(other *DurationSketch) {
+	for k, n := range other.buckets {
+		ds.buckets[k] += n
+	}
+	ds.count += other.count
+}
+
+// Count returns the number of durations in the sketch
+func (ds *DurationSketch) Count() uint64 {
+	return ds.count
+}
+
+// Quantile returns an estimate of the q-quantile, where q is between 0 and 1.
+// An empty sketch returns zero.
+func (ds *DurationSketch) Quantile(q float64) time.Duration {
+	if ds.count == 0 {
+		return 0
+	}
+
+	keys := make([]int, 0, len(ds.buckets))
+	for k := range ds.buckets {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+
+	rank := uint64(q * float64(ds.count-1))
+	var seen uint64
+	for _, k := range keys {
+		seen += ds.buckets[k]
+		if seen > rank {
+			// The midpoint of the bucket, in terms of relative error
+			return time.Duration(2 * math.Pow(sketchGamma, float64(k)) / (1 + sketchGamma))
+		}
+	}
+
+	return 0
+}
+
+// Copy returns a copy of the sketch
+func (ds *DurationSketch) Copy() *DurationSketch {
+	c := NewDurationSketch()
+	c.Merge(ds)
+	return c
+}
+
+// durationStats accumulates the viewing durations of a channel. The mean and
+// variance are computed with Welford's method, which stays accurate over many
+// samples.
+type durationStats struct {
+	n      uint64
+	mean   float64 // nanoseconds
+	m2     float64 // sum of squared differences from the mean, in nanoseconds squared
+	min    time.Duration
+	max    time.Duration
+	sketch *DurationSketch
+}
+
+func newDurationStats() *durationStats {
+	return &durationStats{sketch: NewDurationSketch()}
+}
+
+// add adds a duration sample
+func (ds *durationStats) add(d time.Duration) {
+	ds.n++
+	delta := float64(d) - ds.mean
+	ds.mean += delta / float64(ds.n)
+	ds.m2 += delta * (float64(d) - ds.mean)
+
+	if ds.n == 1 || d < ds.min {
+		ds.min = d
+	}
+	if d > ds.max {
+		ds.max = d
+	}
+
+	ds.sketch.Add(d)
+}
+
+// merge adds the samples of another set of statistics
+func (ds *durationStats) merge(other *durationStats) {
+	if other.n == 0 {
+		return
+	}
+	if ds.n == 0 {
+		ds.min = other.min
+	}
+
+	n := ds.n + other.n
+	delta := other.mean - ds.mean
+	ds.m2 += other.m2 + delta*delta*float64(ds.n)*float64(other.n)/float64(n)
+	ds.mean += delta * float64(other.n) / float64(n)
+	ds.n = n
+
+	if other.min < ds.min {
+		ds.min = other.min
+	}
+	if other.max > ds.max {
+		ds.max = other.max
+	}
+
+	ds.sketch.Merge(other.sketch)
+}
+
+// summary returns the statistics as ZapStats
+func (ds *durationStats) summary() ZapStats {
+	var variance float64
+	if ds.n > 1 {
+		variance = ds.m2 / float64(ds.n-1)
+	}
+
+	return ZapStats{
+		AvgDur:     time.Duration(ds.mean),
+		SampleSize: uint32(ds.n),
+		Variance:   variance / float64(time.Second*time.Second),
+		StdDev:     time.Duration(math.Sqrt(variance)),
+		MinDur:     ds.min,
+		MaxDur:     ds.max,
+		P50:        ds.sketch.Quantile(0.5),
+		P90:        ds.sketch.Quantile(0.9),
+		P99:        ds.sketch.Quantile(0.99),
+	}
+}
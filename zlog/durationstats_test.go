@@ -0,0 +1,109 @@
+package zlog
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+	"time"
+
+	zap ".."
+)
+
+func TestDurationStats(t *testing.T) {
+	ds := newDurationStats()
+	for _, s := range []int{10, 20, 30, 40} {
+		ds.add(time.Duration(s) * time.Second)
+	}
+
+	got := ds.summary()
+	want := ZapStats{
+		AvgDur:     25 * time.Second,
+		SampleSize: 4,
+		Variance:   500.0 / 3,
+		MinDur:     10 * time.Second,
+		MaxDur:     40 * time.Second,
+	}
+
+	if got.AvgDur != want.AvgDur || got.SampleSize != want.SampleSize ||
+		got.MinDur != want.MinDur || got.MaxDur != want.MaxDur {
+		t.Errorf("summary() => %+v, want %+v", got, want)
+	}
+	if math.Abs(got.Variance-want.Variance) > 1e-9 {
+		t.Errorf("summary().Variance => %v, want %v", got.Variance, want.Variance)
+	}
+	if d := got.StdDev - time.Duration(math.Sqrt(want.Variance)*float64(time.Second)); d < -time.Microsecond || d > time.Microsecond {
+		t.Errorf("summary().StdDev => %v, want %v seconds", got.StdDev, math.Sqrt(want.Variance))
+	}
+}
+
+func TestDurationStatsMerge(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	a, b, all := newDurationStats(), newDurationStats(), newDurationStats()
+
+	for i := 0; i < 1000; i++ {
+		d := time.Duration(rng.ExpFloat64() * float64(time.Minute))
+		if i%3 == 0 {
+			a.add(d)
+		} else {
+			b.add(d)
+		}
+		all.add(d)
+	}
+	a.merge(b)
+
+	got, want := a.summary(), all.summary()
+	if got.SampleSize != want.SampleSize || got.MinDur != want.MinDur || got.MaxDur != want.MaxDur ||
+		got.P50 != want.P50 || got.P99 != want.P99 {
+		t.Errorf("merge() => %+v, want %+v", got, want)
+	}
+	if math.Abs(float64(got.AvgDur-want.AvgDur)) > 1 || math.Abs(got.Variance-want.Variance)/want.Variance > 1e-9 {
+		t.Errorf("merge() => mean %v variance %v, want mean %v variance %v",
+			got.AvgDur, got.Variance, want.AvgDur, want.Variance)
+	}
+}
+
+func TestDurationSketchAccuracy(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	sketch := NewDurationSketch()
+	samples := make([]float64, 10000)
+
+	for i := range samples {
+		d := time.Duration(rng.ExpFloat64() * float64(10*time.Minute))
+		samples[i] = float64(d)
+		sketch.Add(d)
+	}
+	sort.Float64s(samples)
+
+	for _, q := range []float64{0.5, 0.9, 0.99} {
+		want := samples[int(q*float64(len(samples)-1))]
+		got := float64(sketch.Quantile(q))
+		if math.Abs(got-want)/want > sketchAccuracy {
+			t.Errorf("Quantile(%v) => %v, want %v within %v", q, time.Duration(got), time.Duration(want), sketchAccuracy)
+		}
+	}
+}
+
+func TestAdvancedLoggerAverage(t *testing.T) {
+	start := time.Date(2013, 7, 20, 18, 0, 0, 0, time.UTC)
+	azl := NewAdvancedZapLogger()
+
+	// One viewer watches NRK1 for 10, 20 and 30 seconds in turn
+	at := start
+	azl.LogZap(zap.ChZap{Time: at, IP: "10.0.0.1", FromChan: "NRK2", ToChan: "NRK1"})
+	for _, s := range []int{10, 20, 30} {
+		at = at.Add(time.Duration(s) * time.Second)
+		azl.LogZap(zap.ChZap{Time: at, IP: "10.0.0.1", FromChan: "NRK1", ToChan: "NRK2"})
+		at = at.Add(time.Second)
+		azl.LogZap(zap.ChZap{Time: at, IP: "10.0.0.1", FromChan: "NRK2", ToChan: "NRK1"})
+	}
+
+	stats := (*azl.FetchStats())["NRK1"]
+	if stats.SampleSize != 3 || stats.AvgDur != 20*time.Second {
+		t.Errorf("FetchStats()[NRK1] => %v samples with average %v, want 3 with average 20s",
+			stats.SampleSize, stats.AvgDur)
+	}
+	if _, ok := (*azl.FetchStats())["NRK2"]; ok {
+		t.Errorf("FetchStats() has statistics for NRK2, whose views are all flip-throughs")
+	}
+}
@@ -0,0 +1,352 @@
+// Flow Zap logger
+
+package zlog
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	zap "../"
+)
+
+// MaxFlowChannels is the number of channels the flow logger tells apart. Zaps
+// to and from further channels are counted under OtherChannel, so that the
+// transition counts stay bounded however many channel names turn up.
+const MaxFlowChannels = 1000
+
+// OtherChannel stands for the channels beyond MaxFlowChannels
+const OtherChannel = "OTHER"
+
+// Transition is the number of zaps from one channel to another, where OFF
+// stands for boxes being turned on or off
+type Transition struct {
+	From string
+	To   string
+	Zaps int
+}
+
+func (t Transition) String() string {
+	return fmt.Sprintf("%v -> %v: %v", t.From, t.To, t.Zaps)
+}
+
+// flowKey is a pair of channel indexes, the source in the upper half
+type flowKey uint32
+
+func newFlowKey(from, to uint16) flowKey {
+	return flowKey(from)<<16 | flowKey(to)
+}
+
+func (k flowKey) from() uint16 { return uint16(k >> 16) }
+func (k flowKey) to() uint16   { return uint16(k) }
+
+// flowCounts holds the non-zero cells of a transition matrix
+type flowCounts map[flowKey]int
+
+// flowWindow holds the transitions of a tumbling window
+type flowWindow struct {
+	start  time.Time
+	counts flowCounts
+}
+
+// FlowZapLogger counts viewers like the advanced logger, and records where the
+// audiences go: a matrix of the number of zaps from each channel to each other,
+// both since the logger started and per time window. Time is event time, and
+// windows follow the local day, like in WindowStats. Windows are kept for a
+// limited period, and zaps older than that are only counted in the overall
+// matrix.
+//
+// The matrices are sparse, so they grow with the number of distinct transitions
+// rather than the square of the number of channels.
+type FlowZapLogger struct {
+	*AdvancedZapLogger
+
+	window time.Duration
+	retain int
+
+	// Channels are stored by index
+	ids   map[string]uint16
+	names []string
+
+	total   flowCounts
+	windows []*flowWindow // oldest first
+
+	mu sync.RWMutex
+}
+
+// NewFlowZapLogger creates a flow logger with time windows of the given size,
+// of which the latest retain are kept. A day of 15 minute windows is 96
+// windows.
+func NewFlowZapLogger(window time.Duration, retain int) (ZapLogger, error) {
+	if window < time.Second {
+		return nil, fmt.Errorf("NewFlowZapLogger: windows must be at least a second, got %v", window)
+	}
+	if retain < 1 {
+		return nil, fmt.Errorf("NewFlowZapLogger: must retain at least one window, got %v", retain)
+	}
+
+	return &FlowZapLogger{
+		AdvancedZapLogger: NewAdvancedZapLogger().(*AdvancedZapLogger),
+		window:            window,
+		retain:            retain,
+		ids:               make(map[string]uint16),
+		total:             make(flowCounts),
+	}, nil
+}
+
+// String returns the name of the logger
+func (fzl *FlowZapLogger) String() string {
+	return "Flow Logger"
+}
+
+// LogZap adds a zap to the log and counts its transition
+func (fzl *FlowZapLogger) LogZap(z zap.ChZap) {
+	fzl.AdvancedZapLogger.LogZap(z)
+
+	fzl.mu.Lock()
+	defer fzl.mu.Unlock()
+
+	k := newFlowKey(fzl.id(z.FromChan), fzl.id(z.ToChan))
+	fzl.total[k]++
+
+	if w := fzl.windowAt(z.Time); w != nil {
+		w.counts[k]++
+	}
+}
+
+// id returns the index of a channel, adding it if it is new. The caller must
+// hold the lock.
+func (fzl *FlowZapLogger) id(chName string) uint16 {
+	if id, ok := fzl.ids[chName]; ok {
+		return id
+	}
+	if len(fzl.names) >= MaxFlowChannels {
+		chName = OtherChannel
+		if id, ok := fzl.ids[chName]; ok {
+			return id
+		}
+	}
+
+	id := uint16(len(fzl.names))
+	fzl.ids[chName] = id
+	fzl.names = append(fzl.names, chName)
+	return id
+}
+
+// windowAt returns the window that t falls in, opening it if needed, or nil if
+// it is older than the retained windows. Windows without zaps are not stored.
+// The caller must hold the lock.
+func (fzl *FlowZapLogger) windowAt(t time.Time) *flowWindow {
+	start := bucketStart(t, fzl.window)
+
+	// Zaps mostly come in order, so the latest windows are searched first
+	i := len(fzl.windows)
+	for i > 0 && fzl.windows[i-1].start.After(start) {
+		i--
+	}
+	if i > 0 && fzl.windows[i-1].start.Equal(start) {
+		return fzl.windows[i-1]
+	}
+
+	if n := len(fzl.windows); n > 0 && start.Before(fzl.oldest(fzl.windows[n-1].start)) {
+		return nil
+	}
+
+	w := &flowWindow{start: start, counts: make(flowCounts)}
+	fzl.windows = append(fzl.windows, nil)
+	copy(fzl.windows[i+1:], fzl.windows[i:])
+	fzl.windows[i] = w
+
+	// Drop the windows that a newer window has pushed out of the period
+	oldest := fzl.oldest(fzl.windows[len(fzl.windows)-1].start)
+	drop := 0
+	for drop < len(fzl.windows) && fzl.windows[drop].start.Before(oldest) {
+		drop++
+	}
+	fzl.windows = fzl.windows[drop:]
+	return w
+}
+
+// oldest returns the start of the oldest window kept when the latest window
+// starts at latest
+func (fzl *FlowZapLogger) oldest(latest time.Time) time.Time {
+	return latest.Add(-time.Duration(fzl.retain-1) * fzl.window)
+}
+
+// matrix copies the counts into a TransitionMatrix. The caller must hold the
+// lock.
+func (fzl *FlowZapLogger) matrix(counts flowCounts, start, end time.Time) *TransitionMatrix {
+	m := &TransitionMatrix{Start: start, End: end}
+	m.Transitions = make([]Transition, 0, len(counts))
+	for k, n := range counts {
+		m.Transitions = append(m.Transitions, Transition{fzl.names[k.from()], fzl.names[k.to()], n})
+	}
+	sortTransitions(m.Transitions)
+	return m
+}
+
+// Matrix returns the transitions since the logger started
+func (fzl *FlowZapLogger) Matrix() *TransitionMatrix {
+	if PrintTimes {
+		defer zap.TimeElapsed(time.Now(), fzl.String()+".Matrix")
+	}
+
+	fzl.mu.RLock()
+	defer fzl.mu.RUnlock()
+
+	return fzl.matrix(fzl.total, time.Time{}, time.Time{})
+}
+
+// WindowMatrix returns the transitions in the time window that t falls in. The
+// matrix is empty if the window had no zaps or is no longer kept.
+func (fzl *FlowZapLogger) WindowMatrix(t time.Time) *TransitionMatrix {
+	fzl.mu.RLock()
+	defer fzl.mu.RUnlock()
+
+	start := bucketStart(t, fzl.window)
+	for _, w := range fzl.windows {
+		if w.start.Equal(start) {
+			return fzl.matrix(w.counts, start, bucketEnd(start, fzl.window))
+		}
+	}
+	return fzl.matrix(nil, start, bucketEnd(start, fzl.window))
+}
+
+// Windows returns the start of each window kept, oldest first
+func (fzl *FlowZapLogger) Windows() []time.Time {
+	fzl.mu.RLock()
+	defer fzl.mu.RUnlock()
+
+	starts := make([]time.Time, len(fzl.windows))
+	for i, w := range fzl.windows {
+		starts[i] = w.start
+	}
+	return starts
+}
+
+// TransitionMatrix is a from-to matrix of zap counts, stored as the list of its
+// non-zero cells with the most zaps first. Start and End are zero for the
+// matrix of every zap logged.
+type TransitionMatrix struct {
+	Start       time.Time
+	End         time.Time
+	Transitions []Transition
+}
+
+// sortTransitions sorts transitions by zaps, most first, and then by channel
+func sortTransitions(list []Transition) {
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Zaps != list[j].Zaps {
+			return list[i].Zaps > list[j].Zaps
+		}
+		if list[i].From != list[j].From {
+			return list[i].From < list[j].From
+		}
+		return list[i].To < list[j].To
+	})
+}
+
+// Outbound returns the n channels that the viewers of a channel zapped to the
+// most, ie. where they went
+func (m *TransitionMatrix) Outbound(chName string, n int) []Transition {
+	return m.filter(func(t Transition) bool { return t.From == chName }, n)
+}
+
+// Inbound returns the n channels that the viewers of a channel zapped from the
+// most, ie. where they came from
+func (m *TransitionMatrix) Inbound(chName string, n int) []Transition {
+	return m.filter(func(t Transition) bool { return t.To == chName }, n)
+}
+
+// filter returns the first n transitions that match
+func (m *TransitionMatrix) filter(match func(Transition) bool, n int) []Transition {
+	var list []Transition
+	for _, t := range m.Transitions {
+		if n >= 0 && len(list) >= n {
+			break
+		}
+		if match(t) {
+			list = append(list, t)
+		}
+	}
+	return list
+}
+
+// Zaps returns the number of zaps from one channel to another
+func (m *TransitionMatrix) Zaps(from, to string) int {
+	for _, t := range m.Transitions {
+		if t.From == from && t.To == to {
+			return t.Zaps
+		}
+	}
+	return 0
+}
+
+// WriteCSV writes the non-zero cells of the matrix as CSV, one from,to,zaps
+// record per line after a header
+func (m *TransitionMatrix) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"from", "to", "zaps"}); err != nil {
+		return err
+	}
+	for _, t := range m.Transitions {
+		if err := cw.Write([]string{t.From, t.To, strconv.Itoa(t.Zaps)}); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// sankeyNode and sankeyLink are the JSON form of the matrix, as used by
+// d3-sankey and most other Sankey diagram libraries
+type sankeyNode struct {
+	Name string `json:"name"`
+}
+
+type sankeyLink struct {
+	Source int `json:"source"`
+	Target int `json:"target"`
+	Value  int `json:"value"`
+}
+
+type sankeyGraph struct {
+	Start *time.Time   `json:"start,omitempty"`
+	End   *time.Time   `json:"end,omitempty"`
+	Nodes []sankeyNode `json:"nodes"`
+	Links []sankeyLink `json:"links"`
+}
+
+// WriteJSON writes the matrix as a JSON graph of nodes and links for drawing a
+// Sankey diagram. Channels appear as two nodes, one for the viewers leaving
+// them and one for the viewers arriving, since the diagrams cannot draw zaps
+// going both ways between two channels.
+func (m *TransitionMatrix) WriteJSON(w io.Writer) error {
+	g := sankeyGraph{Nodes: []sankeyNode{}, Links: []sankeyLink{}}
+	if !m.Start.IsZero() {
+		g.Start, g.End = &m.Start, &m.End
+	}
+
+	sources := make(map[string]int)
+	targets := make(map[string]int)
+	node := func(nodes map[string]int, chName string) int {
+		i, ok := nodes[chName]
+		if !ok {
+			i = len(g.Nodes)
+			nodes[chName] = i
+			g.Nodes = append(g.Nodes, sankeyNode{chName})
+		}
+		return i
+	}
+
+	for _, t := range m.Transitions {
+		g.Links = append(g.Links, sankeyLink{node(sources, t.From), node(targets, t.To), t.Zaps})
+	}
+
+	return json.NewEncoder(w).Encode(g)
+}
@@ -0,0 +1,177 @@
+package zlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	zap ".."
+)
+
+// flowZaps span two 15 minute windows
+var flowZaps = []struct {
+	min      int
+	ip       string
+	from, to string
+}{
+	{0, "10.0.0.1", zap.Off, "NRK1"},
+	{0, "10.0.0.2", zap.Off, "NRK1"},
+	{0, "10.0.0.3", zap.Off, "NRK1"},
+	{5, "10.0.0.1", "NRK1", "TV2 Norge"},
+	{20, "10.0.0.2", "NRK1", "TV2 Norge"},
+	{21, "10.0.0.3", "NRK1", "NRK2"},
+	{22, "10.0.0.1", "TV2 Norge", "NRK1"},
+	{25, "10.0.0.2", "TV2 Norge", zap.Off},
+}
+
+func newTestFlows(t *testing.T) *FlowZapLogger {
+	zl, err := NewFlowZapLogger(15*time.Minute, 96)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2013, 7, 20, 21, 0, 0, 0, time.UTC)
+	for _, fz := range flowZaps {
+		zl.LogZap(zap.ChZap{
+			Time:     start.Add(time.Duration(fz.min) * time.Minute),
+			IP:       fz.ip,
+			FromChan: fz.from,
+			ToChan:   fz.to,
+		})
+	}
+	return zl.(*FlowZapLogger)
+}
+
+func TestFlowZapLogger(t *testing.T) {
+	fzl := newTestFlows(t)
+	at := time.Date(2013, 7, 20, 21, 0, 0, 0, time.UTC)
+
+	m := fzl.Matrix()
+	if n := m.Zaps(zap.Off, "NRK1"); n != 3 {
+		t.Errorf("Matrix().Zaps(OFF, NRK1) => %v, want 3", n)
+	}
+	want := []Transition{{"NRK1", "TV2 Norge", 2}, {"NRK1", "NRK2", 1}}
+	if got := m.Outbound("NRK1", 10); !reflect.DeepEqual(got, want) {
+		t.Errorf("Matrix().Outbound(NRK1) => %v, want %v", got, want)
+	}
+	want = []Transition{{"NRK1", "TV2 Norge", 2}}
+	if got := m.Inbound("TV2 Norge", 1); !reflect.DeepEqual(got, want) {
+		t.Errorf("Matrix().Inbound(TV2 Norge, 1) => %v, want %v", got, want)
+	}
+
+	// Where did NRK1's viewers go at 21:00 and at 21:15
+	want = []Transition{{"NRK1", "TV2 Norge", 1}}
+	if got := fzl.WindowMatrix(at.Add(10*time.Minute)).Outbound("NRK1", 10); !reflect.DeepEqual(got, want) {
+		t.Errorf("WindowMatrix(21:10).Outbound(NRK1) => %v, want %v", got, want)
+	}
+	want = []Transition{{"NRK1", "NRK2", 1}, {"NRK1", "TV2 Norge", 1}}
+	if got := fzl.WindowMatrix(at.Add(15*time.Minute)).Outbound("NRK1", 10); !reflect.DeepEqual(got, want) {
+		t.Errorf("WindowMatrix(21:15).Outbound(NRK1) => %v, want %v", got, want)
+	}
+	if got := fzl.WindowMatrix(at.Add(time.Hour)).Transitions; len(got) != 0 {
+		t.Errorf("WindowMatrix(22:00) => %v, want no transitions", got)
+	}
+
+	if got := fzl.Windows(); len(got) != 2 || !got[0].Equal(at) || !got[1].Equal(at.Add(15*time.Minute)) {
+		t.Errorf("Windows() => %v, want 21:00 and 21:15", got)
+	}
+}
+
+// TestFlowZapLoggerRetain checks that old windows are dropped, and that zaps
+// older than the kept windows still count in the overall matrix
+func TestFlowZapLoggerRetain(t *testing.T) {
+	zl, err := NewFlowZapLogger(time.Minute, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fzl := zl.(*FlowZapLogger)
+
+	start := time.Date(2013, 7, 20, 21, 0, 0, 0, time.UTC)
+	for _, min := range []int{0, 1, 2, 5, 4, 0} {
+		zl.LogZap(zap.ChZap{Time: start.Add(time.Duration(min) * time.Minute), IP: "10.0.0.1", FromChan: "NRK1", ToChan: "NRK2"})
+	}
+
+	want := []time.Time{start.Add(4 * time.Minute), start.Add(5 * time.Minute)}
+	if got := fzl.Windows(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Windows() => %v, want %v", got, want)
+	}
+	if n := fzl.Matrix().Zaps("NRK1", "NRK2"); n != 6 {
+		t.Errorf("Matrix().Zaps(NRK1, NRK2) => %v, want 6", n)
+	}
+}
+
+// TestFlowZapLoggerChannels checks that channels beyond MaxFlowChannels are
+// counted as OtherChannel
+func TestFlowZapLoggerChannels(t *testing.T) {
+	zl, err := NewFlowZapLogger(time.Minute, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fzl := zl.(*FlowZapLogger)
+
+	start := time.Date(2013, 7, 20, 21, 0, 0, 0, time.UTC)
+	for i := 0; i < MaxFlowChannels+10; i++ {
+		zl.LogZap(zap.ChZap{Time: start, IP: "10.0.0.1", FromChan: "NRK1", ToChan: fmt.Sprintf("Channel %v", i)})
+	}
+
+	if n := len(fzl.names); n != MaxFlowChannels+1 {
+		t.Errorf("%v channels stored, want %v", n, MaxFlowChannels+1)
+	}
+	if n := fzl.Matrix().Zaps("NRK1", OtherChannel); n != 11 {
+		t.Errorf("Matrix().Zaps(NRK1, %v) => %v, want 11", OtherChannel, n)
+	}
+}
+
+func TestTransitionMatrixExport(t *testing.T) {
+	m := &TransitionMatrix{Transitions: []Transition{
+		{"NRK1", "TV2 Norge", 2},
+		{"TV2 Norge", "NRK1", 1},
+		{zap.Off, "NRK1", 1},
+	}}
+
+	var buf bytes.Buffer
+	if err := m.WriteCSV(&buf); err != nil {
+		t.Fatal(err)
+	}
+	wantCSV := "from,to,zaps\nNRK1,TV2 Norge,2\nTV2 Norge,NRK1,1\nOFF,NRK1,1\n"
+	if buf.String() != wantCSV {
+		t.Errorf("WriteCSV() => %q, want %q", buf.String(), wantCSV)
+	}
+
+	buf.Reset()
+	if err := m.WriteJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var g sankeyGraph
+	if err := json.Unmarshal(buf.Bytes(), &g); err != nil {
+		t.Fatalf("WriteJSON() wrote bad JSON: %v", err)
+	}
+
+	// Sources and targets are separate nodes
+	wantGraph := sankeyGraph{
+		Nodes: []sankeyNode{{"NRK1"}, {"TV2 Norge"}, {"TV2 Norge"}, {"NRK1"}, {zap.Off}},
+		Links: []sankeyLink{{0, 1, 2}, {2, 3, 1}, {4, 3, 1}},
+	}
+	if !reflect.DeepEqual(g, wantGraph) {
+		t.Errorf("WriteJSON() => %+v, want %+v", g, wantGraph)
+	}
+}
+
+func TestFlowZapLoggerState(t *testing.T) {
+	fzl := newTestFlows(t)
+	st := fzl.saveState()
+
+	zl, _ := NewFlowZapLogger(15*time.Minute, 96)
+	restored := zl.(*FlowZapLogger)
+	restored.restoreState(st)
+
+	if got, want := restored.Matrix(), fzl.Matrix(); !reflect.DeepEqual(got, want) {
+		t.Errorf("restored Matrix() => %v, want %v", got, want)
+	}
+	if got, want := restored.Windows(), fzl.Windows(); !reflect.DeepEqual(got, want) {
+		t.Errorf("restored Windows() => %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,281 @@
+// Mute Zap logger
+
+package zlog
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	zap "../"
+)
+
+// StatusLogger is implemented by loggers that use status changes as well as zaps
+type StatusLogger interface {
+	LogStatus(s zap.StatusChange)
+}
+
+// MuteStats holds the mute statistics of a channel
+type MuteStats struct {
+	Channel string
+	// AvgMuted is the muted time per viewer of the channel, counting every box
+	// that has watched it whether it muted or not
+	AvgMuted time.Duration
+	Viewers  int
+	// Muted is the number of viewers that have the channel muted right now
+	Muted int
+	// Peak is the highest number of viewers that had the channel muted at the
+	// same time, first reached at PeakTime
+	Peak     int
+	PeakTime time.Time
+}
+
+func (ms MuteStats) String() string {
+	return fmt.Sprintf("%v: %v muted per viewer (%v viewers), %v muted now, peak %v at %v",
+		ms.Channel, ms.AvgMuted, ms.Viewers, ms.Muted, ms.Peak, ms.PeakTime.Format(timeOfDay))
+}
+
+// timeOfDay is the format of the peak times
+const timeOfDay = "15:04:05"
+
+// MuteSessionTimeout is how long a box can go without sending any events before
+// the mute logger stops counting it as watching, and muted. Boxes are silent
+// while their viewers stay on a channel, so it is as long as the standby timer
+// of most TVs.
+const MuteSessionTimeout = 4 * time.Hour
+
+// muteChannel accumulates the mute statistics of a channel
+type muteChannel struct {
+	// Muted time of each viewer in its completed spans on the channel
+	viewers map[string]time.Duration
+	total   time.Duration
+	// Muted time of the open spans on the channel, up to openAt
+	open   time.Duration
+	openAt time.Time
+
+	muted    int
+	peak     int
+	peakTime time.Time
+}
+
+// advance adds the muted time of the boxes muted on the channel up to the given
+// time to the open spans
+func (mc *muteChannel) advance(t time.Time) {
+	if t.After(mc.openAt) {
+		mc.open += time.Duration(mc.muted) * t.Sub(mc.openAt)
+		mc.openAt = t
+	}
+}
+
+// MuteZapLogger counts viewers like the advanced logger, and correlates the
+// boxes' Mute_Status with their channel to find the channels that are muted
+// the most, and the time of day each had the most muted viewers. The boxes are
+// followed by a SessionTracker, so muting only counts while a box is tuned to
+// a channel with its TV on, and the muted time of each viewing span is added
+// to the channel when the span ends.
+type MuteZapLogger struct {
+	*AdvancedZapLogger
+
+	sessions *SessionTracker
+	channels map[string]*muteChannel
+	// The channel each muted box is counted as muted on
+	muted map[string]string
+	now   time.Time
+	mu    sync.RWMutex
+}
+
+// NewMuteZapLogger creates a mute logger
+func NewMuteZapLogger() ZapLogger {
+	mzl := &MuteZapLogger{
+		AdvancedZapLogger: NewAdvancedZapLogger().(*AdvancedZapLogger),
+		sessions:          NewSessionTracker(MuteSessionTimeout),
+		channels:          make(map[string]*muteChannel),
+		muted:             make(map[string]string),
+	}
+	mzl.sessions.Subscribe(mzl.endSpan)
+	return mzl
+}
+
+// String returns the name of the logger
+func (mzl *MuteZapLogger) String() string {
+	return "Mute Logger"
+}
+
+// LogZap adds a zap to the log, moving a muted box's muting to the new channel
+func (mzl *MuteZapLogger) LogZap(z zap.ChZap) {
+	mzl.AdvancedZapLogger.LogZap(z)
+
+	mzl.mu.Lock()
+	defer mzl.mu.Unlock()
+
+	mzl.advance(z.Time)
+	mzl.sessions.LogZap(z)
+
+	// Every viewer counts towards the average, muted or not
+	if z.ToChan != zap.Off {
+		mc := mzl.channel(z.ToChan)
+		if _, ok := mc.viewers[z.IP]; !ok {
+			mc.viewers[z.IP] = 0
+		}
+	}
+
+	mzl.setMuted(z.IP, mzl.mutedOn(z.IP), z.Time)
+}
+
+// LogStatus logs a status change. HDMI_Status is passed on to the advanced
+// logger, and both it and Mute_Status are passed on to the session tracker.
+func (mzl *MuteZapLogger) LogStatus(s zap.StatusChange) {
+	mzl.AdvancedZapLogger.LogStatus(s)
+
+	if s.Kind != zap.StatusMute && s.Kind != zap.StatusHDMI {
+		return
+	}
+
+	mzl.mu.Lock()
+	defer mzl.mu.Unlock()
+
+	mzl.advance(s.Time)
+	mzl.sessions.LogStatus(s)
+	mzl.setMuted(s.IP, mzl.mutedOn(s.IP), s.Time)
+}
+
+// endSpan adds the muted time of a completed span to its channel, and stops
+// counting the box as muted there, which matters when the span timed out and
+// the box sends nothing more. The session tracker calls it from LogZap and
+// LogStatus, which hold the lock.
+func (mzl *MuteZapLogger) endSpan(sp Span) {
+	mc := mzl.channel(sp.Channel)
+	if mzl.muted[sp.IP] == sp.Channel {
+		mc.advance(sp.End)
+		mzl.setMuted(sp.IP, "", sp.End)
+		// A timed out span ends before the channel's latest update
+		if mc.openAt.After(sp.End) {
+			mc.open -= mc.openAt.Sub(sp.End)
+		}
+	}
+	if sp.Muted <= 0 {
+		return
+	}
+
+	mc.open -= sp.Muted
+	mc.viewers[sp.IP] += sp.Muted
+	mc.total += sp.Muted
+}
+
+// advance moves the latest event time forward. The caller must hold the lock.
+func (mzl *MuteZapLogger) advance(t time.Time) {
+	if t.After(mzl.now) {
+		mzl.now = t
+	}
+}
+
+// mutedOn returns the channel the box is muted on, or an empty string if it is
+// not muted or not watching
+func (mzl *MuteZapLogger) mutedOn(ip string) string {
+	if b, ok := mzl.sessions.State(ip); ok && b.Muted && b.watching() {
+		return b.Channel
+	}
+	return ""
+}
+
+// channel returns the mute statistics of a channel, adding it if it is new.
+// The caller must hold the lock.
+func (mzl *MuteZapLogger) channel(chName string) *muteChannel {
+	mc, ok := mzl.channels[chName]
+	if !ok {
+		mc = &muteChannel{viewers: make(map[string]time.Duration)}
+		mzl.channels[chName] = mc
+	}
+	return mc
+}
+
+// setMuted counts a box as muted on a channel, or none, from the given time,
+// instead of the channel it was counted as muted on. The caller must hold the
+// lock.
+func (mzl *MuteZapLogger) setMuted(ip, to string, t time.Time) {
+	from := mzl.muted[ip]
+	if from == to {
+		return
+	}
+
+	if from != "" {
+		mc := mzl.channel(from)
+		mc.advance(t)
+		mc.muted--
+		delete(mzl.muted, ip)
+	}
+	if to != "" {
+		mzl.muted[ip] = to
+		mc := mzl.channel(to)
+		mc.advance(t)
+		mc.muted++
+		if mc.muted > mc.peak {
+			mc.peak = mc.muted
+			mc.peakTime = t
+		}
+	}
+}
+
+// stats returns the statistics of a channel, counting the spans still in
+// progress up to the latest event. The caller must hold the lock.
+func (mzl *MuteZapLogger) stats(chName string, mc *muteChannel) MuteStats {
+	ms := MuteStats{
+		Channel:  chName,
+		Viewers:  len(mc.viewers),
+		Muted:    mc.muted,
+		Peak:     mc.peak,
+		PeakTime: mc.peakTime,
+	}
+
+	total := mc.total + mc.open
+	if mzl.now.After(mc.openAt) {
+		total += time.Duration(mc.muted) * mzl.now.Sub(mc.openAt)
+	}
+
+	if ms.Viewers > 0 {
+		ms.AvgMuted = total / time.Duration(ms.Viewers)
+	}
+	return ms
+}
+
+// Muted returns the mute statistics of a channel
+func (mzl *MuteZapLogger) Muted(chName string) MuteStats {
+	mzl.mu.RLock()
+	defer mzl.mu.RUnlock()
+
+	if mc, ok := mzl.channels[chName]; ok {
+		return mzl.stats(chName, mc)
+	}
+	return MuteStats{Channel: chName}
+}
+
+// TopMuted returns the n channels with the most muted time per viewer, most
+// muted first. Channels that have never been muted are left out.
+func (mzl *MuteZapLogger) TopMuted(n int) []MuteStats {
+	if PrintTimes {
+		defer zap.TimeElapsed(time.Now(), mzl.String()+".TopMuted")
+	}
+
+	mzl.mu.RLock()
+	list := make([]MuteStats, 0, len(mzl.channels))
+	for chName, mc := range mzl.channels {
+		if mc.peak == 0 {
+			continue
+		}
+		list = append(list, mzl.stats(chName, mc))
+	}
+	mzl.mu.RUnlock()
+
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].AvgMuted != list[j].AvgMuted {
+			return list[i].AvgMuted > list[j].AvgMuted
+		}
+		return list[i].Channel < list[j].Channel
+	})
+
+	if n >= 0 && len(list) > n {
+		list = list[:n]
+	}
+	return list
+}
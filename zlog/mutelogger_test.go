@@ -0,0 +1,180 @@
+package zlog
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	zap ".."
+)
+
+// muteEvents are zaps, or mute status changes when mute is 0 or 1
+var muteEvents = []struct {
+	min      int
+	ip       string
+	from, to string
+	mute     int
+}{
+	{0, "10.0.0.1", zap.Off, "NRK1", -1},
+	{0, "10.0.0.2", zap.Off, "NRK1", -1},
+	{0, "10.0.0.3", zap.Off, "NRK2", -1},
+	{10, "10.0.0.1", "", "", 1},
+	{20, "10.0.0.2", "", "", 1},
+	// The muted box takes its muting along to NRK2
+	{30, "10.0.0.1", "NRK1", "NRK2", -1},
+	{40, "10.0.0.2", "", "", 0},
+	// Unknown boxes and repeated statuses are ignored
+	{45, "10.0.0.9", "", "", 1},
+	{45, "10.0.0.2", "", "", 0},
+	{50, "10.0.0.1", "", "", 0},
+}
+
+// muteEvent returns the i'th of muteEvents as a zap or a status change
+func muteEvent(i int) (*zap.ChZap, *zap.StatusChange) {
+	ev := muteEvents[i]
+	if ev.mute < 0 {
+		return &zap.ChZap{Time: at(ev.min), IP: ev.ip, FromChan: ev.from, ToChan: ev.to}, nil
+	}
+	return nil, &zap.StatusChange{Time: at(ev.min), IP: ev.ip, Kind: zap.StatusMute, Value: ev.mute}
+}
+
+func TestMuteZapLogger(t *testing.T) {
+	zl := NewMuteZapLogger()
+	mzl := zl.(*MuteZapLogger)
+
+	for i, ev := range muteEvents {
+		if z, s := muteEvent(i); z != nil {
+			zl.LogZap(*z)
+		} else {
+			mzl.LogStatus(*s)
+		}
+
+		// Muting in progress counts up to the latest event
+		if ev.min == 40 {
+			if ms := mzl.Muted("NRK2"); ms.AvgMuted != 5*time.Minute || ms.Muted != 1 {
+				t.Errorf("Muted(NRK2) at 18:40 => %v, want 5m0s per viewer, 1 muted", ms)
+			}
+		}
+	}
+
+	want := []MuteStats{
+		{Channel: "NRK1", AvgMuted: 20 * time.Minute, Viewers: 2, Peak: 2, PeakTime: at(20)},
+		{Channel: "NRK2", AvgMuted: 10 * time.Minute, Viewers: 2, Peak: 1, PeakTime: at(30)},
+	}
+
+	top := mzl.TopMuted(10)
+	if len(top) != len(want) {
+		t.Fatalf("TopMuted(10) => %v, want %v", top, want)
+	}
+	for i := range want {
+		if top[i] != want[i] {
+			t.Errorf("TopMuted(10)[%v] => %v, want %v", i, top[i], want[i])
+		}
+	}
+
+	if top := mzl.TopMuted(1); len(top) != 1 || top[0].Channel != "NRK1" {
+		t.Errorf("TopMuted(1) => %v, want NRK1 only", top)
+	}
+
+	// Viewer counts are those of the advanced logger
+	if v := zl.Viewers("NRK2"); v != 2 {
+		t.Errorf("Viewers(NRK2) => %v, want 2", v)
+	}
+}
+
+// TestMuteZapLoggerHDMI checks that a muted box does not count as muted while
+// its TV is off
+func TestMuteZapLoggerHDMI(t *testing.T) {
+	zl := NewMuteZapLogger()
+	mzl := zl.(*MuteZapLogger)
+	status := func(min int, kind zap.StatusKind, value int) {
+		mzl.LogStatus(zap.StatusChange{Time: at(min), IP: "10.0.0.1", Kind: kind, Value: value})
+	}
+
+	zl.LogZap(zap.ChZap{Time: at(0), IP: "10.0.0.1", FromChan: zap.Off, ToChan: "NRK1"})
+	status(0, zap.StatusMute, 1)
+	status(10, zap.StatusHDMI, 0)
+	if ms := mzl.Muted("NRK1"); ms.Muted != 0 || ms.AvgMuted != 10*time.Minute {
+		t.Errorf("Muted(NRK1) with the TV off => %v, want 10m0s per viewer, none muted", ms)
+	}
+
+	status(20, zap.StatusHDMI, 1)
+	status(30, zap.StatusMute, 0)
+
+	want := MuteStats{Channel: "NRK1", AvgMuted: 20 * time.Minute, Viewers: 1, Peak: 1, PeakTime: at(0)}
+	if ms := mzl.Muted("NRK1"); ms != want {
+		t.Errorf("Muted(NRK1) => %v, want %v", ms, want)
+	}
+}
+
+// TestMuteZapLoggerTimeout checks that a muted box that goes silent stops
+// counting as muted when its session times out
+func TestMuteZapLoggerTimeout(t *testing.T) {
+	zl := NewMuteZapLogger()
+	mzl := zl.(*MuteZapLogger)
+
+	zl.LogZap(zap.ChZap{Time: at(0), IP: "10.0.0.1", FromChan: zap.Off, ToChan: "NRK1"})
+	mzl.LogStatus(zap.StatusChange{Time: at(0), IP: "10.0.0.1", Kind: zap.StatusMute, Value: 1})
+	zl.LogZap(zap.ChZap{Time: at(0), IP: "10.0.0.2", FromChan: zap.Off, ToChan: "NRK2"})
+
+	// Another box's events move the time past the timeout
+	late := at(0).Add(MuteSessionTimeout + time.Hour)
+	zl.LogZap(zap.ChZap{Time: late, IP: "10.0.0.2", FromChan: "NRK2", ToChan: "NRK3"})
+
+	want := MuteStats{Channel: "NRK1", AvgMuted: MuteSessionTimeout, Viewers: 1, Peak: 1, PeakTime: at(0)}
+	if ms := mzl.Muted("NRK1"); ms != want {
+		t.Errorf("Muted(NRK1) after the timeout => %v, want %v", ms, want)
+	}
+}
+
+// TestMuteZapLoggerStore checks that the mute statistics survive a restart,
+// from the snapshot and from the journal after it
+func TestMuteZapLoggerStore(t *testing.T) {
+	for _, checkpoint := range []int{0, 4, len(muteEvents)} {
+		dir := t.TempDir()
+		want := NewMuteZapLogger().(*MuteZapLogger)
+
+		s, err := OpenStore(dir, NewMuteZapLogger())
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range muteEvents {
+			if i == checkpoint {
+				if err := s.Checkpoint(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if z, sc := muteEvent(i); z != nil {
+				s.LogZap(*z)
+				want.LogZap(*z)
+			} else {
+				s.LogStatus(*sc)
+				want.LogStatus(*sc)
+			}
+		}
+		if err := s.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		got := NewMuteZapLogger().(*MuteZapLogger)
+		s, err = OpenStore(dir, got)
+		if err != nil {
+			t.Fatalf("checkpoint at %v: OpenStore => %v", checkpoint, err)
+		}
+		if g, w := got.TopMuted(-1), want.TopMuted(-1); len(w) == 0 || !reflect.DeepEqual(g, w) {
+			t.Errorf("checkpoint at %v: TopMuted() after restart => %v, want %v", checkpoint, g, w)
+		}
+
+		// Boxes keep their channel, so muting after the restart counts there
+		mute := zap.StatusChange{Time: at(60), IP: "10.0.0.2", Kind: zap.StatusMute, Value: 1}
+		unmute := zap.StatusChange{Time: at(70), IP: "10.0.0.2", Kind: zap.StatusMute, Value: 0}
+		for _, sc := range []zap.StatusChange{mute, unmute} {
+			got.LogStatus(sc)
+			want.LogStatus(sc)
+		}
+		if g, w := got.Muted("NRK1"), want.Muted("NRK1"); g != w {
+			t.Errorf("checkpoint at %v: Muted(NRK1) after restart => %v, want %v", checkpoint, g, w)
+		}
+		s.Close()
+	}
+}
@@ -0,0 +1,165 @@
+// Ranked Zap logger
+
+package zlog
+
+import (
+	"sync"
+	"time"
+
+	zap "../"
+)
+
+// RankedZapLogger counts viewers like the viewers logger, but keeps the channels
+// ranked as zaps are logged instead of sorting them on every read
+type RankedZapLogger struct {
+	ranking  *Ranking
+	watching ChannelCounts
+	boxes    boxTracker
+	on       int
+	mu       sync.RWMutex
+}
+
+// NewRankedZapLogger creates a ranked zap logger
+func NewRankedZapLogger() ZapLogger {
+	rzl := new(RankedZapLogger)
+	rzl.ranking = NewRanking()
+	rzl.watching = make(ChannelCounts)
+	rzl.boxes = newBoxTracker()
+	return rzl
+}
+
+// LogZap adds a zap to the log
+func (rzl *RankedZapLogger) LogZap(z zap.ChZap) {
+	rzl.mu.Lock()
+	defer rzl.mu.Unlock()
+
+	m := rzl.boxes.track(z)
+	if m.to != zap.Off {
+		rzl.ranking.Inc(m.to)
+		rzl.on++
+	}
+	if m.from != zap.Off {
+		rzl.ranking.Dec(m.from)
+		rzl.on--
+	}
+	rzl.watching.move(m.watchFrom, m.watchTo)
+}
+
+// LogStatus adds a status change to the log. Only HDMI_Status is used.
+func (rzl *RankedZapLogger) LogStatus(s zap.StatusChange) {
+	rzl.mu.Lock()
+	defer rzl.mu.Unlock()
+
+	rzl.watching.move(rzl.boxes.hdmi(s))
+}
+
+// Watching returns the number of viewers of the given channel with their TV on
+func (rzl *RankedZapLogger) Watching(chName string) int {
+	rzl.mu.RLock()
+	defer rzl.mu.RUnlock()
+
+	return rzl.watching[chName]
+}
+
+// top returns the n most viewed channels with their watching viewers. The
+// caller must hold the lock.
+func (rzl *RankedZapLogger) top(n int) ChanViewersList {
+	list := rzl.ranking.Top(n)
+	for _, cv := range list {
+		cv.Watching = rzl.watching[cv.Channel]
+	}
+	return list
+}
+
+// Coverage tells how much of the audience the viewer counts are based on
+func (rzl *RankedZapLogger) Coverage() Coverage {
+	rzl.mu.RLock()
+	defer rzl.mu.RUnlock()
+
+	return rzl.boxes.coverage()
+}
+
+// PoweredOn returns the number of boxes counted as viewers of a channel
+func (rzl *RankedZapLogger) PoweredOn() int {
+	rzl.mu.RLock()
+	defer rzl.mu.RUnlock()
+
+	return rzl.on
+}
+
+// Entries returns the number of channels in the log set
+func (rzl *RankedZapLogger) Entries() int {
+	rzl.mu.RLock()
+	defer rzl.mu.RUnlock()
+
+	return rzl.ranking.Len()
+}
+
+// String returns the name of the logger
+func (rzl *RankedZapLogger) String() string {
+	return "Ranked Logger"
+}
+
+// Viewers returns the viewer count for the given channel
+func (rzl *RankedZapLogger) Viewers(chName string) int {
+	if PrintTimes {
+		defer zap.TimeElapsed(time.Now(), rzl.String()+".Viewers")
+	}
+
+	rzl.mu.RLock()
+	defer rzl.mu.RUnlock()
+
+	return rzl.ranking.Viewers(chName)
+}
+
+// Rank returns the position of the channel in the top list, starting at 1, or 0
+// if the channel has not been seen
+func (rzl *RankedZapLogger) Rank(chName string) int {
+	rzl.mu.RLock()
+	defer rzl.mu.RUnlock()
+
+	return rzl.ranking.Rank(chName)
+}
+
+// Channels returns a list of channels in the log, most viewed first
+func (rzl *RankedZapLogger) Channels() []string {
+	if PrintTimes {
+		defer zap.TimeElapsed(time.Now(), rzl.String()+".Channels")
+	}
+
+	rzl.mu.RLock()
+	defer rzl.mu.RUnlock()
+
+	return rzl.ranking.Channels()
+}
+
+// ChannelsViewers creates a slice of ChannelViewers, which is defined in zaplogger.go.
+// This is the number of viewers for each channel.
+func (rzl *RankedZapLogger) ChannelsViewers() []*ChannelViewers {
+	if PrintTimes {
+		defer zap.TimeElapsed(time.Now(), rzl.String()+".ChannelsViewers")
+	}
+
+	rzl.mu.RLock()
+	defer rzl.mu.RUnlock()
+
+	return rzl.top(-1)
+}
+
+// FetchSorted returns a list of channels and viewers, sorted by viewers
+// At most i elements are returned.
+func (rzl *RankedZapLogger) FetchSorted(i uint8) ChanViewersList {
+	if PrintTimes {
+		defer zap.TimeElapsed(time.Now(), rzl.String()+".FetchSorted")
+	}
+
+	rzl.mu.RLock()
+	defer rzl.mu.RUnlock()
+
+	return rzl.top(int(i))
+}
+
+// FetchStats is not supported by rankedlogger and will return a nil map
+func (rzl *RankedZapLogger) FetchStats() *map[string]ZapStats {
+	return nil
+}
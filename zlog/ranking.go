@@ -0,0 +1,114 @@
+// Incremental channel ranking
+
+package zlog
+
+import "sort"
+
+// Ranking keeps channels sorted by viewers as the viewer counts go up and down
+// by one, which is how zaps change them. An update costs O(log C) for C
+// channels, so the top N channels can be read in O(N) without sorting.
+// Ranking does no locking of its own.
+type Ranking struct {
+	// list is sorted by viewers, most viewed first
+	list []ChannelViewers
+	pos  map[string]int
+}
+
+// NewRanking creates an empty ranking
+func NewRanking() *Ranking {
+	return &Ranking{pos: make(map[string]int)}
+}
+
+// Inc adds a viewer to the channel, adding the channel if it is new
+func (r *Ranking) Inc(chName string) {
+	p := r.index(chName)
+	c := r.list[p].Viewers
+
+	// Swap with the first channel of equal viewers before incrementing
+	q := sort.Search(len(r.list), func(i int) bool { return r.list[i].Viewers <= c })
+	r.swap(p, q)
+	r.list[q].Viewers++
+}
+
+// Dec removes a viewer from the channel, adding the channel if it is new
+func (r *Ranking) Dec(chName string) {
+	p := r.index(chName)
+	c := r.list[p].Viewers
+
+	// Swap with the last channel of equal viewers before decrementing
+	q := sort.Search(len(r.list), func(i int) bool { return r.list[i].Viewers < c }) - 1
+	r.swap(p, q)
+	r.list[q].Viewers--
+}
+
+// Viewers returns the number of viewers of the channel
+func (r *Ranking) Viewers(chName string) int {
+	if p, ok := r.pos[chName]; ok {
+		return r.list[p].Viewers
+	}
+	return 0
+}
+
+// Rank returns the position of the channel in the ranking, starting at 1 for the
+// most viewed channel. Unknown channels have rank 0. Channels with the same
+// number of viewers are ranked in no particular order.
+func (r *Ranking) Rank(chName string) int {
+	if p, ok := r.pos[chName]; ok {
+		return p + 1
+	}
+	return 0
+}
+
+// Len returns the number of channels in the ranking
+func (r *Ranking) Len() int {
+	return len(r.list)
+}
+
+// Top returns a copy of the n most viewed channels, or of every channel if n is negative
+func (r *Ranking) Top(n int) ChanViewersList {
+	if n < 0 || n > len(r.list) {
+		n = len(r.list)
+	}
+
+	top := make(ChanViewersList, n)
+	for i := range top {
+		cv := r.list[i]
+		top[i] = &cv
+	}
+	return top
+}
+
+// Channels returns the channel names, most viewed first
+func (r *Ranking) Channels() []string {
+	channels := make([]string, len(r.list))
+	for i, cv := range r.list {
+		channels[i] = cv.Channel
+	}
+	return channels
+}
+
+// index returns the position of a channel, adding it with no viewers if it is new
+func (r *Ranking) index(chName string) int {
+	if p, ok := r.pos[chName]; ok {
+		return p
+	}
+
+	// Counts may be negative, so move the new channel above those
+	p := len(r.list)
+	r.list = append(r.list, ChannelViewers{chName, 0, 0})
+	r.pos[chName] = p
+	for p > 0 && r.list[p-1].Viewers < 0 {
+		r.swap(p-1, p)
+		p--
+	}
+	return p
+}
+
+func (r *Ranking) swap(i, j int) {
+	if i == j {
+		return
+	}
+	r.list[i], r.list[j] = r.list[j], r.list[i]
+	r.pos[r.list[i].Channel] = i
+	r.pos[r.list[j].Channel] = j
+}
@@ -0,0 +1,108 @@
+package zlog
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	zap ".."
+)
+
+func TestRankingRandom(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	r := NewRanking()
+	want := make(map[string]int)
+
+	for i := 0; i < 20000; i++ {
+		ch := fmt.Sprintf("ch%d", rng.Intn(30))
+		if rng.Intn(3) == 0 {
+			r.Dec(ch)
+			want[ch]--
+		} else {
+			r.Inc(ch)
+			want[ch]++
+		}
+	}
+
+	if r.Len() != len(want) {
+		t.Fatalf("Len() => %v, want %v", r.Len(), len(want))
+	}
+
+	top := r.Top(-1)
+	for i, cv := range top {
+		if cv.Viewers != want[cv.Channel] {
+			t.Errorf("Top() => %v has %v viewers, want %v", cv.Channel, cv.Viewers, want[cv.Channel])
+		}
+		if i > 0 && cv.Viewers > top[i-1].Viewers {
+			t.Errorf("Top() is not sorted at %v: %v after %v", i, cv, top[i-1])
+		}
+		if r.Rank(cv.Channel) != i+1 {
+			t.Errorf("Rank(%v) => %v, want %v", cv.Channel, r.Rank(cv.Channel), i+1)
+		}
+	}
+}
+
+func TestRankingNegative(t *testing.T) {
+	r := NewRanking()
+	r.Dec("a")
+	r.Inc("b")
+	r.Inc("c")
+	r.Dec("c")
+
+	top := r.Top(-1)
+	if top[0].Channel != "b" || top[2].Channel != "a" {
+		t.Errorf("Top() => %v, want b first and a last", top)
+	}
+}
+
+// benchZaps creates n zaps between the given number of channels, with many more
+// zaps to the first channels
+func benchZaps(n, channels int) []zap.ChZap {
+	rng := rand.New(rand.NewSource(1))
+	start := time.Date(2013, 7, 20, 18, 0, 0, 0, time.UTC)
+	pick := func() string {
+		return fmt.Sprintf("ch%d", int(float64(channels)*rng.Float64()*rng.Float64()))
+	}
+
+	zaps := make([]zap.ChZap, n)
+	current := make(map[string]string)
+	for i := range zaps {
+		ip := fmt.Sprintf("10.0.%d.%d", i%5000/250, i%250)
+		to := pick()
+		from, ok := current[ip]
+		if !ok {
+			from = pick()
+		}
+		current[ip] = to
+		zaps[i] = zap.ChZap{Time: start.Add(time.Duration(i) * time.Second), IP: ip, FromChan: from, ToChan: to}
+	}
+	return zaps
+}
+
+func benchmarkFetchSorted(b *testing.B, zl ZapLogger) {
+	for _, z := range benchZaps(100000, 300) {
+		zl.LogZap(z)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		zl.FetchSorted(10)
+	}
+}
+
+func BenchmarkFetchSortedViewers(b *testing.B)  { benchmarkFetchSorted(b, NewViewersZapLogger()) }
+func BenchmarkFetchSortedAdvanced(b *testing.B) { benchmarkFetchSorted(b, NewAdvancedZapLogger()) }
+func BenchmarkFetchSortedRanked(b *testing.B)   { benchmarkFetchSorted(b, NewRankedZapLogger()) }
+
+func benchmarkLogZap(b *testing.B, zl ZapLogger) {
+	zaps := benchZaps(100000, 300)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		zl.LogZap(zaps[i%len(zaps)])
+	}
+}
+
+func BenchmarkLogZapViewers(b *testing.B) { benchmarkLogZap(b, NewViewersZapLogger()) }
+func BenchmarkLogZapRanked(b *testing.B)  { benchmarkLogZap(b, NewRankedZapLogger()) }
@@ -0,0 +1,312 @@
+// Per-viewer session tracking
+
+package zlog
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	zap "../"
+)
+
+// SpanEnd tells why a viewing span ended
+type SpanEnd uint8
+
+// The reasons a viewing span can end
+const (
+	EndZap SpanEnd = iota
+	EndPowerOff
+	EndHDMIOff
+	EndTimeout
+)
+
+func (e SpanEnd) String() string {
+	switch e {
+	case EndZap:
+		return "zap"
+	case EndPowerOff:
+		return "power off"
+	case EndHDMIOff:
+		return "HDMI off"
+	case EndTimeout:
+		return "timeout"
+	}
+	return "unknown"
+}
+
+// Span is a completed period during which a set-top box was tuned to a channel
+// with a TV connected
+type Span struct {
+	IP      string
+	Channel string
+	Start   time.Time
+	End     time.Time
+	// Muted is the part of the span during which the box was muted
+	Muted  time.Duration
+	Reason SpanEnd
+}
+
+// Duration returns the length of the span
+func (s Span) Duration() time.Duration {
+	return s.End.Sub(s.Start)
+}
+
+func (s Span) String() string {
+	return fmt.Sprintf("%v watched %v for %v (muted %v), ended by %v",
+		s.IP, s.Channel, s.Duration(), s.Muted, s.Reason)
+}
+
+// BoxState is the state of a set-top box as seen by the session tracker
+type BoxState struct {
+	// Channel is the channel the box is tuned to, or empty if the box is off
+	// or the channel is not known yet
+	Channel string
+	// Since is when the current span started. It is zero when there is no
+	// span, such as when the channel was not known until the box zapped away
+	// from it.
+	Since time.Time
+	// Muted and HDMI are the latest mute and HDMI statuses. HDMI is true while
+	// a TV is connected and turned on.
+	Muted bool
+	HDMI  bool
+	// MutedSince is when the box was muted, if it still is
+	MutedSince time.Time
+	// MutedTime is the muted time accumulated in the current span
+	MutedTime time.Duration
+	// LastSeen is the timestamp of the box's latest event
+	LastSeen time.Time
+}
+
+// watching returns true if the box has an open span
+func (b *BoxState) watching() bool {
+	return b.Channel != "" && b.HDMI && !b.Since.IsZero()
+}
+
+// SessionTracker models each set-top box as a state machine and emits viewing
+// spans as they are completed. Spans end when the box zaps to another channel,
+// is turned off, loses its TV (HDMI_Status: 0), or has not sent any events for
+// the inactivity timeout. Timestamps are taken from the events, not the wall
+// clock.
+type SessionTracker struct {
+	boxes     map[string]*BoxState
+	timeout   time.Duration
+	consumers []func(Span)
+	now       time.Time
+	expired   time.Time
+	mu        sync.Mutex
+}
+
+// NewSessionTracker creates a session tracker which expires boxes that have not
+// sent any events for the given timeout
+func NewSessionTracker(timeout time.Duration) *SessionTracker {
+	return &SessionTracker{
+		boxes:   make(map[string]*BoxState),
+		timeout: timeout,
+	}
+}
+
+// Subscribe registers a consumer of completed spans. Consumers are called in
+// the order they were registered, and never while the tracker is locked.
+func (st *SessionTracker) Subscribe(consumer func(Span)) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	st.consumers = append(st.consumers, consumer)
+}
+
+// LogZap updates the box's state with a channel change
+func (st *SessionTracker) LogZap(z zap.ChZap) {
+	st.mu.Lock()
+	spans := st.expire(z.Time)
+
+	b := st.box(z.IP, z.Time)
+
+	reason := EndZap
+	if z.ToChan == zap.Off {
+		reason = EndPowerOff
+	}
+	spans = st.closeSpan(spans, z.IP, b, z.Time, reason)
+
+	if z.ToChan == zap.Off {
+		b.Channel = ""
+		b.Since = time.Time{}
+	} else {
+		// A box being turned on is also connected to a TV, unless it says otherwise
+		if z.FromChan == zap.Off {
+			b.HDMI = true
+		}
+		b.Channel = z.ToChan
+		b.Since = z.Time
+	}
+	b.resetMuted(z.Time)
+
+	st.mu.Unlock()
+	st.emit(spans)
+}
+
+// LogStatus updates the box's state with a status change. Volume changes only
+// count as activity.
+func (st *SessionTracker) LogStatus(s zap.StatusChange) {
+	st.mu.Lock()
+	spans := st.expire(s.Time)
+
+	b := st.box(s.IP, s.Time)
+
+	switch s.Kind {
+	case zap.StatusMute:
+		muted := s.Value == 1
+		if muted && !b.Muted {
+			b.MutedSince = s.Time
+		} else if !muted && b.Muted && b.watching() {
+			b.MutedTime += s.Time.Sub(b.mutedFrom(b.Since))
+		}
+		b.Muted = muted
+	case zap.StatusHDMI:
+		hdmi := s.Value == 1
+		if !hdmi && b.HDMI {
+			spans = st.closeSpan(spans, s.IP, b, s.Time, EndHDMIOff)
+			b.Since = time.Time{}
+		} else if hdmi && !b.HDMI && b.Channel != "" {
+			b.Since = s.Time
+			b.resetMuted(s.Time)
+		}
+		b.HDMI = hdmi
+	}
+
+	st.mu.Unlock()
+	st.emit(spans)
+}
+
+// Expire closes the spans of boxes that have been inactive for longer than the
+// timeout at the given time, and forgets those boxes
+func (st *SessionTracker) Expire(now time.Time) {
+	st.mu.Lock()
+	st.expired = time.Time{}
+	spans := st.expire(now)
+	st.mu.Unlock()
+
+	st.emit(spans)
+}
+
+// State returns a copy of the state of a box
+func (st *SessionTracker) State(ip string) (BoxState, bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if b, ok := st.boxes[ip]; ok {
+		return *b, true
+	}
+	return BoxState{}, false
+}
+
+// openSpan returns the channel of the box's open span and its muted time up to
+// the given time, or an empty channel if the box has no open span
+func (st *SessionTracker) openSpan(ip string, now time.Time) (string, time.Duration) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if b, ok := st.boxes[ip]; ok && b.watching() {
+		return b.Channel, b.mutedUntil(now)
+	}
+	return "", 0
+}
+
+// Boxes returns the number of boxes being tracked
+func (st *SessionTracker) Boxes() int {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	return len(st.boxes)
+}
+
+// box returns the state of a box, adding it if it is new. The caller must hold the lock.
+func (st *SessionTracker) box(ip string, t time.Time) *BoxState {
+	b, ok := st.boxes[ip]
+	if !ok {
+		b = &BoxState{HDMI: true}
+		st.boxes[ip] = b
+	}
+	b.LastSeen = t
+	return b
+}
+
+// closeSpan appends the box's open span, if any, ending at the given time. The
+// caller must hold the lock.
+func (st *SessionTracker) closeSpan(spans []Span, ip string, b *BoxState, end time.Time, reason SpanEnd) []Span {
+	if !b.watching() {
+		return spans
+	}
+
+	return append(spans, Span{
+		IP:      ip,
+		Channel: b.Channel,
+		Start:   b.Since,
+		End:     end,
+		Muted:   b.mutedUntil(end),
+		Reason:  reason,
+	})
+}
+
+// expire closes the spans of inactive boxes. Boxes are only scanned once per
+// half timeout of event time. The caller must hold the lock.
+func (st *SessionTracker) expire(now time.Time) []Span {
+	if now.After(st.now) {
+		st.now = now
+	}
+	if st.timeout <= 0 || st.now.Sub(st.expired) < st.timeout/2 {
+		return nil
+	}
+	st.expired = st.now
+
+	var spans []Span
+	for ip, b := range st.boxes {
+		if st.now.Sub(b.LastSeen) > st.timeout {
+			spans = st.closeSpan(spans, ip, b, b.LastSeen.Add(st.timeout), EndTimeout)
+			delete(st.boxes, ip)
+		}
+	}
+	return spans
+}
+
+func (st *SessionTracker) emit(spans []Span) {
+	if len(spans) == 0 {
+		return
+	}
+
+	st.mu.Lock()
+	consumers := st.consumers
+	st.mu.Unlock()
+
+	for _, s := range spans {
+		for _, c := range consumers {
+			c(s)
+		}
+	}
+}
+
+// mutedFrom returns when the current muting started counting towards a span
+// that started at the given time
+func (b *BoxState) mutedFrom(start time.Time) time.Time {
+	if b.MutedSince.Before(start) {
+		return start
+	}
+	return b.MutedSince
+}
+
+// mutedUntil returns the muted time of the current span up to the given time
+func (b *BoxState) mutedUntil(t time.Time) time.Duration {
+	muted := b.MutedTime
+	if b.Muted {
+		muted += t.Sub(b.mutedFrom(b.Since))
+	}
+	return muted
+}
+
+// resetMuted starts counting muted time for a new span
+func (b *BoxState) resetMuted(t time.Time) {
+	b.MutedTime = 0
+	if b.Muted {
+		b.MutedSince = t
+	}
+}
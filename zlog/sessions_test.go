@@ -0,0 +1,82 @@
+package zlog
+
+import (
+	"testing"
+	"time"
+
+	zap ".."
+)
+
+var sessionStart = time.Date(2013, 7, 20, 18, 0, 0, 0, time.UTC)
+
+// at returns the test start time plus the given number of minutes
+func at(minutes int) time.Time {
+	return sessionStart.Add(time.Duration(minutes) * time.Minute)
+}
+
+func TestSessionTracker(t *testing.T) {
+	st := NewSessionTracker(time.Hour)
+	var spans []Span
+	st.Subscribe(func(s Span) { spans = append(spans, s) })
+
+	ip := "10.0.0.1"
+	st.LogZap(zap.ChZap{Time: at(0), IP: ip, FromChan: "OFF", ToChan: "NRK1"})
+	st.LogStatus(zap.StatusChange{Time: at(5), IP: ip, Kind: zap.StatusMute, Value: 1})
+	st.LogStatus(zap.StatusChange{Time: at(8), IP: ip, Kind: zap.StatusMute, Value: 0})
+	st.LogZap(zap.ChZap{Time: at(10), IP: ip, FromChan: "NRK1", ToChan: "TV2 Norge"})
+	st.LogStatus(zap.StatusChange{Time: at(12), IP: ip, Kind: zap.StatusMute, Value: 1})
+	st.LogStatus(zap.StatusChange{Time: at(15), IP: ip, Kind: zap.StatusHDMI, Value: 0})
+	st.LogStatus(zap.StatusChange{Time: at(20), IP: ip, Kind: zap.StatusHDMI, Value: 1})
+	st.LogZap(zap.ChZap{Time: at(30), IP: ip, FromChan: "TV2 Norge", ToChan: "OFF"})
+
+	want := []Span{
+		{ip, "NRK1", at(0), at(10), 3 * time.Minute, EndZap},
+		{ip, "TV2 Norge", at(10), at(15), 3 * time.Minute, EndHDMIOff},
+		{ip, "TV2 Norge", at(20), at(30), 10 * time.Minute, EndPowerOff},
+	}
+
+	if len(spans) != len(want) {
+		t.Fatalf("got spans %v, want %v", spans, want)
+	}
+	for i := range want {
+		if spans[i] != want[i] {
+			t.Errorf("span %v => %v, want %v", i, spans[i], want[i])
+		}
+	}
+
+	state, ok := st.State(ip)
+	if !ok || state.Channel != "" || !state.Muted {
+		t.Errorf("State(%v) => %+v, want a muted box that is off", ip, state)
+	}
+}
+
+func TestSessionTrackerTimeout(t *testing.T) {
+	st := NewSessionTracker(time.Hour)
+	var spans []Span
+	st.Subscribe(func(s Span) { spans = append(spans, s) })
+
+	// The first box zaps from a channel it was on before tracking started, so
+	// only its new channel gives a span
+	st.LogZap(zap.ChZap{Time: at(0), IP: "10.0.0.1", FromChan: "NRK2", ToChan: "NRK1"})
+	st.LogZap(zap.ChZap{Time: at(0), IP: "10.0.0.2", FromChan: "NRK2", ToChan: "NRK3"})
+	st.LogZap(zap.ChZap{Time: at(50), IP: "10.0.0.2", FromChan: "NRK3", ToChan: "NRK1"})
+	st.Expire(at(100))
+
+	want := []Span{
+		{"10.0.0.2", "NRK3", at(0), at(50), 0, EndZap},
+		{"10.0.0.1", "NRK1", at(0), at(60), 0, EndTimeout},
+	}
+
+	if len(spans) != len(want) {
+		t.Fatalf("got spans %v, want %v", spans, want)
+	}
+	for i := range want {
+		if spans[i] != want[i] {
+			t.Errorf("span %v => %v, want %v", i, spans[i], want[i])
+		}
+	}
+
+	if st.Boxes() != 1 {
+		t.Errorf("Boxes() => %v, want 1 after the inactive box expired", st.Boxes())
+	}
+}
@@ -12,23 +12,77 @@ import (
 	zap "../"
 )
 
-type Zaps []zap.ChZap
+// Zaps stores every logged zap event in a slice
+type Zaps struct {
+	zaps []zap.ChZap
+	hdmi []loggedStatus
+	mu   sync.RWMutex
+}
 
-var mutex = &sync.Mutex{}
+// loggedStatus is an HDMI status change logged after the given number of zaps
+type loggedStatus struct {
+	zaps   int
+	status zap.StatusChange
+}
 
 func NewSimpleZapLogger() ZapLogger {
-	zs := make(Zaps, 0)
-	return &zs
+	zs := new(Zaps)
+	zs.zaps = make([]zap.ChZap, 0)
+	return zs
 }
 
 // LogZap adds a zap to the log
 func (zs *Zaps) LogZap(z zap.ChZap) {
-	*zs = append(*zs, z)
+	zs.mu.Lock()
+	defer zs.mu.Unlock()
+
+	zs.zaps = append(zs.zaps, z)
+}
+
+// LogStatus adds a status change to the log. Only HDMI_Status is kept.
+func (zs *Zaps) LogStatus(s zap.StatusChange) {
+	if s.Kind != zap.StatusHDMI {
+		return
+	}
+
+	zs.mu.Lock()
+	defer zs.mu.Unlock()
+
+	zs.hdmi = append(zs.hdmi, loggedStatus{len(zs.zaps), s})
 }
 
 // Entries returns the number of logged zap events
 func (zs *Zaps) Entries() int {
-	return len(*zs)
+	zs.mu.RLock()
+	defer zs.mu.RUnlock()
+
+	return len(zs.zaps)
+}
+
+// PoweredOn returns the number of boxes whose latest zap was not to OFF
+func (zs *Zaps) PoweredOn() int {
+	zs.mu.RLock()
+	defer zs.mu.RUnlock()
+
+	var on int
+	for _, ch := range zs.current() {
+		if ch != zap.Off {
+			on++
+		}
+	}
+	return on
+}
+
+// Coverage tells how much of the audience the viewer counts are based on
+func (zs *Zaps) Coverage() Coverage {
+	zs.mu.RLock()
+	defer zs.mu.RUnlock()
+
+	bt := newBoxTracker()
+	for _, z := range zs.zaps {
+		bt.track(z)
+	}
+	return bt.coverage()
 }
 
 // String returns the name of the logger
@@ -43,35 +97,91 @@ func (zs *Zaps) Viewers(chName string) int {
 		defer zap.TimeElapsed(time.Now(), "simple.Viewers")
 	}
 
-	mutex.Lock()
-	defer mutex.Unlock()
+	zs.mu.RLock()
+	defer zs.mu.RUnlock()
+
+	return zs.viewers(chName)
+}
+
+// viewers counts the boxes whose latest zap was to the channel. The caller
+// must hold the lock.
+func (zs *Zaps) viewers(chName string) int {
 	var viewers int
-	for _, zap := range *zs {
-		switch chName {
-		case zap.ToChan:
+	if chName == zap.Off {
+		return viewers
+	}
+	for _, ch := range zs.current() {
+		if ch == chName {
 			viewers++
-		case zap.FromChan:
-			if viewers > 0 {
-				viewers--
-			}
 		}
 	}
 	return viewers
 }
 
+// Watching returns the current number of viewers of a given channel with their TV on
+func (zs *Zaps) Watching(chName string) int {
+	if PrintTimes {
+		defer zap.TimeElapsed(time.Now(), zs.String()+".Watching")
+	}
+
+	zs.mu.RLock()
+	defer zs.mu.RUnlock()
+
+	return zs.watching()[chName]
+}
+
+// watching counts the viewers of every channel with their TV on, by replaying
+// the zaps and HDMI statuses in the order they were logged. The caller must
+// hold the lock.
+func (zs *Zaps) watching() ChannelCounts {
+	bt := newBoxTracker()
+	watching := make(ChannelCounts)
+
+	var h int
+	for i := 0; i <= len(zs.zaps); i++ {
+		for ; h < len(zs.hdmi) && zs.hdmi[h].zaps == i; h++ {
+			watching.move(bt.hdmi(zs.hdmi[h].status))
+		}
+		if i < len(zs.zaps) {
+			m := bt.track(zs.zaps[i])
+			watching.move(m.watchFrom, m.watchTo)
+		}
+	}
+	return watching
+}
+
+// current maps every box to the channel of its latest zap. The caller must
+// hold the lock.
+func (zs *Zaps) current() map[string]string {
+	last := make(map[string]string)
+	for _, z := range zs.zaps {
+		last[z.IP] = z.ToChan
+	}
+	return last
+}
+
 // Channels creates a slice of the channels found in the zaps (both to and from).
 func (zs *Zaps) Channels() []string {
-	var channels []string
-
 	if PrintTimes {
 		defer zap.TimeElapsed(time.Now(), zs.String()+".Channels")
 	}
 
+	zs.mu.RLock()
+	defer zs.mu.RUnlock()
+
+	return zs.channels()
+}
+
+// channels lists the unique channels. The caller must hold the lock.
+func (zs *Zaps) channels() []string {
+	var channels []string
+
 	chanMap := make(map[string]int) //Using maps to easily find unique channels in Zaps
-	for _, v := range *zs {
+	for _, v := range zs.zaps {
 		chanMap[v.ToChan] = 1
 		chanMap[v.FromChan] = 1
 	}
+	delete(chanMap, zap.Off)
 	for k := range chanMap {
 		channels = append(channels, k)
 	}
@@ -80,18 +190,24 @@ func (zs *Zaps) Channels() []string {
 
 // ChannelsViewers creates a slice of ChannelViewers, which is defined in zaplogger.go.
 // This is the number of viewers for each channel.
-// A positive non-zero input argument will return the given amount of elements, while a negative argument will return all elements in
-// the list.
 func (zs *Zaps) ChannelsViewers() []*ChannelViewers {
-	var ChanViewersList ChanViewersList
-
 	if PrintTimes {
 		defer zap.TimeElapsed(time.Now(), zs.String()+".ChannelsViewers")
 	}
 
-	channels := zs.Channels()
-	for _, channel := range channels {
-		chanViews := ChannelViewers{channel, zs.Viewers(channel)}
+	zs.mu.RLock()
+	defer zs.mu.RUnlock()
+
+	return zs.channelsViewers()
+}
+
+// channelsViewers counts the viewers of every channel. The caller must hold the lock.
+func (zs *Zaps) channelsViewers() ChanViewersList {
+	var ChanViewersList ChanViewersList
+
+	watching := zs.watching()
+	for _, channel := range zs.channels() {
+		chanViews := ChannelViewers{channel, zs.viewers(channel), watching[channel]}
 		ChanViewersList = append(ChanViewersList, &chanViews)
 	}
 
@@ -99,8 +215,7 @@ func (zs *Zaps) ChannelsViewers() []*ChannelViewers {
 }
 
 // FetchSorted returns a list of channels and viewers, sorted by viewers
-// A positive non-zero input argument will return the given amount of elements, while a negative argument will return all elements in
-// the list.
+// At most i elements are returned.
 func (zs *Zaps) FetchSorted(i uint8) ChanViewersList {
 	var bv ByViewers
 
@@ -108,9 +223,17 @@ func (zs *Zaps) FetchSorted(i uint8) ChanViewersList {
 		defer zap.TimeElapsed(time.Now(), zs.String()+".FetchSorted")
 	}
 
-	bv.ChanViewersList = zs.ChannelsViewers()
+	zs.mu.RLock()
+	bv.ChanViewersList = zs.channelsViewers()
+	zs.mu.RUnlock()
+
 	sort.Sort(sort.Reverse(ByViewers(bv)))
-	return bv.ChanViewersList[:i]
+
+	if bv.ChanViewersList.Len() > int(i) {
+		return bv.ChanViewersList[:i]
+	}
+
+	return bv.ChanViewersList
 }
 
 // FetchStats is not supported by simplelogger and will return a nil map
@@ -0,0 +1,250 @@
+// Snapshot Zap logger
+
+package zlog
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	zap "../"
+)
+
+// Snapshot is an immutable view of a SnapshotZapLogger's state. It must not be
+// modified by its readers.
+type Snapshot struct {
+	// Seq is incremented for every published snapshot
+	Seq uint64
+	// Time is the timestamp of the latest zap included in the snapshot
+	Time time.Time
+	// Sorted holds every channel sorted by viewers, most viewed first
+	Sorted   ChanViewersList
+	Viewers  ChannelCounts
+	Watching ChannelCounts
+	Stats    map[string]ZapStats
+	// PoweredOn is the number of boxes that are turned on
+	PoweredOn int
+	Coverage  Coverage
+}
+
+// SnapshotZapLogger is made for many readers and a single steady writer. LogZap
+// updates private state and publishes an immutable snapshot of it at a fixed
+// interval, which the readers use without taking any locks. Readers see the
+// state as of the latest snapshot. Start publishes the latest events when the
+// writer goes quiet as well.
+type SnapshotZapLogger struct {
+	// Written by LogZap only
+	state     zapState
+	last      time.Time
+	seq       uint64
+	published time.Time
+	interval  time.Duration
+	// Whether events have been logged since the latest snapshot
+	dirty bool
+	mu    sync.Mutex
+
+	snap atomic.Value // *Snapshot
+
+	// Closed by Stop to end the goroutine started by Start
+	done chan struct{}
+}
+
+// NewSnapshotZapLogger creates a snapshot logger which publishes a new snapshot
+// at most once per interval. An interval of zero publishes on every zap.
+func NewSnapshotZapLogger(interval time.Duration) ZapLogger {
+	szl := new(SnapshotZapLogger)
+	szl.state = newZapState()
+	szl.interval = interval
+	szl.snap.Store(&Snapshot{Viewers: make(ChannelCounts), Watching: make(ChannelCounts), Stats: make(map[string]ZapStats)})
+	return szl
+}
+
+// LogZap adds a zap to the log, publishing a snapshot if the interval has passed
+func (szl *SnapshotZapLogger) LogZap(z zap.ChZap) {
+	szl.mu.Lock()
+	defer szl.mu.Unlock()
+
+	szl.state.logZap(z)
+	szl.last = z.Time
+	szl.dirty = true
+
+	if time.Since(szl.published) >= szl.interval {
+		szl.publish()
+	}
+}
+
+// LogStatus adds a status change to the log, publishing a snapshot if the
+// interval has passed. Only HDMI_Status is used.
+func (szl *SnapshotZapLogger) LogStatus(s zap.StatusChange) {
+	szl.mu.Lock()
+	defer szl.mu.Unlock()
+
+	szl.state.logStatus(s)
+	szl.dirty = true
+
+	if time.Since(szl.published) >= szl.interval {
+		szl.publish()
+	}
+}
+
+// Publish publishes a snapshot right away, such as when the writer goes quiet
+func (szl *SnapshotZapLogger) Publish() {
+	szl.mu.Lock()
+	defer szl.mu.Unlock()
+
+	szl.publish()
+}
+
+// Start publishes a snapshot every interval from a goroutine, if events have
+// been logged since the previous one, so that readers see the end of a burst
+// of events without waiting for the next event. It does nothing with an
+// interval of zero, which publishes on every zap.
+func (szl *SnapshotZapLogger) Start() {
+	szl.mu.Lock()
+	defer szl.mu.Unlock()
+
+	if szl.interval <= 0 || szl.done != nil {
+		return
+	}
+	szl.done = make(chan struct{})
+	go szl.run(szl.done)
+}
+
+// Stop stops publishing snapshots from the goroutine started by Start
+func (szl *SnapshotZapLogger) Stop() {
+	szl.mu.Lock()
+	defer szl.mu.Unlock()
+
+	if szl.done != nil {
+		close(szl.done)
+		szl.done = nil
+	}
+}
+
+func (szl *SnapshotZapLogger) run(done <-chan struct{}) {
+	ticker := time.NewTicker(szl.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			szl.mu.Lock()
+			if szl.dirty {
+				szl.publish()
+			}
+			szl.mu.Unlock()
+		}
+	}
+}
+
+// publish copies the private state into a new snapshot. The caller must hold the lock.
+func (szl *SnapshotZapLogger) publish() {
+	var bv ByViewers
+
+	szl.seq++
+	snap := &Snapshot{
+		Seq:      szl.seq,
+		Time:     szl.last,
+		Viewers:  szl.state.chanMap.copyViewers(),
+		Watching: szl.state.watching.copyViewers(),
+		Stats:    szl.state.summaries(),
+
+		PoweredOn: szl.state.on,
+		Coverage:  szl.state.boxes.coverage(),
+	}
+
+	bv.ChanViewersList = snap.Viewers.channelsViewers(snap.Watching)
+	sort.Stable(sort.Reverse(ByViewers(bv)))
+	snap.Sorted = bv.ChanViewersList
+
+	szl.snap.Store(snap)
+	szl.published = time.Now()
+	szl.dirty = false
+}
+
+// Snapshot returns the latest published snapshot
+func (szl *SnapshotZapLogger) Snapshot() *Snapshot {
+	return szl.snap.Load().(*Snapshot)
+}
+
+// PoweredOn returns the number of boxes turned on in the latest snapshot
+func (szl *SnapshotZapLogger) PoweredOn() int {
+	return szl.Snapshot().PoweredOn
+}
+
+// Coverage returns the coverage of the latest snapshot
+func (szl *SnapshotZapLogger) Coverage() Coverage {
+	return szl.Snapshot().Coverage
+}
+
+// Entries returns the number of channels in the latest snapshot
+func (szl *SnapshotZapLogger) Entries() int {
+	return len(szl.Snapshot().Viewers)
+}
+
+// String returns the name of the logger
+func (szl *SnapshotZapLogger) String() string {
+	return "Snapshot Logger"
+}
+
+// Viewers returns the number of viewers for a given channel
+func (szl *SnapshotZapLogger) Viewers(chName string) int {
+	if PrintTimes {
+		defer zap.TimeElapsed(time.Now(), szl.String()+".Viewers")
+	}
+
+	return szl.Snapshot().Viewers[chName]
+}
+
+// Watching returns the number of viewers of a given channel with their TV on
+func (szl *SnapshotZapLogger) Watching(chName string) int {
+	return szl.Snapshot().Watching[chName]
+}
+
+// Channels returns a list of channels in the log, most viewed first
+func (szl *SnapshotZapLogger) Channels() []string {
+	if PrintTimes {
+		defer zap.TimeElapsed(time.Now(), szl.String()+".Channels")
+	}
+
+	sorted := szl.Snapshot().Sorted
+	channels := make([]string, len(sorted))
+	for i, cv := range sorted {
+		channels[i] = cv.Channel
+	}
+
+	return channels
+}
+
+// ChannelsViewers creates a slice of ChannelViewers which is defined in zaplogger.go.
+// This is the number of viewers for each channel.
+func (szl *SnapshotZapLogger) ChannelsViewers() []*ChannelViewers {
+	if PrintTimes {
+		defer zap.TimeElapsed(time.Now(), szl.String()+".ChannelsViewers")
+	}
+
+	return szl.Snapshot().Sorted.copyN(-1)
+}
+
+// FetchSorted returns a list of channels and viewers, sorted by viewers
+// At most i elements are returned.
+func (szl *SnapshotZapLogger) FetchSorted(i uint8) ChanViewersList {
+	if PrintTimes {
+		defer zap.TimeElapsed(time.Now(), szl.String()+".FetchSorted")
+	}
+
+	return szl.Snapshot().Sorted.copyN(int(i))
+}
+
+// FetchStats returns a copy of the map of channel and Zapstat pairs
+func (szl *SnapshotZapLogger) FetchStats() *map[string]ZapStats {
+	if PrintTimes {
+		defer zap.TimeElapsed(time.Now(), szl.String()+".FetchStats")
+	}
+
+	stats := copyStats(szl.Snapshot().Stats)
+	return &stats
+}
@@ -0,0 +1,81 @@
+package zlog
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSnapshotPublishing(t *testing.T) {
+	szl := NewSnapshotZapLogger(time.Hour).(*SnapshotZapLogger)
+	zaps := testZaps(100)
+
+	// The first zap is published right away, the rest wait for the interval
+	for _, z := range zaps {
+		szl.LogZap(z)
+	}
+
+	snap := szl.Snapshot()
+	if snap.Seq != 1 || !snap.Time.Equal(zaps[0].Time) {
+		t.Errorf("Snapshot() => seq %v time %v, want seq 1 time %v", snap.Seq, snap.Time, zaps[0].Time)
+	}
+	if szl.Entries() != 1 {
+		t.Errorf("Entries() => %v, want 1 before publishing", szl.Entries())
+	}
+
+	szl.Publish()
+
+	snap = szl.Snapshot()
+	if snap.Seq != 2 || !snap.Time.Equal(zaps[len(zaps)-1].Time) {
+		t.Errorf("Snapshot() => seq %v time %v, want seq 2 time %v", snap.Seq, snap.Time, zaps[len(zaps)-1].Time)
+	}
+
+	for i := 1; i < len(snap.Sorted); i++ {
+		if snap.Sorted[i].Viewers > snap.Sorted[i-1].Viewers {
+			t.Errorf("Snapshot().Sorted is not sorted by viewers: %v", snap.Sorted)
+		}
+	}
+
+	top := szl.FetchSorted(1)
+	if len(top) != 1 || top[0].Viewers != snap.Sorted[0].Viewers {
+		t.Errorf("FetchSorted(1) => %v, want %v", top, snap.Sorted[:1])
+	}
+}
+
+// TestSnapshotTicker checks that the last zap of a burst is published within
+// an interval once the writer goes quiet
+func TestSnapshotTicker(t *testing.T) {
+	interval := 20 * time.Millisecond
+	szl := NewSnapshotZapLogger(interval).(*SnapshotZapLogger)
+	szl.Start()
+	defer szl.Stop()
+
+	zaps := testZaps(100)
+	for _, z := range zaps {
+		szl.LogZap(z)
+	}
+	last := zaps[len(zaps)-1].Time
+
+	deadline := time.Now().Add(50 * interval)
+	for !szl.Snapshot().Time.Equal(last) {
+		if time.Now().After(deadline) {
+			t.Fatalf("Snapshot().Time => %v after %v without zaps, want %v", szl.Snapshot().Time, 50*interval, last)
+		}
+		time.Sleep(interval / 4)
+	}
+
+	// Nothing new is published while the writer is quiet
+	seq := szl.Snapshot().Seq
+	time.Sleep(3 * interval)
+	if snap := szl.Snapshot(); snap.Seq != seq {
+		t.Errorf("Snapshot().Seq => %v without new zaps, want %v", snap.Seq, seq)
+	}
+
+	// After Stop only zaps publish, the first right away and the second not
+	szl.Stop()
+	szl.LogZap(zaps[0])
+	szl.LogZap(zaps[1])
+	time.Sleep(3 * interval)
+	if snap := szl.Snapshot(); snap.Seq != seq+1 {
+		t.Errorf("Snapshot().Seq => %v after Stop, want %v", snap.Seq, seq+1)
+	}
+}
@@ -0,0 +1,357 @@
+// Logger state for snapshots
+
+package zlog
+
+import (
+	"sort"
+	"time"
+
+	zap "../"
+)
+
+// State is a compact copy of a logger's state, as saved in snapshots. It is
+// the same for every logger that can be saved, so a snapshot taken with one
+// logger can be restored into another. Loggers use the parts they keep.
+type State struct {
+	// Seq is the sequence number of the last zap included in the state
+	Seq uint64
+
+	Viewers ChannelCounts
+	Boxes   map[string]BoxRecord
+	Stats   map[string]StatsRecord
+
+	// Counters of the box tracker, see Coverage
+	Zaps          int
+	UnknownOrigin int
+
+	// Flows holds the transition matrices of the flow logger
+	Flows []TransitionMatrix `json:",omitempty"`
+
+	// Sessions and Muted hold the boxes and the channel statistics of the mute
+	// logger
+	Sessions map[string]BoxState   `json:",omitempty"`
+	Muted    map[string]MuteRecord `json:",omitempty"`
+}
+
+// BoxRecord holds the latest zap of a box, the number of zaps it has made and
+// whether its TV is off
+type BoxRecord struct {
+	Last  zap.ChZap
+	Zaps  uint32
+	TVOff bool `json:",omitempty"`
+}
+
+// StatsRecord holds the viewing duration statistics of a channel. Mean and M2
+// are in nanoseconds and nanoseconds squared, and Buckets are the buckets of
+// the duration sketch.
+type StatsRecord struct {
+	N       uint64
+	Mean    float64
+	M2      float64
+	Min     time.Duration
+	Max     time.Duration
+	Buckets map[int]uint64
+}
+
+// MuteRecord holds the mute statistics of a channel: the muted time of each
+// viewer in completed spans, and the number of viewers muted now and at the peak
+type MuteRecord struct {
+	Viewers  map[string]time.Duration
+	Total    time.Duration
+	Muted    int
+	Peak     int
+	PeakTime time.Time
+}
+
+// stateSaver is implemented by loggers whose state can be saved in a State
+// and restored from one. restoreState is only called on a new logger.
+type stateSaver interface {
+	saveState() *State
+	restoreState(st *State)
+}
+
+// save copies the tracked boxes into st
+func (bt *boxTracker) save(st *State) {
+	st.Boxes = make(map[string]BoxRecord, len(bt.boxes))
+	for ip, b := range bt.boxes {
+		st.Boxes[ip] = BoxRecord{Last: b.last, Zaps: b.zaps, TVOff: b.tvOff}
+	}
+	st.Zaps = bt.zaps
+	st.UnknownOrigin = bt.unknown
+}
+
+// restore replaces the tracked boxes with the ones in st
+func (bt *boxTracker) restore(st *State) {
+	*bt = newBoxTracker()
+	for ip, b := range st.Boxes {
+		bt.boxes[ip] = &trackedBox{last: b.Last, zaps: b.Zaps, tvOff: b.TVOff}
+		if b.Zaps == 1 {
+			bt.once++
+		}
+	}
+	bt.zaps = st.Zaps
+	bt.unknown = st.UnknownOrigin
+}
+
+// watching counts the tracked boxes that are watching each channel
+func (bt *boxTracker) watching() ChannelCounts {
+	watching := make(ChannelCounts)
+	for _, b := range bt.boxes {
+		if b.last.ToChan != zap.Off && !b.tvOff {
+			watching[b.last.ToChan]++
+		}
+	}
+	return watching
+}
+
+// record returns the statistics as a StatsRecord
+func (ds *durationStats) record() StatsRecord {
+	r := StatsRecord{N: ds.n, Mean: ds.mean, M2: ds.m2, Min: ds.min, Max: ds.max}
+	r.Buckets = make(map[int]uint64, len(ds.sketch.buckets))
+	for k, n := range ds.sketch.buckets {
+		r.Buckets[k] = n
+	}
+	return r
+}
+
+// durationStatsFrom creates statistics from a StatsRecord
+func durationStatsFrom(r StatsRecord) *durationStats {
+	ds := &durationStats{n: r.N, mean: r.Mean, m2: r.M2, min: r.Min, max: r.Max}
+	ds.sketch = NewDurationSketch()
+	for k, n := range r.Buckets {
+		ds.sketch.buckets[k] = n
+		ds.sketch.count += n
+	}
+	return ds
+}
+
+// copyViewers returns a copy of the viewer counts
+func (zm ChannelCounts) copyViewers() ChannelCounts {
+	c := make(ChannelCounts, len(zm))
+	for k, v := range zm {
+		c[k] = v
+	}
+	return c
+}
+
+func (zs *zapState) saveState() *State {
+	st := &State{Viewers: zs.chanMap.copyViewers()}
+	zs.boxes.save(st)
+
+	st.Stats = make(map[string]StatsRecord, len(zs.stats))
+	for k, v := range zs.stats {
+		st.Stats[k] = v.record()
+	}
+	return st
+}
+
+func (zs *zapState) restoreState(st *State) {
+	*zs = newZapState()
+	zs.chanMap = st.Viewers.copyViewers()
+	zs.on = zs.chanMap.total()
+	zs.boxes.restore(st)
+	zs.watching = zs.boxes.watching()
+
+	for k, v := range st.Stats {
+		zs.stats[k] = durationStatsFrom(v)
+	}
+}
+
+func (azl *AdvancedZapLogger) saveState() *State {
+	azl.mu.RLock()
+	defer azl.mu.RUnlock()
+
+	return azl.zapState.saveState()
+}
+
+func (azl *AdvancedZapLogger) restoreState(st *State) {
+	azl.mu.Lock()
+	defer azl.mu.Unlock()
+
+	azl.zapState.restoreState(st)
+}
+
+func (szl *SnapshotZapLogger) saveState() *State {
+	szl.mu.Lock()
+	defer szl.mu.Unlock()
+
+	return szl.state.saveState()
+}
+
+// restoreState restores the state and publishes it right away
+func (szl *SnapshotZapLogger) restoreState(st *State) {
+	szl.mu.Lock()
+	defer szl.mu.Unlock()
+
+	szl.state.restoreState(st)
+	szl.publish()
+}
+
+func (zm *ZapsMap) saveState() *State {
+	zm.mu.RLock()
+	defer zm.mu.RUnlock()
+
+	st := &State{Viewers: zm.chanMap.copyViewers()}
+	zm.boxes.save(st)
+	return st
+}
+
+func (zm *ZapsMap) restoreState(st *State) {
+	zm.mu.Lock()
+	defer zm.mu.Unlock()
+
+	zm.chanMap = st.Viewers.copyViewers()
+	zm.boxes.restore(st)
+	zm.watching = zm.boxes.watching()
+}
+
+func (rzl *RankedZapLogger) saveState() *State {
+	rzl.mu.RLock()
+	defer rzl.mu.RUnlock()
+
+	st := &State{Viewers: make(ChannelCounts, rzl.ranking.Len())}
+	for _, cv := range rzl.ranking.list {
+		st.Viewers[cv.Channel] = cv.Viewers
+	}
+	rzl.boxes.save(st)
+	return st
+}
+
+func (rzl *RankedZapLogger) restoreState(st *State) {
+	rzl.mu.Lock()
+	defer rzl.mu.Unlock()
+
+	rzl.ranking = rankingFrom(st.Viewers)
+	rzl.on = st.Viewers.total()
+	rzl.boxes.restore(st)
+	rzl.watching = rzl.boxes.watching()
+}
+
+// rankingFrom creates a ranking of the channels in the map
+func rankingFrom(zm ChannelCounts) *Ranking {
+	r := NewRanking()
+	for k, v := range zm {
+		r.list = append(r.list, ChannelViewers{k, v, 0})
+	}
+	sort.SliceStable(r.list, func(i, j int) bool { return r.list[i].Viewers > r.list[j].Viewers })
+	for i, cv := range r.list {
+		r.pos[cv.Channel] = i
+	}
+	return r
+}
+
+func (fzl *FlowZapLogger) saveState() *State {
+	st := fzl.AdvancedZapLogger.saveState()
+
+	fzl.mu.RLock()
+	defer fzl.mu.RUnlock()
+
+	st.Flows = append(st.Flows, *fzl.matrix(fzl.total, time.Time{}, time.Time{}))
+	for _, w := range fzl.windows {
+		st.Flows = append(st.Flows, *fzl.matrix(w.counts, w.start, bucketEnd(w.start, fzl.window)))
+	}
+	return st
+}
+
+// restoreState restores the matrix of every zap and the windows, which are
+// those with a start time
+func (fzl *FlowZapLogger) restoreState(st *State) {
+	fzl.AdvancedZapLogger.restoreState(st)
+
+	fzl.mu.Lock()
+	defer fzl.mu.Unlock()
+
+	for _, m := range st.Flows {
+		counts := fzl.total
+		if !m.Start.IsZero() {
+			w := fzl.windowAt(m.Start)
+			if w == nil {
+				continue
+			}
+			counts = w.counts
+		}
+		for _, t := range m.Transitions {
+			counts[newFlowKey(fzl.id(t.From), fzl.id(t.To))] += t.Zaps
+		}
+	}
+}
+
+// save copies the tracked boxes into s
+func (st *SessionTracker) save(s *State) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	s.Sessions = make(map[string]BoxState, len(st.boxes))
+	for ip, b := range st.boxes {
+		s.Sessions[ip] = *b
+	}
+}
+
+// restore replaces the tracked boxes with the ones in s, and moves the latest
+// event time to the latest event of any box
+func (st *SessionTracker) restore(s *State) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	st.boxes = make(map[string]*BoxState, len(s.Sessions))
+	for ip, b := range s.Sessions {
+		b := b
+		st.boxes[ip] = &b
+		if b.LastSeen.After(st.now) {
+			st.now = b.LastSeen
+		}
+	}
+}
+
+func (mzl *MuteZapLogger) saveState() *State {
+	st := mzl.AdvancedZapLogger.saveState()
+
+	mzl.mu.RLock()
+	defer mzl.mu.RUnlock()
+
+	mzl.sessions.save(st)
+	st.Muted = make(map[string]MuteRecord, len(mzl.channels))
+	for chName, mc := range mzl.channels {
+		r := MuteRecord{Total: mc.total, Muted: mc.muted, Peak: mc.peak, PeakTime: mc.peakTime}
+		r.Viewers = make(map[string]time.Duration, len(mc.viewers))
+		for ip, d := range mc.viewers {
+			r.Viewers[ip] = d
+		}
+		st.Muted[chName] = r
+	}
+	return st
+}
+
+// restoreState restores the boxes and channels, and takes the latest event time,
+// the muted boxes and the muted time of the open spans from the boxes
+func (mzl *MuteZapLogger) restoreState(st *State) {
+	mzl.AdvancedZapLogger.restoreState(st)
+
+	mzl.mu.Lock()
+	defer mzl.mu.Unlock()
+
+	mzl.sessions.restore(st)
+	for ip := range st.Sessions {
+		mzl.advance(st.Sessions[ip].LastSeen)
+		if ch := mzl.mutedOn(ip); ch != "" {
+			mzl.muted[ip] = ch
+		}
+	}
+
+	for chName, r := range st.Muted {
+		mc := mzl.channel(chName)
+		mc.total, mc.muted, mc.peak, mc.peakTime = r.Total, r.Muted, r.Peak, r.PeakTime
+		for ip, d := range r.Viewers {
+			mc.viewers[ip] = d
+		}
+	}
+
+	for ip := range st.Sessions {
+		if ch, muted := mzl.sessions.openSpan(ip, mzl.now); ch != "" {
+			mzl.channel(ch).open += muted
+		}
+	}
+	for _, mc := range mzl.channels {
+		mc.openAt = mzl.now
+	}
+}
@@ -0,0 +1,296 @@
+// Persistent logger state
+
+package zlog
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	zap "../"
+)
+
+// The files kept in a store's directory
+const (
+	journalFile  = "journal.log"
+	snapshotFile = "snapshot.json"
+)
+
+// Store keeps a logger's state in a directory so that it survives a restart.
+// Every zap, and every status change the logger uses, is appended to a journal
+// before it is logged, one JSON record per line, and Checkpoint saves a
+// snapshot of the logger's state and empties the journal. Loggers which cannot
+// be saved in a snapshot, like the simple logger, are restored from the journal
+// alone, which is then never emptied.
+//
+// Journal records are buffered, and written to the file when the buffer fills
+// up or by Sync, Checkpoint and Close, which also sync it to disk. A crash loses
+// the records logged since the latest of those, so the restored state is at
+// most a checkpoint interval behind.
+type Store struct {
+	dir     string
+	zl      ZapLogger
+	journal *os.File
+	w       *bufio.Writer
+	seq     uint64
+	mu      sync.Mutex
+}
+
+// journalRecord is a line of the journal, holding either a zap or a status change
+type journalRecord struct {
+	Seq    uint64
+	Zap    *zap.ChZap        `json:",omitempty"`
+	Status *zap.StatusChange `json:",omitempty"`
+}
+
+// OpenStore opens the store in dir, creating it if needed, and restores the
+// state saved in it into zl, which should be a new logger. The latest snapshot
+// is restored first, followed by the events journaled after it. A record torn by
+// a crash at the end of the journal is discarded, and any other record that
+// cannot be read is an error, which tells where to truncate the journal to
+// start from the records before it.
+func OpenStore(dir string, zl ZapLogger) (*Store, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	s := &Store{dir: dir, zl: zl}
+
+	if err := s.restoreSnapshot(); err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(filepath.Join(dir, journalFile), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.replay(f); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	s.journal = f
+	s.w = bufio.NewWriter(f)
+	return s, nil
+}
+
+// restoreSnapshot restores the snapshot in the store's directory, if any
+func (s *Store) restoreSnapshot() error {
+	data, err := os.ReadFile(filepath.Join(s.dir, snapshotFile))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	saver, ok := s.zl.(stateSaver)
+	if !ok {
+		return fmt.Errorf("OpenStore: %v cannot be restored from the snapshot in %v", s.zl, s.dir)
+	}
+
+	st := new(State)
+	if err := json.Unmarshal(data, st); err != nil {
+		return fmt.Errorf("OpenStore: bad snapshot in %v: %v", s.dir, err)
+	}
+
+	saver.restoreState(st)
+	s.seq = st.Seq
+	return nil
+}
+
+// replay logs the journaled events which are newer than the snapshot, and leaves
+// the file positioned after the last complete record. A record without its
+// newline was torn by a crash and is discarded, but a corrupt record in the
+// middle of the journal is an error, leaving the journal as it is.
+func (s *Store) replay(f *os.File) error {
+	r := bufio.NewReader(f)
+	var offset int64
+
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			// A line without a newline was torn while it was written
+			break
+		} else if err != nil {
+			return err
+		}
+
+		// A complete line that does not parse is not torn but corrupt, and
+		// dropping it would drop every record after it
+		var rec journalRecord
+		if err := json.Unmarshal(line, &rec); err != nil {
+			return fmt.Errorf("OpenStore: corrupt journal record after record %v in %v: %v "+
+				"(truncate %v to %v bytes to drop it and the records after it)",
+				s.seq, s.dir, err, f.Name(), offset)
+		}
+		offset += int64(len(line))
+
+		if rec.Seq > s.seq {
+			s.log(rec)
+			s.seq = rec.Seq
+		}
+	}
+
+	if err := f.Truncate(offset); err != nil {
+		return err
+	}
+	_, err := f.Seek(offset, io.SeekStart)
+	return err
+}
+
+// LogZap journals the zap and adds it to the logger
+func (s *Store) LogZap(z zap.ChZap) error {
+	return s.append(journalRecord{Zap: &z})
+}
+
+// LogStatus journals the status change and adds it to the logger, if the
+// logger uses status changes
+func (s *Store) LogStatus(sc zap.StatusChange) error {
+	if _, ok := s.zl.(StatusLogger); !ok {
+		return nil
+	}
+	return s.append(journalRecord{Status: &sc})
+}
+
+// append journals the record and adds its event to the logger
+func (s *Store) append(rec journalRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rec.Seq = s.seq + 1
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	if _, err := s.w.Write(data); err != nil {
+		return err
+	}
+
+	s.seq++
+	s.log(rec)
+	return nil
+}
+
+// log adds the record's event to the logger
+func (s *Store) log(rec journalRecord) {
+	if rec.Zap != nil {
+		s.zl.LogZap(*rec.Zap)
+	} else if sl, ok := s.zl.(StatusLogger); ok && rec.Status != nil {
+		sl.LogStatus(*rec.Status)
+	}
+}
+
+// Sync commits the journal to disk
+func (s *Store) Sync() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.sync()
+}
+
+// sync commits the journal to disk. The caller must hold the lock.
+func (s *Store) sync() error {
+	if err := s.w.Flush(); err != nil {
+		return err
+	}
+	return s.journal.Sync()
+}
+
+// Checkpoint saves a snapshot of the logger's state and empties the journal.
+// The snapshot replaces the previous one atomically, so a crash during a
+// checkpoint leaves either the old or the new snapshot in place. For loggers
+// that cannot be saved, Checkpoint only syncs the journal.
+func (s *Store) Checkpoint() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.sync(); err != nil {
+		return err
+	}
+
+	saver, ok := s.zl.(stateSaver)
+	if !ok {
+		return nil
+	}
+
+	st := saver.saveState()
+	st.Seq = s.seq
+
+	if err := s.writeSnapshot(st); err != nil {
+		return err
+	}
+
+	// Every journaled event is in the snapshot now
+	if err := s.journal.Truncate(0); err != nil {
+		return err
+	}
+	_, err := s.journal.Seek(0, io.SeekStart)
+	return err
+}
+
+// writeSnapshot writes the state to a temporary file, which is then renamed
+// over the snapshot
+func (s *Store) writeSnapshot(st *State) error {
+	data, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+
+	tmp := filepath.Join(s.dir, snapshotFile+".tmp")
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp, filepath.Join(s.dir, snapshotFile)); err != nil {
+		return err
+	}
+
+	// Make the rename itself durable
+	d, err := os.Open(s.dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// Seq returns the sequence number of the latest event logged
+func (s *Store) Seq() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.seq
+}
+
+// Close checkpoints the state and closes the journal
+func (s *Store) Close() error {
+	err := s.Checkpoint()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if cerr := s.journal.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
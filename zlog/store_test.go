@@ -0,0 +1,248 @@
+package zlog
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	zap ".."
+)
+
+// storeZaps are logged through a store, with a checkpoint after the first half
+func storeZaps() []zap.ChZap {
+	zaps := testZaps(400)
+	for i := 0; i < 10; i++ {
+		z := zaps[i]
+		z.FromChan, z.ToChan = z.ToChan, zap.Off
+		z.Time = z.Time.Add(time.Hour)
+		zaps = append(zaps, z)
+	}
+	return zaps
+}
+
+// sameState reports the differences between two loggers fed the same zaps
+func sameState(t *testing.T, name string, got, want ZapLogger) {
+	for _, ch := range channels {
+		if g, w := got.Viewers(ch), want.Viewers(ch); g != w {
+			t.Errorf("%v: Viewers(%v) => %v, want %v", name, ch, g, w)
+		}
+	}
+	if g, w := got.PoweredOn(), want.PoweredOn(); g != w {
+		t.Errorf("%v: PoweredOn() => %v, want %v", name, g, w)
+	}
+	if g, w := got.Coverage(), want.Coverage(); g != w {
+		t.Errorf("%v: Coverage() => %v, want %v", name, g, w)
+	}
+	if g, w := got.FetchStats(), want.FetchStats(); !reflect.DeepEqual(g, w) {
+		t.Errorf("%v: FetchStats() => %v, want %v", name, g, w)
+	}
+}
+
+func TestStoreRestore(t *testing.T) {
+	zaps := storeZaps()
+
+	for _, l := range loggers {
+		dir := t.TempDir()
+		want := l.new()
+
+		s, err := OpenStore(dir, l.new())
+		if err != nil {
+			t.Fatalf("%v: OpenStore => %v", l.name, err)
+		}
+		for i, z := range zaps {
+			if i == len(zaps)/2 {
+				if err := s.Checkpoint(); err != nil {
+					t.Fatalf("%v: Checkpoint() => %v", l.name, err)
+				}
+			}
+			if err := s.LogZap(z); err != nil {
+				t.Fatalf("%v: LogZap() => %v", l.name, err)
+			}
+			want.LogZap(z)
+		}
+
+		// Reopen without closing, as after a crash following a Sync
+		if err := s.Sync(); err != nil {
+			t.Fatalf("%v: Sync() => %v", l.name, err)
+		}
+		got := l.new()
+		s2, err := OpenStore(dir, got)
+		if err != nil {
+			t.Fatalf("%v: OpenStore after crash => %v", l.name, err)
+		}
+		if s2.Seq() != uint64(len(zaps)) {
+			t.Errorf("%v: Seq() after crash => %v, want %v", l.name, s2.Seq(), len(zaps))
+		}
+		sameState(t, l.name+" after crash", got, want)
+
+		if err := s2.Close(); err != nil {
+			t.Fatalf("%v: Close() => %v", l.name, err)
+		}
+		got = l.new()
+		s3, err := OpenStore(dir, got)
+		if err != nil {
+			t.Fatalf("%v: OpenStore after close => %v", l.name, err)
+		}
+		sameState(t, l.name+" after close", got, want)
+		s3.Close()
+		s.journal.Close()
+	}
+}
+
+func TestStoreTornJournal(t *testing.T) {
+	dir := t.TempDir()
+	zaps := testZaps(10)
+
+	s, err := OpenStore(dir, NewViewersZapLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, z := range zaps {
+		s.LogZap(z)
+	}
+	s.Sync()
+	s.journal.Close()
+
+	// A record cut short by a crash
+	f, err := os.OpenFile(filepath.Join(dir, journalFile), os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"Seq":11,"Zap":{"IP":"10.0`)
+	f.Close()
+
+	want := NewViewersZapLogger()
+	for _, z := range zaps {
+		want.LogZap(z)
+	}
+
+	got := NewViewersZapLogger()
+	s, err = OpenStore(dir, got)
+	if err != nil {
+		t.Fatalf("OpenStore with torn journal => %v", err)
+	}
+	sameState(t, "torn journal", got, want)
+
+	// New records continue after the last complete one
+	s.LogZap(zaps[0])
+	s.Sync()
+	s.journal.Close()
+	want.LogZap(zaps[0])
+
+	got = NewViewersZapLogger()
+	s, err = OpenStore(dir, got)
+	if err != nil {
+		t.Fatalf("OpenStore after torn journal => %v", err)
+	}
+	sameState(t, "after torn journal", got, want)
+	s.Close()
+}
+
+// TestStoreCorruptJournal checks that a corrupt record in the middle of the
+// journal is reported, rather than discarded along with the records after it
+func TestStoreCorruptJournal(t *testing.T) {
+	dir := t.TempDir()
+	zaps := testZaps(10)
+
+	s, err := OpenStore(dir, NewViewersZapLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, z := range zaps[:5] {
+		s.LogZap(z)
+	}
+	s.w.WriteString("{\"Seq\":6,\"Zap\":{\"IP\":\"10.0\n")
+	for _, z := range zaps[5:] {
+		s.LogZap(z)
+	}
+	s.Sync()
+	s.journal.Close()
+
+	path := filepath.Join(dir, journalFile)
+	before, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The error tells how to truncate the journal to the first five records
+	good := bytes.Index(before, []byte(`{"Seq":6`))
+	_, err = OpenStore(dir, NewViewersZapLogger())
+	if err == nil || !strings.Contains(err.Error(), "after record 5") ||
+		!strings.Contains(err.Error(), fmt.Sprintf("to %v bytes", good)) {
+		t.Errorf("OpenStore with corrupt journal => %v, want error after record 5, truncating to %v bytes", err, good)
+	}
+
+	after, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(after) != len(before) {
+		t.Errorf("OpenStore with corrupt journal left %v bytes of %v", len(after), len(before))
+	}
+
+	if err := os.Truncate(path, int64(good)); err != nil {
+		t.Fatal(err)
+	}
+	s, err = OpenStore(dir, NewViewersZapLogger())
+	if err != nil {
+		t.Fatalf("OpenStore with truncated journal => %v", err)
+	}
+	if s.Seq() != 5 {
+		t.Errorf("Seq() with truncated journal => %v, want 5", s.Seq())
+	}
+	s.Close()
+}
+
+func TestStoreSnapshotNeedsSaver(t *testing.T) {
+	dir := t.TempDir()
+
+	s, err := OpenStore(dir, NewAdvancedZapLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.LogZap(testZaps(1)[0])
+	s.Close()
+
+	if _, err := OpenStore(dir, NewSimpleZapLogger()); err == nil {
+		t.Errorf("OpenStore with simple logger and a snapshot => nil, want error")
+	}
+}
+
+// TestStoreStatus checks that HDMI status changes are journaled and saved, so
+// the watching counts survive a restart
+func TestStoreStatus(t *testing.T) {
+	start := time.Date(2013, 7, 20, 18, 0, 0, 0, time.UTC)
+	tvOff := zap.StatusChange{Time: start, IP: "10.0.0.1", Kind: zap.StatusHDMI, Value: 0}
+
+	for _, l := range loggers {
+		for _, checkpoint := range []bool{false, true} {
+			dir := t.TempDir()
+
+			s, err := OpenStore(dir, l.new())
+			if err != nil {
+				t.Fatalf("%v: OpenStore => %v", l.name, err)
+			}
+			s.LogZap(zap.ChZap{Time: start, IP: "10.0.0.1", FromChan: zap.Off, ToChan: "NRK1"})
+			s.LogZap(zap.ChZap{Time: start, IP: "10.0.0.2", FromChan: zap.Off, ToChan: "NRK1"})
+			s.LogStatus(tvOff)
+			if checkpoint {
+				s.Checkpoint()
+			}
+			s.Sync()
+
+			zl := l.new()
+			if _, err := OpenStore(dir, zl); err != nil {
+				t.Fatalf("%v: OpenStore again => %v", l.name, err)
+			}
+			if v, w := zl.Viewers("NRK1"), zl.Watching("NRK1"); v != 2 || w != 1 {
+				t.Errorf("%v (checkpoint %v): restored %v viewers and %v watching, want 2 and 1",
+					l.name, checkpoint, v, w)
+			}
+		}
+	}
+}
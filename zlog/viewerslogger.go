@@ -1,98 +1,156 @@
-package zlog
-
-// Viewers logger
-
-import (
-	"sort"
-	"time"
-
-	zap "../"
-)
-
-// NewViewersZapLogger creates a map based zap logger
-func NewViewersZapLogger() ZapLogger {
-	zm := make(ZapsMap)
-	return &zm
-}
-
-// LogZap adds a zap to the log
-func (zm *ZapsMap) LogZap(z zap.ChZap) {
-	(*zm)[z.ToChan]++
-	if (*zm)[z.FromChan] > 0 {
-		(*zm)[z.FromChan]--
-	} else {
-		(*zm)[z.FromChan] = 0
-	}
-}
-
-// Entries returns the number of channels in the log set
-func (zm *ZapsMap) Entries() int {
-	return len(*zm)
-}
-
-// String returns the name of the logger
-func (zm *ZapsMap) String() string {
-	return "Viewers Logger"
-}
-
-// Viewers returns the viewer count for the given channel
-func (zm *ZapsMap) Viewers(chName string) int {
-	// TODO: implementer locking
-	if PrintTimes {
-		defer zap.TimeElapsed(time.Now(), zm.String()+".Viewers")
-	}
-
-	// Only need to access viewers of channel in map
-	return (*zm)[chName]
-}
-
-// Channels returns a list of channels in the log
-func (zm *ZapsMap) Channels() []string {
-	if PrintTimes {
-		defer zap.TimeElapsed(time.Now(), zm.String()+".Channels")
-	}
-
-	channels := make([]string, 0, len(*zm)) //Max size is len of map to be efficient
-	for k := range *zm {
-		channels = append(channels, k)
-	}
-
-	return channels
-}
-
-// ChannelsViewers creates a slice of ChannelViewers, which is defined in zaplogger.go.
-// This is the number of viewers for each channel.
-// A positive non-zero input argument will return the given amount of elements, while a negative argument will return all elements in
-// the list.
-func (zm *ZapsMap) ChannelsViewers() []*ChannelViewers {
-	var ChanViewersList ChanViewersList
-
-	if PrintTimes {
-		defer zap.TimeElapsed(time.Now(), zm.String()+".ChannelsViewers")
-	}
-
-	for key, value := range *zm {
-		chanViews := ChannelViewers{key, value}
-		ChanViewersList = append(ChanViewersList, &chanViews)
-	}
-
-	return ChanViewersList
-}
-
-// FetchSorted returns a list of channels and viewers, sorted by viewers
-func (zm *ZapsMap) FetchSorted(i uint8) ChanViewersList {
-	var bv ByViewers
-
-	if PrintTimes {
-		defer zap.TimeElapsed(time.Now(), zm.String()+".FetchSorted")
-	}
-
-	bv.ChanViewersList = zm.ChannelsViewers()
-	sort.Sort(sort.Reverse(ByViewers(bv)))
-	return bv.ChanViewersList[:i]
-}
-
-// FetchStats is not supported by viewerslogger and will return a nil map
-func (zm *ZapsMap) FetchStats() *map[string]ZapStats {
-	return nil
-}
+package zlog
+
+// Viewers logger
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	zap "../"
+)
+
+// ZapsMap keeps a map of channel-viewercount pairs
+type ZapsMap struct {
+	chanMap  ChannelCounts
+	watching ChannelCounts
+	boxes    boxTracker
+	mu       sync.RWMutex
+}
+
+// NewViewersZapLogger creates a map based zap logger
+func NewViewersZapLogger() ZapLogger {
+	zm := new(ZapsMap)
+	zm.chanMap = make(ChannelCounts)
+	zm.watching = make(ChannelCounts)
+	zm.boxes = newBoxTracker()
+	return zm
+}
+
+// LogZap adds a zap to the log
+func (zm *ZapsMap) LogZap(z zap.ChZap) {
+	zm.mu.Lock()
+	defer zm.mu.Unlock()
+
+	// Zaps to and from OFF turn the box off and on, and only count for one
+	// side. The viewer is taken off the channel the box was counted on, which
+	// boxes seen for the first time were not.
+	m := zm.boxes.track(z)
+	zm.chanMap.move(m.from, m.to)
+	zm.watching.move(m.watchFrom, m.watchTo)
+}
+
+// LogStatus adds a status change to the log. Only HDMI_Status is used.
+func (zm *ZapsMap) LogStatus(s zap.StatusChange) {
+	zm.mu.Lock()
+	defer zm.mu.Unlock()
+
+	zm.watching.move(zm.boxes.hdmi(s))
+}
+
+// Watching returns the number of viewers of the given channel with their TV on
+func (zm *ZapsMap) Watching(chName string) int {
+	zm.mu.RLock()
+	defer zm.mu.RUnlock()
+
+	return zm.watching[chName]
+}
+
+// Coverage tells how much of the audience the viewer counts are based on
+func (zm *ZapsMap) Coverage() Coverage {
+	zm.mu.RLock()
+	defer zm.mu.RUnlock()
+
+	return zm.boxes.coverage()
+}
+
+// PoweredOn returns the number of boxes counted as viewers of a channel
+func (zm *ZapsMap) PoweredOn() int {
+	zm.mu.RLock()
+	defer zm.mu.RUnlock()
+
+	return zm.chanMap.total()
+}
+
+// Entries returns the number of channels in the log set
+func (zm *ZapsMap) Entries() int {
+	zm.mu.RLock()
+	defer zm.mu.RUnlock()
+
+	return len(zm.chanMap)
+}
+
+// String returns the name of the logger
+func (zm *ZapsMap) String() string {
+	return "Viewers Logger"
+}
+
+// Viewers returns the viewer count for the given channel
+func (zm *ZapsMap) Viewers(chName string) int {
+	if PrintTimes {
+		defer zap.TimeElapsed(time.Now(), zm.String()+".Viewers")
+	}
+
+	zm.mu.RLock()
+	defer zm.mu.RUnlock()
+
+	// Only need to access viewers of channel in map
+	return zm.chanMap[chName]
+}
+
+// Channels returns a list of channels in the log
+func (zm *ZapsMap) Channels() []string {
+	if PrintTimes {
+		defer zap.TimeElapsed(time.Now(), zm.String()+".Channels")
+	}
+
+	zm.mu.RLock()
+	defer zm.mu.RUnlock()
+
+	channels := make([]string, 0, len(zm.chanMap)) //Max size is len of map to be efficient
+	for k := range zm.chanMap {
+		channels = append(channels, k)
+	}
+
+	return channels
+}
+
+// ChannelsViewers creates a slice of ChannelViewers, which is defined in zaplogger.go.
+// This is the number of viewers for each channel.
+func (zm *ZapsMap) ChannelsViewers() []*ChannelViewers {
+	if PrintTimes {
+		defer zap.TimeElapsed(time.Now(), zm.String()+".ChannelsViewers")
+	}
+
+	zm.mu.RLock()
+	defer zm.mu.RUnlock()
+
+	return zm.chanMap.channelsViewers(zm.watching)
+}
+
+// FetchSorted returns a list of channels and viewers, sorted by viewers
+// At most i elements are returned.
+func (zm *ZapsMap) FetchSorted(i uint8) ChanViewersList {
+	var bv ByViewers
+
+	if PrintTimes {
+		defer zap.TimeElapsed(time.Now(), zm.String()+".FetchSorted")
+	}
+
+	zm.mu.RLock()
+	bv.ChanViewersList = zm.chanMap.channelsViewers(zm.watching)
+	zm.mu.RUnlock()
+
+	sort.Sort(sort.Reverse(ByViewers(bv)))
+
+	if bv.ChanViewersList.Len() > int(i) {
+		return bv.ChanViewersList[:i]
+	}
+
+	return bv.ChanViewersList
+}
+
+// FetchStats is not supported by viewerslogger and will return a nil map
+func (zm *ZapsMap) FetchStats() *map[string]ZapStats {
+	return nil
+}
@@ -0,0 +1,347 @@
+// Volume level statistics
+
+package zlog
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	zap "../"
+)
+
+// VolumeBins is the number of ranges in a volume histogram. Each range spans
+// ten volume levels, and the last one includes 100.
+const VolumeBins = 10
+
+// maxJumps is the number of volume jumps kept per channel
+const maxJumps = 100
+
+// ChannelVolume holds the volume statistics of a channel's current viewers.
+// Viewers whose volume has not been reported yet are left out.
+type ChannelVolume struct {
+	Channel string
+	Viewers int
+	Average float64
+	// Histogram counts the viewers in each range of volume levels, 0-9 first
+	Histogram [VolumeBins]int
+	// Jumps is the number of volume jumps detected on the channel
+	Jumps int
+}
+
+func (cv ChannelVolume) String() string {
+	return fmt.Sprintf("%v: average volume %.1f (%v viewers), %v jumps", cv.Channel, cv.Average, cv.Viewers, cv.Jumps)
+}
+
+// VolumeJump is a synchronised volume rise on many boxes watching a channel,
+// such as when a loud ad break starts
+type VolumeJump struct {
+	Channel string
+	// Start is the time of the first rise and End the time of the latest
+	Start time.Time
+	End   time.Time
+	// Boxes is the number of boxes that turned up the volume
+	Boxes int
+}
+
+func (vj VolumeJump) String() string {
+	return fmt.Sprintf("%v: %v boxes from %v to %v",
+		vj.Channel, vj.Boxes, vj.Start.Format(timeOfDay), vj.End.Format(timeOfDay))
+}
+
+// volumeBox is the volume and channel of a set-top box
+type volumeBox struct {
+	// Channel is empty while the box is off or its channel is unknown
+	channel string
+	volume  int
+	known   bool
+}
+
+// volumeRise is a box turning up the volume
+type volumeRise struct {
+	ip string
+	t  time.Time
+}
+
+// volumeChannel accumulates the volume statistics of a channel
+type volumeChannel struct {
+	viewers   int
+	sum       int
+	histogram [VolumeBins]int
+
+	// Rises within the detection period of the latest one, oldest first
+	rises []volumeRise
+	// The jump in progress, if any, and the boxes that are part of it
+	open      *VolumeJump
+	openBoxes map[string]bool
+
+	jumps []*VolumeJump // oldest first
+	count int
+}
+
+// VolumeStats follows the volume of the set-top boxes along with their channel,
+// and aggregates it per channel: the average volume of the current viewers, a
+// histogram of their volume, and jumps where many viewers turn the volume up at
+// once. Volume events only carry the box, so a box's volume counts towards the
+// channel it last zapped to.
+//
+// A jump starts when at least quorum boxes on a channel each turn the volume up
+// by at least rise levels within the given period, and lasts as long as more
+// boxes keep following within the period. Time is event time, like in
+// WindowStats.
+//
+// Like the boxTracker of the loggers, it keeps every box it has seen rather
+// than timing them out like the SessionTracker, since a box's volume counts on
+// its channel for as long as the box stays there, however quiet it is.
+type VolumeStats struct {
+	rise   int
+	quorum int
+	within time.Duration
+
+	boxes    map[string]*volumeBox
+	channels map[string]*volumeChannel
+	now      time.Time
+
+	mu sync.RWMutex
+}
+
+// NewVolumeStats creates volume statistics which detect jumps of quorum boxes
+// turning the volume up by rise levels within the given period. Rise must be
+// between 1 and 100 and quorum at least 2.
+func NewVolumeStats(rise, quorum int, within time.Duration) (*VolumeStats, error) {
+	if rise < 1 || rise > 100 {
+		return nil, fmt.Errorf("NewVolumeStats: rise must be in [1, 100], got %v", rise)
+	}
+	if quorum < 2 {
+		return nil, fmt.Errorf("NewVolumeStats: a jump needs a quorum of at least 2 boxes, got %v", quorum)
+	}
+	if within <= 0 {
+		return nil, fmt.Errorf("NewVolumeStats: period must be positive, got %v", within)
+	}
+
+	return &VolumeStats{
+		rise:     rise,
+		quorum:   quorum,
+		within:   within,
+		boxes:    make(map[string]*volumeBox),
+		channels: make(map[string]*volumeChannel),
+	}, nil
+}
+
+// LogZap moves the box's volume to its new channel
+func (vs *VolumeStats) LogZap(z zap.ChZap) {
+	vs.mu.Lock()
+	defer vs.mu.Unlock()
+
+	vs.advance(z.Time)
+
+	b := vs.box(z.IP)
+	vs.remove(b)
+	b.channel = ""
+	if z.ToChan != zap.Off {
+		b.channel = z.ToChan
+	}
+	vs.add(b)
+}
+
+// LogStatus logs a status change. Only Volume is used.
+func (vs *VolumeStats) LogStatus(s zap.StatusChange) {
+	if s.Kind != zap.StatusVolume {
+		return
+	}
+
+	vs.mu.Lock()
+	defer vs.mu.Unlock()
+
+	vs.advance(s.Time)
+
+	b := vs.box(s.IP)
+	rise := b.known && s.Value-b.volume >= vs.rise
+
+	vs.remove(b)
+	b.volume, b.known = s.Value, true
+	vs.add(b)
+
+	if rise && b.channel != "" {
+		vs.detect(s.IP, vs.channel(b.channel), b.channel, s.Time)
+	}
+}
+
+// advance moves the latest event time forward. The caller must hold the lock.
+func (vs *VolumeStats) advance(t time.Time) {
+	if t.After(vs.now) {
+		vs.now = t
+	}
+}
+
+// box returns the state of a box, adding it if it is new. The caller must hold
+// the lock.
+func (vs *VolumeStats) box(ip string) *volumeBox {
+	b, ok := vs.boxes[ip]
+	if !ok {
+		b = new(volumeBox)
+		vs.boxes[ip] = b
+	}
+	return b
+}
+
+// channel returns the statistics of a channel, adding it if it is new. The
+// caller must hold the lock.
+func (vs *VolumeStats) channel(chName string) *volumeChannel {
+	vc, ok := vs.channels[chName]
+	if !ok {
+		vc = &volumeChannel{openBoxes: make(map[string]bool)}
+		vs.channels[chName] = vc
+	}
+	return vc
+}
+
+// add counts the box's volume on its channel. The caller must hold the lock.
+func (vs *VolumeStats) add(b *volumeBox) {
+	if b.channel == "" || !b.known {
+		return
+	}
+	vc := vs.channel(b.channel)
+	vc.viewers++
+	vc.sum += b.volume
+	vc.histogram[volumeBin(b.volume)]++
+}
+
+// remove stops counting the box's volume on its channel. The caller must hold
+// the lock.
+func (vs *VolumeStats) remove(b *volumeBox) {
+	if b.channel == "" || !b.known {
+		return
+	}
+	vc := vs.channel(b.channel)
+	vc.viewers--
+	vc.sum -= b.volume
+	vc.histogram[volumeBin(b.volume)]--
+}
+
+// volumeBin returns the histogram range of a volume level
+func volumeBin(volume int) int {
+	if volume >= 100 {
+		return VolumeBins - 1
+	}
+	return volume * VolumeBins / 100
+}
+
+// detect counts a box turning up the volume on a channel at time t, and starts
+// or extends a jump. The caller must hold the lock.
+func (vs *VolumeStats) detect(ip string, vc *volumeChannel, chName string, t time.Time) {
+	// Forget rises that are too old to be part of a jump with this one
+	oldest := vs.now.Add(-vs.within)
+	i := 0
+	for i < len(vc.rises) && vc.rises[i].t.Before(oldest) {
+		i++
+	}
+	vc.rises = vc.rises[i:]
+
+	if vc.open != nil && t.Sub(vc.open.End) > vs.within {
+		vc.open = nil
+		vc.openBoxes = make(map[string]bool)
+	}
+
+	// A box turning up the volume twice counts once
+	for i, r := range vc.rises {
+		if r.ip == ip {
+			vc.rises = append(vc.rises[:i], vc.rises[i+1:]...)
+			break
+		}
+	}
+	vc.rises = append(vc.rises, volumeRise{ip, t})
+
+	if vc.open != nil {
+		if !vc.openBoxes[ip] {
+			vc.openBoxes[ip] = true
+			vc.open.Boxes++
+		}
+		if t.After(vc.open.End) {
+			vc.open.End = t
+		}
+		return
+	}
+
+	if len(vc.rises) < vs.quorum {
+		return
+	}
+
+	vj := &VolumeJump{Channel: chName, Start: vc.rises[0].t, End: t}
+	for _, r := range vc.rises {
+		vc.openBoxes[r.ip] = true
+		if r.t.Before(vj.Start) {
+			vj.Start = r.t
+		}
+	}
+	vj.Boxes = len(vc.openBoxes)
+	vc.open = vj
+
+	vc.jumps = append(vc.jumps, vj)
+	if len(vc.jumps) > maxJumps {
+		vc.jumps = vc.jumps[len(vc.jumps)-maxJumps:]
+	}
+	vc.count++
+}
+
+// Channel returns the volume statistics of a channel
+func (vs *VolumeStats) Channel(chName string) ChannelVolume {
+	vs.mu.RLock()
+	defer vs.mu.RUnlock()
+
+	cv := ChannelVolume{Channel: chName}
+	vc, ok := vs.channels[chName]
+	if !ok {
+		return cv
+	}
+
+	cv.Viewers = vc.viewers
+	cv.Histogram = vc.histogram
+	cv.Jumps = vc.count
+	if vc.viewers > 0 {
+		cv.Average = float64(vc.sum) / float64(vc.viewers)
+	}
+	return cv
+}
+
+// Jumps returns the latest volume jumps detected on a channel, oldest first
+func (vs *VolumeStats) Jumps(chName string) []VolumeJump {
+	vs.mu.RLock()
+	defer vs.mu.RUnlock()
+
+	vc, ok := vs.channels[chName]
+	if !ok {
+		return nil
+	}
+
+	jumps := make([]VolumeJump, len(vc.jumps))
+	for i, vj := range vc.jumps {
+		jumps[i] = *vj
+	}
+	return jumps
+}
+
+// LatestJumps returns the n latest volume jumps on any channel, latest first
+func (vs *VolumeStats) LatestJumps(n int) []VolumeJump {
+	vs.mu.RLock()
+	var jumps []VolumeJump
+	for _, vc := range vs.channels {
+		for _, vj := range vc.jumps {
+			jumps = append(jumps, *vj)
+		}
+	}
+	vs.mu.RUnlock()
+
+	sort.Slice(jumps, func(i, j int) bool {
+		if !jumps[i].Start.Equal(jumps[j].Start) {
+			return jumps[i].Start.After(jumps[j].Start)
+		}
+		return jumps[i].Channel < jumps[j].Channel
+	})
+
+	if n >= 0 && len(jumps) > n {
+		jumps = jumps[:n]
+	}
+	return jumps
+}
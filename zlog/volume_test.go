@@ -0,0 +1,137 @@
+package zlog
+
+import (
+	"testing"
+	"time"
+
+	zap ".."
+)
+
+// volumeEvents are zaps, or volume changes when volume is not negative. Times
+// are in seconds.
+var volumeEvents = []struct {
+	sec      int
+	ip       string
+	from, to string
+	volume   int
+}{
+	{0, "10.0.0.1", zap.Off, "NRK1", -1},
+	{0, "10.0.0.2", zap.Off, "NRK1", -1},
+	{0, "10.0.0.3", zap.Off, "NRK1", -1},
+	{0, "10.0.0.4", zap.Off, "NRK2", -1},
+	{1, "10.0.0.1", "", "", 20},
+	{1, "10.0.0.2", "", "", 30},
+	{1, "10.0.0.3", "", "", 40},
+	{1, "10.0.0.4", "", "", 100},
+	// The volume of a box that has not zapped counts once it does
+	{2, "10.0.0.5", "", "", 55},
+	// Three boxes turn up the volume within 10 seconds
+	{60, "10.0.0.1", "", "", 50},
+	{62, "10.0.0.2", "", "", 60},
+	{65, "10.0.0.3", "", "", 70},
+	// A small rise, and a rise on another channel, are not part of the jump
+	{66, "10.0.0.1", "", "", 55},
+	{67, "10.0.0.4", "", "", 100},
+	// Rises too far apart are no jump
+	{200, "10.0.0.1", "", "", 5},
+	{201, "10.0.0.1", "", "", 50},
+	{220, "10.0.0.2", "", "", 5},
+	{221, "10.0.0.2", "", "", 50},
+	{240, "10.0.0.5", zap.Off, "NRK1", -1},
+}
+
+func TestVolumeStats(t *testing.T) {
+	start := time.Date(2013, 7, 20, 18, 0, 0, 0, time.UTC)
+	at := func(sec int) time.Time { return start.Add(time.Duration(sec) * time.Second) }
+
+	vs, err := NewVolumeStats(20, 3, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, ev := range volumeEvents {
+		if ev.volume < 0 {
+			vs.LogZap(zap.ChZap{Time: at(ev.sec), IP: ev.ip, FromChan: ev.from, ToChan: ev.to})
+		} else {
+			vs.LogStatus(zap.StatusChange{Time: at(ev.sec), IP: ev.ip, Kind: zap.StatusVolume, Value: ev.volume})
+		}
+	}
+
+	// Mute and HDMI status changes are ignored
+	vs.LogStatus(zap.StatusChange{Time: at(300), IP: "10.0.0.1", Kind: zap.StatusMute, Value: 1})
+
+	want := ChannelVolume{Channel: "NRK1", Viewers: 4, Average: (50 + 50 + 70 + 55) / 4.0, Jumps: 1}
+	want.Histogram[5] = 3
+	want.Histogram[7] = 1
+	if cv := vs.Channel("NRK1"); cv != want {
+		t.Errorf("Channel(NRK1) => %v %v, want %v %v", cv, cv.Histogram, want, want.Histogram)
+	}
+
+	want = ChannelVolume{Channel: "NRK2", Viewers: 1, Average: 100}
+	want.Histogram[VolumeBins-1] = 1
+	if cv := vs.Channel("NRK2"); cv != want {
+		t.Errorf("Channel(NRK2) => %v %v, want %v %v", cv, cv.Histogram, want, want.Histogram)
+	}
+
+	wantJump := VolumeJump{Channel: "NRK1", Start: at(60), End: at(65), Boxes: 3}
+	if jumps := vs.Jumps("NRK1"); len(jumps) != 1 || jumps[0] != wantJump {
+		t.Errorf("Jumps(NRK1) => %v, want [%v]", jumps, wantJump)
+	}
+	if jumps := vs.LatestJumps(10); len(jumps) != 1 || jumps[0] != wantJump {
+		t.Errorf("LatestJumps(10) => %v, want [%v]", jumps, wantJump)
+	}
+	if jumps := vs.Jumps("NRK2"); len(jumps) != 0 {
+		t.Errorf("Jumps(NRK2) => %v, want none", jumps)
+	}
+}
+
+// TestVolumeStatsJumpExtends checks that boxes following a jump within the
+// period are part of it, and that a box rising twice is counted once
+func TestVolumeStatsJumpExtends(t *testing.T) {
+	start := time.Date(2013, 7, 20, 18, 0, 0, 0, time.UTC)
+	at := func(sec int) time.Time { return start.Add(time.Duration(sec) * time.Second) }
+
+	vs, err := NewVolumeStats(10, 2, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ips := []string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.4"}
+	for _, ip := range ips {
+		vs.LogZap(zap.ChZap{Time: start, IP: ip, FromChan: zap.Off, ToChan: "TV2 Norge"})
+		vs.LogStatus(zap.StatusChange{Time: start, IP: ip, Kind: zap.StatusVolume, Value: 0})
+	}
+
+	for i, ip := range ips {
+		vs.LogStatus(zap.StatusChange{Time: at(4 * (i + 1)), IP: ip, Kind: zap.StatusVolume, Value: 50})
+		vs.LogStatus(zap.StatusChange{Time: at(4 * (i + 1)), IP: ip, Kind: zap.StatusVolume, Value: 10})
+		vs.LogStatus(zap.StatusChange{Time: at(4*(i+1) + 1), IP: ip, Kind: zap.StatusVolume, Value: 60})
+	}
+
+	// The first box rose again at 5 seconds, which is when the jump started
+	want := VolumeJump{Channel: "TV2 Norge", Start: at(5), End: at(17), Boxes: 4}
+	if jumps := vs.Jumps("TV2 Norge"); len(jumps) != 1 || jumps[0] != want {
+		t.Errorf("Jumps(TV2 Norge) => %v, want [%v]", jumps, want)
+	}
+}
+
+var newvolumetests = []struct {
+	rise, quorum int
+	within       time.Duration
+	ok           bool
+}{
+	{20, 5, 10 * time.Second, true},
+	{0, 5, 10 * time.Second, false},
+	{101, 5, 10 * time.Second, false},
+	{20, 1, 10 * time.Second, false},
+	{20, 5, 0, false},
+}
+
+func TestNewVolumeStats(t *testing.T) {
+	for _, tt := range newvolumetests {
+		_, err := NewVolumeStats(tt.rise, tt.quorum, tt.within)
+		if (err == nil) != tt.ok {
+			t.Errorf("NewVolumeStats(%v, %v, %v) => %v, want ok %v", tt.rise, tt.quorum, tt.within, err, tt.ok)
+		}
+	}
+}
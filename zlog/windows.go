@@ -0,0 +1,351 @@
+// Time-windowed viewer statistics
+
+package zlog
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	zap "../"
+)
+
+// slideSteps is the number of steps a sliding window is counted in. Zaps are
+// counted per step, so the window slides forward one step at a time.
+const slideSteps = 60
+
+// WindowBucket holds the statistics of a channel in a tumbling window
+type WindowBucket struct {
+	Start time.Time
+	End   time.Time
+	// AvgViewers is the time-weighted average viewer count. For the current
+	// window it is the average so far.
+	AvgViewers float64
+	Peak       int
+	// Zaps is the number of zaps to the channel
+	Zaps int
+}
+
+// Peak is the highest viewer count of a channel and when it was first reached
+type Peak struct {
+	Viewers int
+	Time    time.Time
+}
+
+// window accumulates a tumbling window
+type window struct {
+	start time.Time
+	end   time.Time
+	// Viewer count integrated over time, in viewer-seconds
+	area map[string]float64
+	peak ChannelCounts
+	zaps ChannelCounts
+}
+
+// WindowStats aggregates zaps over time windows: the zaps per channel in a
+// sliding window, and the average and peak viewers per channel in tumbling
+// windows. Time is event time, taken from the zaps, so recorded datasets give
+// the same results at any replay speed. Tumbling windows are counted from
+// midnight in the time zone of the zaps, so they follow the broadcaster's day.
+// A zap older than the latest one seen is counted as if it happened at the
+// time of the latest one, except in the sliding window, which places zaps by
+// their own time.
+//
+// Viewers are counted like the loggers count them, with reconciliation of
+// boxes first seen mid-stream.
+type WindowStats struct {
+	bucket time.Duration
+	slide  time.Duration
+	retain int
+
+	viewers ChannelCounts
+	since   map[string]time.Time
+	boxes   boxTracker
+	peaks   map[string]Peak
+	now     time.Time
+
+	cur    *window
+	closed []*window // oldest first
+
+	// Zap counts of the sliding window's steps, indexed by step number
+	steps     [slideSteps]ChannelCounts
+	stepStart [slideSteps]time.Time
+
+	mu sync.RWMutex
+}
+
+// NewWindowStats creates windowed statistics with tumbling windows of the given
+// size, of which the latest retain are kept, and a sliding window of the given
+// size for counting zaps. A day of 15 minute windows is 96 windows. Both window
+// sizes must be at least a second.
+func NewWindowStats(bucket, slide time.Duration, retain int) (*WindowStats, error) {
+	if bucket < time.Second || slide < time.Second {
+		return nil, fmt.Errorf("NewWindowStats: windows must be at least a second, got %v and %v", bucket, slide)
+	}
+	if retain < 1 {
+		return nil, fmt.Errorf("NewWindowStats: must retain at least one window, got %v", retain)
+	}
+
+	return &WindowStats{
+		bucket:  bucket,
+		slide:   slide,
+		retain:  retain,
+		viewers: make(ChannelCounts),
+		since:   make(map[string]time.Time),
+		boxes:   newBoxTracker(),
+		peaks:   make(map[string]Peak),
+	}, nil
+}
+
+// bucketStart returns the start of the tumbling window of the given size that
+// t falls in. Windows are counted from midnight in t's time zone, so that they
+// line up with the local day whatever its length, and the last window of a day
+// ends at midnight.
+func bucketStart(t time.Time, size time.Duration) time.Time {
+	midnight := startOfDay(t)
+	return midnight.Add(t.Sub(midnight).Truncate(size))
+}
+
+// bucketEnd returns the end of the tumbling window of the given size that
+// starts at start, which is cut short at midnight
+func bucketEnd(start time.Time, size time.Duration) time.Time {
+	end := start.Add(size)
+	y, m, d := start.Date()
+	if next := time.Date(y, m, d+1, 0, 0, 0, 0, start.Location()); end.After(next) {
+		return next
+	}
+	return end
+}
+
+// startOfDay returns midnight of t's date in t's time zone
+func startOfDay(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
+
+func newWindow(start, end time.Time, viewers ChannelCounts) *window {
+	w := &window{
+		start: start,
+		end:   end,
+		area:  make(map[string]float64),
+		peak:  make(ChannelCounts),
+		zaps:  make(ChannelCounts),
+	}
+	for ch, v := range viewers {
+		if v > 0 {
+			w.peak[ch] = v
+		}
+	}
+	return w
+}
+
+// LogZap adds a zap to the windows
+func (ws *WindowStats) LogZap(z zap.ChZap) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	ws.advance(z.Time)
+
+	m := ws.boxes.track(z)
+	if m.to != zap.Off {
+		ws.countZap(z)
+		ws.cur.zaps[m.to]++
+		ws.change(m.to, 1)
+	}
+	if m.from != zap.Off {
+		ws.change(m.from, -1)
+	}
+}
+
+// advance moves the current time forward to t, closing the tumbling windows
+// that end before it
+func (ws *WindowStats) advance(t time.Time) {
+	if ws.cur == nil {
+		ws.open(bucketStart(t, ws.bucket))
+		ws.now = t
+		return
+	}
+	if !t.After(ws.now) {
+		return
+	}
+
+	// Windows that would be dropped right away are skipped
+	skip := t.Add(-time.Duration(ws.retain) * ws.bucket)
+	if skip.Sub(ws.cur.end) > ws.bucket {
+		ws.closeWindow()
+		ws.open(bucketStart(skip, ws.bucket))
+		for ch := range ws.since {
+			ws.since[ch] = ws.cur.start
+		}
+	}
+
+	for !t.Before(ws.cur.end) {
+		ws.closeWindow()
+	}
+	ws.now = t
+}
+
+// open makes the tumbling window starting at start the current one
+func (ws *WindowStats) open(start time.Time) {
+	ws.cur = newWindow(start, bucketEnd(start, ws.bucket), ws.viewers)
+}
+
+// closeWindow closes the current tumbling window and opens the next
+func (ws *WindowStats) closeWindow() {
+	end := ws.cur.end
+	for ch, v := range ws.viewers {
+		ws.cur.area[ch] += float64(v) * end.Sub(ws.since[ch]).Seconds()
+		ws.since[ch] = end
+	}
+
+	ws.closed = append(ws.closed, ws.cur)
+	if len(ws.closed) > ws.retain {
+		ws.closed = ws.closed[len(ws.closed)-ws.retain:]
+	}
+	ws.open(end)
+}
+
+// change adds delta viewers to the channel at the current time
+func (ws *WindowStats) change(chName string, delta int) {
+	v := ws.viewers[chName]
+	if since, ok := ws.since[chName]; ok {
+		ws.cur.area[chName] += float64(v) * ws.now.Sub(since).Seconds()
+	}
+	ws.since[chName] = ws.now
+
+	v += delta
+	ws.viewers[chName] = v
+
+	if v > ws.cur.peak[chName] {
+		ws.cur.peak[chName] = v
+	}
+	if v > ws.peaks[chName].Viewers {
+		ws.peaks[chName] = Peak{Viewers: v, Time: ws.now}
+	}
+}
+
+// countZap counts the zap in the sliding window step of its own time
+func (ws *WindowStats) countZap(z zap.ChZap) {
+	step := ws.slide / slideSteps
+	start := z.Time.Truncate(step)
+	if !start.After(ws.now.Add(-ws.slide)) {
+		return
+	}
+
+	i := int(start.UnixNano()/int64(step)) % slideSteps
+	if i < 0 {
+		i += slideSteps
+	}
+	if !ws.stepStart[i].Equal(start) {
+		ws.steps[i] = make(ChannelCounts)
+		ws.stepStart[i] = start
+	}
+	ws.steps[i][z.ToChan]++
+}
+
+// Zaps returns the number of zaps to the channel in the sliding window that
+// ends with the latest zap
+func (ws *WindowStats) Zaps(chName string) int {
+	return ws.ZapsPerChannel()[chName]
+}
+
+// ZapsPerChannel returns the number of zaps to each channel in the sliding
+// window that ends with the latest zap
+func (ws *WindowStats) ZapsPerChannel() ChannelCounts {
+	ws.mu.RLock()
+	defer ws.mu.RUnlock()
+
+	zaps := make(ChannelCounts)
+	oldest := ws.now.Add(-ws.slide)
+	for i, counts := range ws.steps {
+		if !ws.stepStart[i].After(oldest) {
+			continue
+		}
+		for ch, n := range counts {
+			zaps[ch] += n
+		}
+	}
+	return zaps
+}
+
+// Viewers returns the current viewer count of the channel
+func (ws *WindowStats) Viewers(chName string) int {
+	ws.mu.RLock()
+	defer ws.mu.RUnlock()
+
+	return ws.viewers[chName]
+}
+
+// Buckets returns the channel's statistics for each retained tumbling window,
+// oldest first, followed by the current window up to the latest zap
+func (ws *WindowStats) Buckets(chName string) []WindowBucket {
+	ws.mu.RLock()
+	defer ws.mu.RUnlock()
+
+	if ws.cur == nil {
+		return nil
+	}
+
+	buckets := make([]WindowBucket, 0, len(ws.closed)+1)
+	for _, w := range ws.closed {
+		buckets = append(buckets, w.bucket(chName, w.end.Sub(w.start), w.area[chName]))
+	}
+
+	// The current window so far
+	area := ws.cur.area[chName]
+	if since, ok := ws.since[chName]; ok {
+		area += float64(ws.viewers[chName]) * ws.now.Sub(since).Seconds()
+	}
+	b := ws.cur.bucket(chName, ws.now.Sub(ws.cur.start), area)
+	b.End = ws.cur.end
+	if ws.now.Equal(ws.cur.start) {
+		b.AvgViewers = float64(ws.viewers[chName])
+	}
+
+	return append(buckets, b)
+}
+
+// bucket returns the statistics of a channel over the given length of the window
+func (w *window) bucket(chName string, length time.Duration, area float64) WindowBucket {
+	b := WindowBucket{
+		Start: w.start,
+		End:   w.start.Add(length),
+		Peak:  w.peak[chName],
+		Zaps:  w.zaps[chName],
+	}
+	if length > 0 {
+		b.AvgViewers = area / length.Seconds()
+	}
+	return b
+}
+
+// MovingAverage returns the simple moving average of the channel's average
+// viewers over the last n closed tumbling windows, or over every closed window
+// if fewer have been retained. Windows cut short at midnight count like full
+// windows.
+func (ws *WindowStats) MovingAverage(chName string, n int) float64 {
+	ws.mu.RLock()
+	defer ws.mu.RUnlock()
+
+	if n > len(ws.closed) {
+		n = len(ws.closed)
+	}
+	if n < 1 {
+		return 0
+	}
+
+	var sum float64
+	for _, w := range ws.closed[len(ws.closed)-n:] {
+		sum += w.area[chName] / w.end.Sub(w.start).Seconds()
+	}
+	return sum / float64(n)
+}
+
+// Peak returns the highest viewer count of the channel since the first zap,
+// and when it was first reached
+func (ws *WindowStats) Peak(chName string) Peak {
+	ws.mu.RLock()
+	defer ws.mu.RUnlock()
+
+	return ws.peaks[chName]
+}
@@ -0,0 +1,170 @@
+package zlog
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	zap ".."
+)
+
+// windowZaps spans two 15 minute windows and the start of a third
+var windowZaps = []struct {
+	min      int
+	ip       string
+	from, to string
+}{
+	{0, "10.0.0.1", zap.Off, "NRK1"},
+	{5, "10.0.0.2", zap.Off, "NRK1"},
+	{10, "10.0.0.1", "NRK1", "NRK2"},
+	{20, "10.0.0.3", zap.Off, "NRK1"},
+	{28, "10.0.0.2", "NRK1", zap.Off},
+	{31, "10.0.0.4", zap.Off, "NRK2"},
+}
+
+var windowtests = []struct {
+	start int
+	avg   float64
+	peak  int
+	zaps  int
+}{
+	// 1 viewer for 5 minutes, 2 for 5 and 1 for 5
+	{0, 20.0 / 15, 2, 2},
+	// 1 viewer for 5 minutes, 2 for 8 and 1 for 2
+	{15, 23.0 / 15, 2, 1},
+	// The current window, 1 viewer so far
+	{30, 1, 1, 0},
+}
+
+func newTestWindows(t *testing.T) *WindowStats {
+	ws, err := NewWindowStats(15*time.Minute, 5*time.Minute, 96)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2013, 7, 20, 18, 0, 0, 0, time.UTC)
+	for _, wz := range windowZaps {
+		ws.LogZap(zap.ChZap{
+			Time:     start.Add(time.Duration(wz.min) * time.Minute),
+			IP:       wz.ip,
+			FromChan: wz.from,
+			ToChan:   wz.to,
+		})
+	}
+	return ws
+}
+
+func TestWindowStatsBuckets(t *testing.T) {
+	ws := newTestWindows(t)
+	start := time.Date(2013, 7, 20, 18, 0, 0, 0, time.UTC)
+
+	buckets := ws.Buckets("NRK1")
+	if len(buckets) != len(windowtests) {
+		t.Fatalf("Buckets(NRK1) => %v buckets, want %v", len(buckets), len(windowtests))
+	}
+
+	for i, tt := range windowtests {
+		b := buckets[i]
+		if want := start.Add(time.Duration(tt.start) * time.Minute); !b.Start.Equal(want) {
+			t.Errorf("bucket %v: Start %v, want %v", i, b.Start, want)
+		}
+		if math.Abs(b.AvgViewers-tt.avg) > 1e-9 || b.Peak != tt.peak || b.Zaps != tt.zaps {
+			t.Errorf("bucket %v: (avg %v, peak %v, zaps %v), want (%v, %v, %v)",
+				i, b.AvgViewers, b.Peak, b.Zaps, tt.avg, tt.peak, tt.zaps)
+		}
+	}
+
+	if avg, want := ws.MovingAverage("NRK1", 2), (20.0+23.0)/30; math.Abs(avg-want) > 1e-9 {
+		t.Errorf("MovingAverage(NRK1, 2) => %v, want %v", avg, want)
+	}
+	if avg := ws.MovingAverage("NRK1", 0); avg != 0 {
+		t.Errorf("MovingAverage(NRK1, 0) => %v, want 0", avg)
+	}
+
+	want := Peak{Viewers: 2, Time: start.Add(5 * time.Minute)}
+	if p := ws.Peak("NRK1"); p != want {
+		t.Errorf("Peak(NRK1) => %v, want %v", p, want)
+	}
+}
+
+func TestWindowStatsSliding(t *testing.T) {
+	ws := newTestWindows(t)
+
+	// The sliding window covers the last 5 minutes, where the only zap to a
+	// channel is to NRK2. Zaps to OFF are not counted.
+	if n := ws.Zaps("NRK2"); n != 1 {
+		t.Errorf("Zaps(NRK2) => %v, want 1", n)
+	}
+	if n := ws.Zaps("NRK1"); n != 0 {
+		t.Errorf("Zaps(NRK1) => %v, want 0", n)
+	}
+	if zaps := ws.ZapsPerChannel(); len(zaps) != 1 {
+		t.Errorf("ZapsPerChannel() => %v, want only NRK2", zaps)
+	}
+}
+
+func TestWindowStatsRetain(t *testing.T) {
+	ws, err := NewWindowStats(time.Minute, time.Minute, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2013, 7, 20, 18, 0, 0, 0, time.UTC)
+	ws.LogZap(zap.ChZap{Time: start, IP: "10.0.0.1", FromChan: zap.Off, ToChan: "NRK1"})
+	ws.LogZap(zap.ChZap{Time: start.Add(time.Hour), IP: "10.0.0.2", FromChan: zap.Off, ToChan: "NRK1"})
+
+	buckets := ws.Buckets("NRK1")
+	if len(buckets) != 4 {
+		t.Fatalf("Buckets(NRK1) => %v buckets, want 3 retained and the current", len(buckets))
+	}
+	for _, b := range buckets[:3] {
+		if b.AvgViewers != 1 {
+			t.Errorf("bucket %v: AvgViewers %v, want 1", b.Start, b.AvgViewers)
+		}
+	}
+}
+
+// TestWindowStatsLocalDay checks that windows are counted from local midnight,
+// and that the last window of a day is cut short at midnight
+func TestWindowStatsLocalDay(t *testing.T) {
+	oslo, err := time.LoadLocation("Europe/Oslo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ws, err := NewWindowStats(10*time.Hour, time.Minute, 96)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ws.LogZap(zap.ChZap{Time: time.Date(2013, 7, 20, 19, 0, 0, 0, oslo), IP: "10.0.0.1", FromChan: zap.Off, ToChan: "NRK1"})
+	ws.LogZap(zap.ChZap{Time: time.Date(2013, 7, 21, 1, 0, 0, 0, oslo), IP: "10.0.0.1", FromChan: "NRK1", ToChan: zap.Off})
+
+	want := []WindowBucket{
+		{Start: time.Date(2013, 7, 20, 10, 0, 0, 0, oslo), End: time.Date(2013, 7, 20, 20, 0, 0, 0, oslo), AvgViewers: 0.1, Peak: 1, Zaps: 1},
+		{Start: time.Date(2013, 7, 20, 20, 0, 0, 0, oslo), End: time.Date(2013, 7, 21, 0, 0, 0, 0, oslo), AvgViewers: 1, Peak: 1},
+		{Start: time.Date(2013, 7, 21, 0, 0, 0, 0, oslo), End: time.Date(2013, 7, 21, 10, 0, 0, 0, oslo), AvgViewers: 1, Peak: 1},
+	}
+	buckets := ws.Buckets("NRK1")
+	if len(buckets) != len(want) {
+		t.Fatalf("Buckets(NRK1) => %v, want %v", buckets, want)
+	}
+	for i, b := range buckets {
+		if !b.Start.Equal(want[i].Start) || !b.End.Equal(want[i].End) || math.Abs(b.AvgViewers-want[i].AvgViewers) > 1e-9 ||
+			b.Peak != want[i].Peak || b.Zaps != want[i].Zaps {
+			t.Errorf("bucket %v => %+v, want %+v", i, b, want[i])
+		}
+	}
+
+	if avg := ws.MovingAverage("NRK1", 2); math.Abs(avg-0.55) > 1e-9 {
+		t.Errorf("MovingAverage(NRK1, 2) => %v, want 0.55", avg)
+	}
+}
+
+func TestNewWindowStatsErr(t *testing.T) {
+	if _, err := NewWindowStats(0, time.Minute, 1); err == nil {
+		t.Errorf("NewWindowStats with no window size => nil, want error")
+	}
+	if _, err := NewWindowStats(time.Minute, time.Minute, 0); err == nil {
+		t.Errorf("NewWindowStats retaining no windows => nil, want error")
+	}
+}
@@ -14,30 +14,88 @@ const minDur = time.Second * 5
 // PrintTimes is used to determine whether calculation times should be logged to console
 var PrintTimes bool
 
-// ZapLogger is the interface used by the various loggers
+// ZapLogger is the interface used by the various loggers. Implementations are
+// safe for concurrent use, and the results returned are copies which callers
+// are free to keep and modify.
+//
+// Zaps to and from zap.Off turn a box off and on, and OFF is never counted as a
+// channel. PoweredOn returns the number of boxes that are currently turned on.
+//
+// Viewers counts the boxes tuned to a channel, while Watching leaves out boxes
+// that report their TV as turned off or disconnected (HDMI_Status: 0). Loggers
+// learn about the TVs through LogStatus, see StatusLogger.
+//
+// Viewer counts only include boxes whose channel is known, so a logger started
+// in the middle of the day under-counts until it has seen most boxes zap.
+// Coverage tells how far it has come.
 type ZapLogger interface {
 	LogZap(z zap.ChZap)
+	PoweredOn() int
+	Coverage() Coverage
 	Entries() int
 	Viewers(channelName string) int
+	Watching(channelName string) int
 	Channels() []string
 	ChannelsViewers() []*ChannelViewers
 	FetchSorted(uint8) ChanViewersList
 	FetchStats() *map[string]ZapStats
 }
 
-// ZapsMap holds channel-viewercount pairs
-type ZapsMap map[string]int
+// ChannelCounts holds channel-viewercount pairs
+type ChannelCounts map[string]int
 
-// ZapStats holds a per-channel, per-viewer average viewing duration and the sample size that the duration is based on.
+// channelsViewers creates a ChannelViewers for each channel in the map, with
+// the watching viewers taken from the second map
+func (zm ChannelCounts) channelsViewers(watching ChannelCounts) ChanViewersList {
+	list := make(ChanViewersList, 0, len(zm))
+	for key, value := range zm {
+		list = append(list, &ChannelViewers{key, value, watching[key]})
+	}
+	return list
+}
+
+// total returns the sum of the viewer counts, ie. the number of boxes watching
+// one of the channels
+func (zm ChannelCounts) total() int {
+	var n int
+	for _, v := range zm {
+		n += v
+	}
+	return n
+}
+
+// ZapStats holds per-channel, per-viewer viewing duration statistics and the sample size that they are based on.
 type ZapStats struct {
 	AvgDur     time.Duration
 	SampleSize uint32
+
+	// Variance is the sample variance in seconds squared
+	Variance float64
+	StdDev   time.Duration
+	MinDur   time.Duration
+	MaxDur   time.Duration
+
+	// Estimated percentiles, accurate to within 1%
+	P50 time.Duration
+	P90 time.Duration
+	P99 time.Duration
 }
 
-// ChannelViewers holds a Channel-Viewers pair
+// copyStats returns a copy of a map of channel and ZapStats pairs
+func copyStats(stats map[string]ZapStats) map[string]ZapStats {
+	c := make(map[string]ZapStats, len(stats))
+	for k, v := range stats {
+		c[k] = v
+	}
+	return c
+}
+
+// ChannelViewers holds a Channel-Viewers pair. Viewers are the boxes tuned to
+// the channel, and Watching are those of them with their TV on.
 type ChannelViewers struct {
-	Channel string
-	Viewers int
+	Channel  string
+	Viewers  int
+	Watching int
 }
 
 func (cv ChannelViewers) String() string {
@@ -47,6 +105,21 @@ func (cv ChannelViewers) String() string {
 // ChanViewersList holds an array of ChannelViewers
 type ChanViewersList []*ChannelViewers
 
+// copyN returns a deep copy of the first n elements of the list, or all of them
+// if n is negative
+func (t ChanViewersList) copyN(n int) ChanViewersList {
+	if n < 0 || n > len(t) {
+		n = len(t)
+	}
+
+	list := make(ChanViewersList, n)
+	for i, cv := range t[:n] {
+		c := *cv
+		list[i] = &c
+	}
+	return list
+}
+
 // ByViewers holds a ChanViewersList and is used for implementing the sorting interface
 type ByViewers struct{ ChanViewersList }
 
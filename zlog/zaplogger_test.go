@@ -0,0 +1,298 @@
+package zlog
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	zap ".."
+)
+
+var loggers = []struct {
+	name string
+	new  func() ZapLogger
+}{
+	{"simple", NewSimpleZapLogger},
+	{"viewers", NewViewersZapLogger},
+	{"advanced", NewAdvancedZapLogger},
+	{"snapshot", func() ZapLogger { return NewSnapshotZapLogger(0) }},
+	{"ranked", NewRankedZapLogger},
+	{"mute", NewMuteZapLogger},
+	{"flow", func() ZapLogger {
+		zl, _ := NewFlowZapLogger(15*time.Minute, 96)
+		return zl
+	}},
+}
+
+var channels = []string{"NRK1", "NRK2", "TV2 Norge", "TVNORGE", "TV3"}
+
+// testZaps creates n zaps spread over a few IPs, each IP moving through the channels in turn
+func testZaps(n int) []zap.ChZap {
+	start := time.Date(2013, 7, 20, 18, 0, 0, 0, time.UTC)
+	zaps := make([]zap.ChZap, n)
+	for i := range zaps {
+		zaps[i] = zap.ChZap{
+			Time:     start.Add(time.Duration(i) * time.Second),
+			IP:       fmt.Sprintf("10.0.0.%d", i%50),
+			FromChan: channels[(i/50)%len(channels)],
+			ToChan:   channels[(i/50+1)%len(channels)],
+		}
+	}
+	return zaps
+}
+
+// TestLoggersConcurrent logs zaps from one goroutine while others read, like
+// the ingester, the console printers and the gRPC subscribers. Run with -race.
+func TestLoggersConcurrent(t *testing.T) {
+	zaps := testZaps(2000)
+
+	for _, l := range loggers {
+		zl := l.new()
+		done := make(chan struct{})
+		var wg sync.WaitGroup
+
+		for r := 0; r < 4; r++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for {
+					select {
+					case <-done:
+						return
+					default:
+					}
+
+					zl.Entries()
+					zl.PoweredOn()
+					zl.Viewers("NRK1")
+					zl.Channels()
+					for _, cv := range zl.ChannelsViewers() {
+						cv.Viewers = -1
+					}
+					zl.FetchSorted(3)
+					if stats := zl.FetchStats(); stats != nil {
+						(*stats)["NRK1"] = ZapStats{}
+					}
+				}
+			}()
+		}
+
+		for _, z := range zaps {
+			zl.LogZap(z)
+		}
+		close(done)
+		wg.Wait()
+
+		for _, cv := range zl.ChannelsViewers() {
+			if cv.Viewers < 0 {
+				t.Errorf("%v: ChannelsViewers() => %v, callers modified the logger's state", l.name, cv)
+			}
+		}
+		if stats := zl.FetchStats(); stats != nil {
+			if s := (*stats)["NRK1"]; s.SampleSize == 0 {
+				t.Errorf("%v: FetchStats() => %v for NRK1, callers modified the logger's state", l.name, s)
+			}
+		}
+	}
+}
+
+func TestFetchSortedShortList(t *testing.T) {
+	for _, l := range loggers {
+		zl := l.new()
+		for _, z := range testZaps(10) {
+			zl.LogZap(z)
+		}
+
+		// Fewer channels than requested must not panic
+		if n := len(zl.FetchSorted(10)); n < 1 || n > 2 {
+			t.Errorf("%v: FetchSorted(10) => %v channels, want 1 or 2", l.name, n)
+		}
+	}
+}
+
+// powertests turns two boxes on and off. Each step lists the viewers of NRK1
+// and NRK2 and the number of boxes turned on after the zap.
+var powertests = []struct {
+	ip, from, to string
+	nrk1, nrk2   int
+	on           int
+}{
+	{"10.0.0.1", zap.Off, "NRK1", 1, 0, 1},
+	{"10.0.0.2", zap.Off, "NRK2", 1, 1, 2},
+	{"10.0.0.1", "NRK1", "NRK2", 0, 2, 2},
+	{"10.0.0.2", "NRK2", zap.Off, 0, 1, 1},
+	{"10.0.0.1", "NRK2", zap.Off, 0, 0, 0},
+	{"10.0.0.2", zap.Off, "NRK1", 1, 0, 1},
+}
+
+func TestLoggersPower(t *testing.T) {
+	start := time.Date(2013, 7, 20, 18, 0, 0, 0, time.UTC)
+
+	for _, l := range loggers {
+		zl := l.new()
+
+		for i, tt := range powertests {
+			zl.LogZap(zap.ChZap{
+				Time:     start.Add(time.Duration(i) * time.Minute),
+				IP:       tt.ip,
+				FromChan: tt.from,
+				ToChan:   tt.to,
+			})
+
+			if v := zl.Viewers("NRK1"); v != tt.nrk1 {
+				t.Errorf("%v: step %v: Viewers(NRK1) => %v, want %v", l.name, i, v, tt.nrk1)
+			}
+			if v := zl.Viewers("NRK2"); v != tt.nrk2 {
+				t.Errorf("%v: step %v: Viewers(NRK2) => %v, want %v", l.name, i, v, tt.nrk2)
+			}
+			if v := zl.Viewers(zap.Off); v != 0 {
+				t.Errorf("%v: step %v: Viewers(OFF) => %v, want 0", l.name, i, v)
+			}
+			if on := zl.PoweredOn(); on != tt.on {
+				t.Errorf("%v: step %v: PoweredOn() => %v, want %v", l.name, i, on, tt.on)
+			}
+			for _, ch := range zl.Channels() {
+				if ch == zap.Off {
+					t.Errorf("%v: step %v: Channels() => %v, want no OFF", l.name, i, zl.Channels())
+				}
+			}
+			for _, cv := range zl.FetchSorted(10) {
+				if cv.Channel == zap.Off {
+					t.Errorf("%v: step %v: FetchSorted(10) => %v, want no OFF", l.name, i, cv)
+				}
+			}
+		}
+
+		if stats := zl.FetchStats(); stats != nil {
+			if _, ok := (*stats)[zap.Off]; ok {
+				t.Errorf("%v: FetchStats() has durations for OFF", l.name)
+			}
+			if s := (*stats)["NRK2"]; s.SampleSize != 2 {
+				t.Errorf("%v: FetchStats() NRK2 sample size %v, want 2", l.name, s.SampleSize)
+			}
+		}
+	}
+}
+
+// coldstarttests logs zaps from boxes that were already watching when the
+// logger started. Each step lists the viewers of NRK1 and NRK2 after the zap.
+var coldstarttests = []struct {
+	ip, from, to string
+	nrk1, nrk2   int
+}{
+	{"10.0.0.1", "NRK1", "NRK2", 0, 1},
+	{"10.0.0.2", zap.Off, "NRK1", 1, 1},
+	{"10.0.0.1", "NRK2", "NRK1", 2, 0},
+	// Must not take a viewer from NRK1, where this box was never counted
+	{"10.0.0.3", "NRK1", "NRK2", 2, 1},
+}
+
+func TestLoggersColdStart(t *testing.T) {
+	start := time.Date(2013, 7, 20, 18, 0, 0, 0, time.UTC)
+	want := Coverage{Boxes: 3, UnknownOrigin: 2, Ratio: 0.5}
+
+	for _, l := range loggers {
+		zl := l.new()
+
+		if c := zl.Coverage(); c != (Coverage{}) {
+			t.Errorf("%v: Coverage() before logging => %v, want zero", l.name, c)
+		}
+
+		for i, tt := range coldstarttests {
+			zl.LogZap(zap.ChZap{
+				Time:     start.Add(time.Duration(i) * time.Minute),
+				IP:       tt.ip,
+				FromChan: tt.from,
+				ToChan:   tt.to,
+			})
+
+			if v := zl.Viewers("NRK1"); v != tt.nrk1 {
+				t.Errorf("%v: step %v: Viewers(NRK1) => %v, want %v", l.name, i, v, tt.nrk1)
+			}
+			if v := zl.Viewers("NRK2"); v != tt.nrk2 {
+				t.Errorf("%v: step %v: Viewers(NRK2) => %v, want %v", l.name, i, v, tt.nrk2)
+			}
+		}
+
+		if c := zl.Coverage(); c != want {
+			t.Errorf("%v: Coverage() => %v, want %v", l.name, c, want)
+		}
+		if on := zl.PoweredOn(); on != 3 {
+			t.Errorf("%v: PoweredOn() => %v, want 3", l.name, on)
+		}
+	}
+}
+
+// hdmitests zaps and turns TVs on and off. A step is a zap when to is set, and
+// an HDMI_Status change otherwise. Each step lists the viewers tuned to NRK1
+// and NRK2 and the viewers watching them after the event.
+var hdmitests = []struct {
+	ip, from, to string
+	hdmi         int
+	nrk1, nrk2   int
+	watch1       int
+	watch2       int
+}{
+	{"10.0.0.1", zap.Off, "NRK1", 0, 1, 0, 1, 0},
+	{"10.0.0.2", zap.Off, "NRK1", 0, 2, 0, 2, 0},
+	{"10.0.0.1", "", "", 0, 2, 0, 1, 0},
+	{"10.0.0.1", "NRK1", "NRK2", 0, 1, 1, 1, 0},
+	{"10.0.0.1", "", "", 1, 1, 1, 1, 1},
+	{"10.0.0.2", "", "", 0, 1, 1, 0, 1},
+	{"10.0.0.2", "", "", 0, 1, 1, 0, 1},
+	{"10.0.0.2", "NRK1", zap.Off, 0, 0, 1, 0, 1},
+	// A box that is turned on is taken to have its TV on
+	{"10.0.0.2", zap.Off, "NRK1", 0, 1, 1, 1, 1},
+	// The TV of a box that has not zapped is not known
+	{"10.0.0.3", "", "", 0, 1, 1, 1, 1},
+	{"10.0.0.3", "NRK2", "NRK1", 0, 2, 1, 2, 1},
+}
+
+func TestLoggersHDMI(t *testing.T) {
+	start := time.Date(2013, 7, 20, 18, 0, 0, 0, time.UTC)
+
+	for _, l := range loggers {
+		zl := l.new()
+		sl, ok := zl.(StatusLogger)
+		if !ok {
+			t.Errorf("%v: does not log status changes", l.name)
+			continue
+		}
+
+		for i, tt := range hdmitests {
+			at := start.Add(time.Duration(i) * time.Minute)
+			if tt.to != "" {
+				zl.LogZap(zap.ChZap{Time: at, IP: tt.ip, FromChan: tt.from, ToChan: tt.to})
+			} else {
+				sl.LogStatus(zap.StatusChange{Time: at, IP: tt.ip, Kind: zap.StatusHDMI, Value: tt.hdmi})
+			}
+
+			if v := zl.Viewers("NRK1"); v != tt.nrk1 {
+				t.Errorf("%v: step %v: Viewers(NRK1) => %v, want %v", l.name, i, v, tt.nrk1)
+			}
+			if v := zl.Viewers("NRK2"); v != tt.nrk2 {
+				t.Errorf("%v: step %v: Viewers(NRK2) => %v, want %v", l.name, i, v, tt.nrk2)
+			}
+			if w := zl.Watching("NRK1"); w != tt.watch1 {
+				t.Errorf("%v: step %v: Watching(NRK1) => %v, want %v", l.name, i, w, tt.watch1)
+			}
+			if w := zl.Watching("NRK2"); w != tt.watch2 {
+				t.Errorf("%v: step %v: Watching(NRK2) => %v, want %v", l.name, i, w, tt.watch2)
+			}
+		}
+
+		// Mute status changes do not turn TVs off
+		sl.LogStatus(zap.StatusChange{Time: start, IP: "10.0.0.1", Kind: zap.StatusMute, Value: 1})
+
+		want := map[string]ChannelViewers{
+			"NRK1": {"NRK1", 2, 2},
+			"NRK2": {"NRK2", 1, 1},
+		}
+		for _, cv := range zl.FetchSorted(10) {
+			if *cv != want[cv.Channel] {
+				t.Errorf("%v: FetchSorted(10) => %v, want %v", l.name, *cv, want[cv.Channel])
+			}
+		}
+	}
+}
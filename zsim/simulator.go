@@ -0,0 +1,315 @@
+// Package zsim simulates a population of set-top boxes. The simulator produces
+// the same event strings as the ZapBox set-top boxes, and keeps the true viewer
+// counts so that loggers can be validated against them.
+package zsim
+
+import (
+	"container/heap"
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+
+	zap ".."
+)
+
+// Off is the channel name a box zaps to when it is turned off
+const Off = zap.Off
+
+// Channel is a channel in the simulated catalogue. Its weight decides how
+// popular the channel is compared to the others.
+type Channel struct {
+	Name   string
+	Weight float64
+}
+
+// DefaultChannels is a catalogue of Norwegian channels with rough popularity weights
+var DefaultChannels = []Channel{
+	{"NRK1", 30},
+	{"TV2 Norge", 22},
+	{"TVNORGE", 9},
+	{"TV3", 8},
+	{"NRK2", 5},
+	{"NRK3", 4},
+	{"TV2 Zebra", 4},
+	{"TV2 Nyhetskanalen", 3},
+	{"Viasat 4", 3},
+	{"MAX", 3},
+	{"FEM", 3},
+	{"TV2 Bliss", 2},
+	{"TV2 Film", 2},
+	{"Disney XD", 2},
+	{"Canal 9", 1},
+	{"NRK Super", 1},
+}
+
+// Config describes the simulated population
+type Config struct {
+	Boxes    int
+	Channels []Channel
+	Seed     int64
+
+	// Start is the timestamp of the simulation. If Duration is zero the
+	// simulation never ends.
+	Start    time.Time
+	Duration time.Duration
+
+	// MeanDwell is the mean time spent on a channel before zapping
+	MeanDwell time.Duration
+	// MeanOff is the mean time a box stays turned off at peak hours. Boxes
+	// stay off longer outside peak hours.
+	MeanOff time.Duration
+	// FlipBurst is the probability that a zap starts a burst of short
+	// flip-through zaps
+	FlipBurst float64
+}
+
+// DefaultConfig returns the configuration for n boxes starting at 18:00
+func DefaultConfig(n int) Config {
+	return Config{
+		Boxes:     n,
+		Channels:  DefaultChannels,
+		Seed:      1,
+		Start:     time.Date(2013, 7, 20, 18, 0, 0, 0, zap.ZapBox2013.Location()),
+		MeanDwell: 10 * time.Minute,
+		MeanOff:   2 * time.Hour,
+		FlipBurst: 0.15,
+	}
+}
+
+// Simulator produces events for a population of set-top boxes. Every box starts
+// out turned off.
+type Simulator struct {
+	cfg     Config
+	rng     *rand.Rand
+	end     time.Time
+	weights []float64
+	boxes   []box
+	queue   eventQueue
+	viewers []int
+	on      int
+}
+
+type box struct {
+	ip      uint32
+	channel int16 // index into the channel catalogue, or -1 when turned off
+	volume  int8
+	muted   bool
+	hdmi    bool
+	flips   int8 // remaining zaps in a flip-through burst
+}
+
+// NewSimulator creates a simulator for the given configuration
+func NewSimulator(cfg Config) (*Simulator, error) {
+	if cfg.Boxes < 1 || cfg.Boxes > 1<<24 {
+		return nil, fmt.Errorf("NewSimulator: need between 1 and %v boxes, got %v", 1<<24, cfg.Boxes)
+	}
+	if len(cfg.Channels) < 2 || len(cfg.Channels) > math.MaxInt16 {
+		return nil, fmt.Errorf("NewSimulator: need between 2 and %v channels, got %v", math.MaxInt16, len(cfg.Channels))
+	}
+	if cfg.MeanDwell <= 0 || cfg.MeanOff <= 0 {
+		return nil, fmt.Errorf("NewSimulator: mean dwell and off times must be positive")
+	}
+
+	s := &Simulator{
+		cfg:     cfg,
+		rng:     rand.New(rand.NewSource(cfg.Seed)),
+		boxes:   make([]box, cfg.Boxes),
+		queue:   make(eventQueue, cfg.Boxes),
+		viewers: make([]int, len(cfg.Channels)),
+	}
+
+	if cfg.Duration > 0 {
+		s.end = cfg.Start.Add(cfg.Duration)
+	}
+
+	var sum float64
+	for _, ch := range cfg.Channels {
+		sum += ch.Weight
+		s.weights = append(s.weights, sum)
+	}
+
+	// Unique addresses in 10.0.0.0/8, spread out by multiplying with an odd number
+	base := s.rng.Uint32()
+	for i := range s.boxes {
+		s.boxes[i] = box{
+			ip:      10<<24 | (base+uint32(i)*2654435761)&0xffffff,
+			channel: -1,
+			volume:  int8(20 + s.rng.Intn(40)),
+			hdmi:    true,
+		}
+		s.queue[i] = event{at: cfg.Start.Add(s.exp(s.offTime(cfg.Start))), box: int32(i)}
+	}
+	heap.Init(&s.queue)
+
+	return s, nil
+}
+
+// Next returns the next event string and its timestamp. It returns false when
+// the simulation has ended.
+func (s *Simulator) Next() (string, time.Time, bool) {
+	next := s.queue[0]
+	if !s.end.IsZero() && next.at.After(s.end) {
+		return "", time.Time{}, false
+	}
+
+	b := &s.boxes[next.box]
+	line, delay := s.step(b, next.at)
+
+	s.queue[0].at = next.at.Add(delay)
+	heap.Fix(&s.queue, 0)
+
+	return line, next.at, true
+}
+
+// Viewers returns the true number of viewers for each channel
+func (s *Simulator) Viewers() map[string]int {
+	viewers := make(map[string]int, len(s.viewers))
+	for i, n := range s.viewers {
+		viewers[s.cfg.Channels[i].Name] = n
+	}
+	return viewers
+}
+
+// PoweredOn returns the true number of boxes that are turned on
+func (s *Simulator) PoweredOn() int {
+	return s.on
+}
+
+// step performs the next action of a box and returns its event string along with
+// the time until the box acts again
+func (s *Simulator) step(b *box, t time.Time) (string, time.Duration) {
+	// Turned off; turn on and pick a channel
+	if b.channel < 0 {
+		s.on++
+		return s.zap(b, t, s.pickChannel(-1)), s.exp(s.cfg.MeanDwell)
+	}
+
+	// Flip-through views are shorter than the 5 second minimum used for statistics
+	if b.flips > 0 {
+		b.flips--
+		return s.zap(b, t, s.pickChannel(b.channel)), time.Duration(1+s.rng.Intn(4)) * time.Second
+	}
+
+	r := s.rng.Float64()
+	switch {
+	case r < 0.3*(1-activity(t)):
+		s.on--
+		return s.zap(b, t, -1), s.exp(s.offTime(t))
+	case r < 0.35:
+		b.volume += int8(s.rng.Intn(31) - 15)
+		if b.volume < 0 {
+			b.volume = 0
+		} else if b.volume > 100 {
+			b.volume = 100
+		}
+		return s.status(b, t, zap.StatusVolume, int(b.volume)), s.exp(s.cfg.MeanDwell / 2)
+	case r < 0.38:
+		b.muted = !b.muted
+		return s.status(b, t, zap.StatusMute, boolInt(b.muted)), s.exp(s.cfg.MeanDwell / 2)
+	case r < 0.39:
+		b.hdmi = !b.hdmi
+		return s.status(b, t, zap.StatusHDMI, boolInt(b.hdmi)), s.exp(s.cfg.MeanDwell / 2)
+	}
+
+	if s.rng.Float64() < s.cfg.FlipBurst {
+		b.flips = int8(1 + s.rng.Intn(7))
+		return s.zap(b, t, s.pickChannel(b.channel)), time.Duration(1+s.rng.Intn(4)) * time.Second
+	}
+
+	return s.zap(b, t, s.pickChannel(b.channel)), s.exp(s.cfg.MeanDwell)
+}
+
+// zap moves the box to another channel, where -1 turns it off. The new channel
+// is written before the previous one, as in the ZapBox 2013 schema.
+func (s *Simulator) zap(b *box, t time.Time, to int16) string {
+	from := s.channelName(b.channel)
+	if b.channel >= 0 {
+		s.viewers[b.channel]--
+	}
+	if to >= 0 {
+		s.viewers[to]++
+	}
+	b.channel = to
+
+	return zap.ChZap{Time: t, IP: ipString(b.ip), ToChan: s.channelName(to), FromChan: from}.Format()
+}
+
+func (s *Simulator) status(b *box, t time.Time, kind zap.StatusKind, value int) string {
+	return zap.StatusChange{Time: t, IP: ipString(b.ip), Kind: kind, Value: value}.Format()
+}
+
+func (s *Simulator) channelName(i int16) string {
+	if i < 0 {
+		return Off
+	}
+	return s.cfg.Channels[i].Name
+}
+
+// pickChannel picks a channel by popularity, other than the current one
+func (s *Simulator) pickChannel(current int16) int16 {
+	for {
+		r := s.rng.Float64() * s.weights[len(s.weights)-1]
+		i := int16(0)
+		for s.weights[i] < r {
+			i++
+		}
+		if i != current {
+			return i
+		}
+	}
+}
+
+// offTime returns the mean time a box stays off, which grows outside peak hours
+func (s *Simulator) offTime(t time.Time) time.Duration {
+	return time.Duration(float64(s.cfg.MeanOff) / activity(t))
+}
+
+// exp returns an exponentially distributed duration of at least one second
+func (s *Simulator) exp(mean time.Duration) time.Duration {
+	d := time.Duration(s.rng.ExpFloat64() * float64(mean))
+	if d < time.Second {
+		return time.Second
+	}
+	return d
+}
+
+// activity returns how active viewers are at the time of day of t, between 0.1
+// at night and 1 during prime time
+func activity(t time.Time) float64 {
+	h := float64(t.Hour()) + float64(t.Minute())/60
+	morning := 0.3 * math.Exp(-(h-8)*(h-8)/2)
+	evening := math.Exp(-(h - 21) * (h - 21) / (2 * 2.5 * 2.5))
+	return math.Min(1, 0.1+morning+evening)
+}
+
+func ipString(ip uint32) string {
+	return fmt.Sprintf("%d.%d.%d.%d", ip>>24, ip>>16&0xff, ip>>8&0xff, ip&0xff)
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// event is the next action of a box
+type event struct {
+	at  time.Time
+	box int32
+}
+
+// eventQueue is a min-heap of events ordered by time
+type eventQueue []event
+
+func (q eventQueue) Len() int            { return len(q) }
+func (q eventQueue) Less(i, j int) bool  { return q[i].at.Before(q[j].at) }
+func (q eventQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *eventQueue) Push(x interface{}) { *q = append(*q, x.(event)) }
+func (q *eventQueue) Pop() interface{} {
+	old := *q
+	e := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return e
+}
@@ -0,0 +1,78 @@
+package zsim
+
+import (
+	"testing"
+	"time"
+
+	zap ".."
+)
+
+func TestSimulatorEvents(t *testing.T) {
+	cfg := DefaultConfig(500)
+	cfg.Duration = 2 * time.Hour
+
+	sim, err := NewSimulator(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Replay the events to rebuild the viewer counts and compare with the simulator
+	viewers := make(map[string]int)
+	var last time.Time
+	var n int
+
+	for {
+		line, ts, ok := sim.Next()
+		if !ok {
+			break
+		}
+		n++
+
+		if ts.Before(last) {
+			t.Fatalf("event %q at %v is earlier than the previous event at %v", line, ts, last)
+		}
+		last = ts
+
+		zCh, _, err := zap.NewSTBEvent(line)
+		if err != nil {
+			t.Fatalf("NewSTBEvent(%q) => %v", line, err)
+		}
+		if zCh == nil {
+			continue
+		}
+		if zCh.FromChan != Off {
+			viewers[zCh.FromChan]--
+		}
+		if zCh.ToChan != Off {
+			viewers[zCh.ToChan]++
+		}
+	}
+
+	if n == 0 {
+		t.Fatal("simulator produced no events")
+	}
+
+	var on int
+	for ch, want := range sim.Viewers() {
+		if viewers[ch] != want {
+			t.Errorf("viewers for %v => %v, want %v", ch, viewers[ch], want)
+		}
+		on += want
+	}
+	if on != sim.PoweredOn() {
+		t.Errorf("PoweredOn() => %v, want %v", sim.PoweredOn(), on)
+	}
+}
+
+func TestSimulatorSeed(t *testing.T) {
+	a, _ := NewSimulator(DefaultConfig(100))
+	b, _ := NewSimulator(DefaultConfig(100))
+
+	for i := 0; i < 1000; i++ {
+		la, _, _ := a.Next()
+		lb, _, _ := b.Next()
+		if la != lb {
+			t.Fatalf("event %v differs for the same seed: %q and %q", i, la, lb)
+		}
+	}
+}
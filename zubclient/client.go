@@ -77,15 +77,55 @@ func (zc *ZubClient) dumpTop10(r *pb.NotificationMessage) error {
 		thelist[0].GetViewcount()
 	*/
 
-	fmt.Printf("\n    Channel\t  Viewers     AvgDur   SampSize\n")
+	fmt.Printf("\nCoverage: %.1f%%\n", r.GetCoverage()*100)
+	fmt.Printf("\n    Channel\t  Viewers  Watching     AvgDur   SampSize\n")
 	for i, ch := range r.GetTop10() {
 		fmt.Printf(
-			"%2v: %-18v%3v\t%v\t%v\n",
+			"%2v: %-18v%3v\t%3v\t%v\t%v\n",
 			i+1, ch.GetChannelName(),
 			ch.GetViewcount(),
+			ch.GetWatching(),
 			ch.GetAvgDuration(),
-			ch.GetSampleSize()
+			ch.GetSampleSize(),
 		)
+
+		// Only sent when the distribution statistic was requested
+		if ch.GetStdDeviation() != "" {
+			fmt.Printf(
+				"    stddev %v, min %v, p50 %v, p90 %v, p99 %v, max %v\n",
+				ch.GetStdDeviation(),
+				ch.GetMinDuration(),
+				ch.GetP50Duration(),
+				ch.GetP90Duration(),
+				ch.GetP99Duration(),
+				ch.GetMaxDuration(),
+			)
+		}
+
+		// Only sent when the muted statistic was requested
+		if ch.GetAvgMuted() != "" {
+			fmt.Printf(
+				"    muted %v per viewer, %v muted now, peak %v at %v\n",
+				ch.GetAvgMuted(),
+				ch.GetMutedViewers(),
+				ch.GetPeakMuted(),
+				ch.GetPeakMutedTime(),
+			)
+		}
+
+		// Only sent when the volume statistic was requested
+		if len(ch.GetVolumeHistogram()) > 0 {
+			fmt.Printf(
+				"    volume %.1f, histogram %v, %v jumps",
+				ch.GetAvgVolume(),
+				ch.GetVolumeHistogram(),
+				ch.GetVolumeJumps(),
+			)
+			if ch.GetLastVolumeJump() != "" {
+				fmt.Printf(", latest at %v", ch.GetLastVolumeJump())
+			}
+			fmt.Println()
+		}
 	}
 
 	return nil
@@ -23,12 +23,16 @@ var errIterationTermination = errors.New("Iterator did not terminate correctly")
 
 type pubZerver struct {
 	logs zlog.ZapLogger
+
+	// volume is nil unless the server tracks volume levels
+	volume *zlog.VolumeStats
 }
 
-// NewPublisher launches a gRPC publishing server
-func NewPublisher(zlogger *zlog.ZapLogger) error {
+// NewPublisher launches a gRPC publishing server. Volume may be nil if the
+// server does not track volume levels.
+func NewPublisher(zlogger *zlog.ZapLogger, volume *zlog.VolumeStats) error {
 	grpcServer := grpc.NewServer()
-	zubserver := newPubServer(zlogger)
+	zubserver := newPubServer(zlogger, volume)
 	pb.RegisterSubscriptionServer(grpcServer, zubserver)
 	listener, err := net.Listen("tcp", "localhost:11101")
 	if err != nil {
@@ -39,9 +43,10 @@ func NewPublisher(zlogger *zlog.ZapLogger) error {
 	return grpcServer.Serve(listener)
 }
 
-func newPubServer(zlogger *zlog.ZapLogger) pb.SubscriptionServer {
+func newPubServer(zlogger *zlog.ZapLogger, volume *zlog.VolumeStats) pb.SubscriptionServer {
 	zs := new(pubZerver)
 	zs.logs = *zlogger
+	zs.volume = volume
 	return zs
 }
 
@@ -61,13 +66,24 @@ func (zs *pubZerver) Subscribe(stream pb.Subscription_SubscribeServer) error {
 	fmt.Printf("[ZubServer] Got subscription request with a refresh interval of %v and an enum of '%v'\n", freq, r.String())
 
 	for {
+		mzl, muteLogger := zs.logs.(*zlog.MuteZapLogger)
+
 		if zs.logs.Entries() < 1 {
 			// TODO error codes as int field?
 			res.Status = fmt.Sprintf("2: The server has not yet logged any channels. Retrying in %v", retryInterval)
+		} else if r == pb.SubscribeMessage_VOLUME && zs.volume == nil {
+			res.Status = "3: The server does not track volume levels"
+		} else if r == pb.SubscribeMessage_MUTED && !muteLogger {
+			res.Status = fmt.Sprintf("3: The server's %v does not track muting", zs.logs)
+		} else if r == pb.SubscribeMessage_MUTED {
+			res.Status = "1"
+			res.Coverage = zs.logs.Coverage().Ratio
+			res.Top10 = parseMuted(mzl)
 		} else {
 			res.Status = "1"
+			res.Coverage = zs.logs.Coverage().Ratio
 
-			res.Top10, err = parseTop10(r, zs.logs)
+			res.Top10, err = parseTop10(r, zs.logs, zs.volume)
 			if err != nil {
 				return err
 			}
@@ -82,13 +98,18 @@ func (zs *pubZerver) Subscribe(stream pb.Subscription_SubscribeServer) error {
 	}
 }
 
-func parseTop10(msg pb.SubscribeMessage_Statistics, zl zlog.ZapLogger) ([]*pb.NotificationMessage_Top10, error) {
+func parseTop10(msg pb.SubscribeMessage_Statistics, zl zlog.ZapLogger, volume *zlog.VolumeStats) ([]*pb.NotificationMessage_Top10, error) {
 
 	var r int
 	listLength := 10
 
 	sortedList := zl.FetchSorted(10)
-	statList := *zl.FetchStats()
+
+	// Loggers that do not support statistics return nil
+	var statList map[string]zlog.ZapStats
+	if stats := zl.FetchStats(); stats != nil {
+		statList = *stats
+	}
 
 	if sortedList.Len() < listLength {
 		listLength = sortedList.Len()
@@ -101,7 +122,8 @@ func parseTop10(msg pb.SubscribeMessage_Statistics, zl zlog.ZapLogger) ([]*pb.No
 	 * but simpler loggers need to return nil values to satisfy the interface. */
 
 	switch zl.(type) {
-	case *zlog.AdvancedZapLogger, *zlog.ZapsMap, *zlog.Zaps:
+	case *zlog.AdvancedZapLogger, *zlog.SnapshotZapLogger, *zlog.RankedZapLogger, *zlog.ZapsMap, *zlog.Zaps,
+		*zlog.MuteZapLogger, *zlog.FlowZapLogger:
 		// Assert logger type before trying to fetch statistics
 		// Potentially not needed if FetchStats returns well formed non-values for loggers that do not support statistics
 		break
@@ -111,11 +133,9 @@ func parseTop10(msg pb.SubscribeMessage_Statistics, zl zlog.ZapLogger) ([]*pb.No
 
 	for _, cv := range sortedList {
 
-		/* Do not include channels with no current viewers or 'OFF' entries
-		 * 'OFF' is added as a channel when someone turns off their zapbox (or tv?)
-		 * TODO prevent 'OFF' from being logged as a channel */
-
-		if cv.Channel == "OFF" || cv.Viewers < 1 {
+		// Do not include channels with no current viewers. The loggers treat
+		// 'OFF' as a power state, so it is never listed as a channel.
+		if cv.Viewers < 1 {
 			continue
 		}
 
@@ -143,10 +163,19 @@ func parseTop10(msg pb.SubscribeMessage_Statistics, zl zlog.ZapLogger) ([]*pb.No
 			field.Viewcount = uint32(cv.Viewers)
 		}
 
+		if msg == pb.SubscribeMessage_DISTRIBUTION {
+			setDistribution(field, statList[cv.Channel])
+		}
+
+		if msg == pb.SubscribeMessage_VOLUME {
+			setVolume(field, volume, cv.Channel)
+		}
+
 		/* TODO DEBUG /**/
 		field.SampleSize = statList[cv.Channel].SampleSize
 		field.AvgDuration = trimDuration(statList[cv.Channel].AvgDur)
 		field.Viewcount = uint32(cv.Viewers)
+		field.Watching = uint32(cv.Watching)
 
 		top10[r] = field
 
@@ -156,6 +185,51 @@ func parseTop10(msg pb.SubscribeMessage_Statistics, zl zlog.ZapLogger) ([]*pb.No
 	return top10, nil
 }
 
+// parseMuted builds the top10 list of the most muted channels
+func parseMuted(mzl *zlog.MuteZapLogger) []*pb.NotificationMessage_Top10 {
+	var top10 []*pb.NotificationMessage_Top10
+
+	for _, ms := range mzl.TopMuted(10) {
+		top10 = append(top10, &pb.NotificationMessage_Top10{
+			ChannelName:   ms.Channel,
+			Viewcount:     uint32(mzl.Viewers(ms.Channel)),
+			AvgMuted:      trimDuration(ms.AvgMuted),
+			MutedViewers:  uint32(ms.Muted),
+			PeakMuted:     uint32(ms.Peak),
+			PeakMutedTime: ms.PeakTime.Format("15:04:05"),
+		})
+	}
+
+	return top10
+}
+
+// setDistribution fills in the duration distribution fields of a top10 entry
+func setDistribution(field *pb.NotificationMessage_Top10, stats zlog.ZapStats) {
+	field.StdDeviation = trimDuration(stats.StdDev)
+	field.Variance = stats.Variance
+	field.MinDuration = trimDuration(stats.MinDur)
+	field.MaxDuration = trimDuration(stats.MaxDur)
+	field.P50Duration = trimDuration(stats.P50)
+	field.P90Duration = trimDuration(stats.P90)
+	field.P99Duration = trimDuration(stats.P99)
+}
+
+// setVolume fills in the volume fields of a top10 entry
+func setVolume(field *pb.NotificationMessage_Top10, volume *zlog.VolumeStats, chName string) {
+	cv := volume.Channel(chName)
+	field.AvgVolume = cv.Average
+	field.VolumeJumps = uint32(cv.Jumps)
+
+	field.VolumeHistogram = make([]uint32, len(cv.Histogram))
+	for i, n := range cv.Histogram {
+		field.VolumeHistogram[i] = uint32(n)
+	}
+
+	if jumps := volume.Jumps(chName); len(jumps) > 0 {
+		field.LastVolumeJump = jumps[len(jumps)-1].Start.Format("15:04:05")
+	}
+}
+
 // trimDuration strips decimals from a duration.String() result to avoid repeating decimals
 // p = 9 => 1 second precision
 func trimDuration(d time.Duration) string {